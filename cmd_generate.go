@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elauffenburger/oar/core"
+	"github.com/elauffenburger/oar/core/common"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/output"
+	"github.com/elauffenburger/oar/core/profile"
+	res "github.com/elauffenburger/oar/core/results"
+	"github.com/elauffenburger/oar/core/sinks"
+)
+
+var generateCommand = &command{
+	name:        "generate",
+	args:        "[flags] [config.json]",
+	description: "Generate rows from a configuration and write them to stdout or files.",
+	run:         runGenerate,
+}
+
+func runGenerate(cmd *command, args []string) (err error) {
+	flags := newFlagSet(cmd)
+	cf := addConfigFlags(flags)
+	stream := flags.Bool("stream", false, "stream output to stdout as rows are generated")
+	out := flags.String("out", "", "write output to files instead of stdout; the path may contain {name}, {output}, {date} and {shard}, and ending it in .gz or .zst compresses the output")
+	shardRows := flags.Int("shard-rows", 0, "with -out, start a new file after this many rows")
+	shardSize := flags.String("shard-size", "", "with -out, start a new file after this much uncompressed output, e.g. 100MB")
+	manifest := flags.String("manifest", "", "with -out, where to write a json manifest of the files produced (default: next to the output when sharding)")
+	db := flags.String("db", "", "insert rows directly into a database using this database/sql driver (sqlite3, postgres or mysql); the table is the config's name")
+	dsn := flags.String("dsn", "", "with -db, the data source name to connect to")
+	dbTx := flags.Int("db-tx", 0, "with -db, rows per transaction (default: all rows in one transaction)")
+	dbCopy := flags.Bool("db-copy", false, "with -db postgres, load rows with COPY instead of insert statements")
+	dbContinue := flags.Bool("db-continue", false, "with -db, keep going when a transaction fails")
+	progress := flags.Bool("progress", isTerminal(os.Stderr) && !isTerminal(os.Stdout), "show rows generated, rows/s, bytes written and time left on stderr (default: when stderr is a terminal and output goes elsewhere)")
+	stats := flags.Bool("stats", false, "print a summary of the run to stderr at the end, with the time spent in each type's loader")
+	profilePath := flags.String("profile", "", "write a report of what each field holds to this file once rows are generated: markdown if it ends in .md, otherwise json")
+	profileTop := flags.Int("profile-top", 10, "with -profile, the most frequent values to list for each field")
+	timeout := flags.Duration("timeout", 0, "stop generating after this long, e.g. 30s; like an interrupt, what's been generated is written or discarded according to the partial option")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if len(*out) == 0 && (*shardRows != 0 || len(*shardSize) != 0 || len(*manifest) != 0) {
+		return usageErrorf("-shard-rows, -shard-size and -manifest require -out")
+	}
+
+	if len(*db) == 0 && (len(*dsn) != 0 || *dbTx != 0 || *dbCopy || *dbContinue) {
+		return usageErrorf("-dsn, -db-tx, -db-copy and -db-continue require -db")
+	}
+
+	if len(*db) != 0 && (len(*out) != 0 || *stream) {
+		return usageErrorf("-db can't be combined with -out or -stream")
+	}
+
+	if *shardRows < 0 {
+		return usageErrorf("-shard-rows can't be negative")
+	}
+
+	if *timeout < 0 {
+		return usageErrorf("-timeout can't be negative")
+	}
+
+	if *profileTop < 0 {
+		return usageErrorf("-profile-top can't be negative")
+	}
+
+	var maxBytes int64
+	if len(*shardSize) != 0 {
+		size, err := common.ParseByteSize(*shardSize)
+		if err != nil {
+			return usageErrorf("%s", err)
+		}
+
+		maxBytes = size
+	}
+
+	config, err := cf.load()
+	if err != nil {
+		return err
+	}
+
+	// streamed rows and committed transactions can't be taken back
+	if config.Options.Partial() == conf.DiscardPartialOutput {
+		if *stream {
+			return usageErrorf("-stream writes rows as they're generated, so they can't be discarded with partial=discard")
+		}
+
+		if *dbTx != 0 {
+			return usageErrorf("-db-tx commits rows before generation ends, so they can't be discarded with partial=discard")
+		}
+	}
+
+	ctx, stop := generationContext(*timeout)
+	defer stop()
+
+	var report *generationReport
+	if *progress || *stats {
+		report = newGenerationReport(config, os.Stderr, *stats)
+		ctx = core.WithMetrics(ctx, report.metrics)
+
+		if *progress {
+			report.startProgress()
+		}
+
+		defer report.finish()
+	}
+
+	// rows are profiled on their way to the output, and the report is written even if generation stops early
+	var recorder *profile.Recorder
+	if len(*profilePath) != 0 {
+		recorder = profile.NewRecorder(config)
+		defer func() {
+			if profileErr := writeProfile(recorder.Report(*profileTop), *profilePath); err == nil {
+				err = profileErr
+			}
+		}()
+	}
+
+	if len(*db) != 0 {
+		formatter := output.NewSqlOutputFormatter(config.Name)
+
+		sink, err := sinks.NewDbSink(formatter, sinks.DbSinkOptions{
+			Driver:          *db,
+			DSN:             *dsn,
+			BatchSize:       config.Options.BatchSize(),
+			TransactionSize: *dbTx,
+			Copy:            *dbCopy,
+			ContinueOnError: *dbContinue,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		err = generateToSink(ctx, config, profiled(sink, recorder))
+		report.stopProgress()
+
+		dbReport := sink.Report
+		fmt.Fprintf(os.Stderr, "Inserted %d rows in %d transaction(s); %d rows failed\n", dbReport.RowsInserted, dbReport.Transactions, dbReport.RowsFailed)
+		for _, txErr := range dbReport.Errors {
+			fmt.Fprintf(os.Stderr, "  %s\n", txErr)
+		}
+
+		if err == nil && dbReport.RowsFailed != 0 {
+			err = fmt.Errorf("%d rows failed to insert", dbReport.RowsFailed)
+		}
+
+		return err
+	}
+
+	formatter := report.formatter(core.GetOutputFormatter(config))
+
+	if len(*out) != 0 {
+		sink, err := sinks.NewFileSink(config, formatter, sinks.FileSinkOptions{
+			Path:            *out,
+			MaxRowsPerFile:  *shardRows,
+			MaxBytesPerFile: maxBytes,
+			ManifestPath:    *manifest,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		err = generateToSink(ctx, config, profiled(sink, recorder))
+		report.stopProgress()
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Wrote %d rows to %d file(s)\n", sink.Manifest.Rows, len(sink.Manifest.Files))
+		return nil
+	}
+
+	if *stream {
+		return generateToSink(ctx, config, profiled(sinks.NewStreamSink(formatter, os.Stdout), recorder))
+	}
+
+	results, err := core.GenerateResultsWithContext(ctx, config)
+	if results == nil {
+		return generationError(err)
+	}
+
+	if recorder != nil {
+		for _, row := range results.Rows {
+			recorder.Add(row)
+		}
+	}
+
+	// rows generated before generation was stopped are written in full
+	formatCtx := ctx
+	if err != nil {
+		formatCtx = context.Background()
+	}
+
+	stdout := bufio.NewWriter(os.Stdout)
+	if formatErr := output.FormatToStreamWithContext(formatCtx, formatter, results, stdout, config.Options.Partial()); err == nil {
+		err = formatErr
+	}
+
+	if flushErr := stdout.Flush(); err == nil {
+		err = flushErr
+	}
+
+	return generationError(err)
+}
+
+// generationContext is done when oar is interrupted, or once timeout has passed if it isn't 0
+func generationContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	if timeout == 0 {
+		return ctx, stop
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// generationError describes why generation failed or was stopped, if it was
+func generationError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("Generation was interrupted")
+	case errors.Is(err, context.DeadlineExceeded):
+		return fmt.Errorf("Generation timed out")
+	}
+
+	return fmt.Errorf("Error generating results: %s", err)
+}
+
+// profilingSink profiles rows on their way to another sink
+type profilingSink struct {
+	sinks.Sink
+	recorder *profile.Recorder
+}
+
+func (sink *profilingSink) Write(row *res.ResultsRow) error {
+	sink.recorder.Add(row)
+	return sink.Sink.Write(row)
+}
+
+// Discard discards what the profiled sink wrote, or closes it if it can't be
+func (sink *profilingSink) Discard() error {
+	if discarder, ok := sink.Sink.(sinks.Discarder); ok {
+		return discarder.Discard()
+	}
+
+	return sink.Sink.Close()
+}
+
+// profiled returns sink, profiling the rows written to it with recorder if there is one
+func profiled(sink sinks.Sink, recorder *profile.Recorder) sinks.Sink {
+	if recorder == nil {
+		return sink
+	}
+
+	return &profilingSink{Sink: sink, recorder: recorder}
+}
+
+// writeProfile writes report to path, as markdown if it ends in .md and json otherwise
+func writeProfile(report *profile.Report, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("Failed to write profile '%s': %s", path, err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		err = report.WriteMarkdown(file)
+	} else {
+		err = report.WriteJSON(file)
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to write profile '%s': %s", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elauffenburger/oar/core/ddl"
+	"github.com/elauffenburger/oar/core/importers"
+)
+
+var importDDLCommand = &command{
+	name:        "import-ddl",
+	args:        "[flags] schema.sql",
+	description: "Write a configuration for each CREATE TABLE statement in a SQL file.",
+	run:         runImportDDL,
+}
+
+func runImportDDL(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	out := flags.String("out", ".", "directory to write the configurations to, one <table>.json per table")
+	rows := flags.Int("rows", 100, "rows to generate for each table")
+	dataDir := flags.String("data", "./data", "directory containing the csv data files")
+	nullRate := flags.Float64("nullrate", 0.1, "nullrate of nullable columns")
+	force := flags.Bool("force", false, "overwrite configurations that already exist")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageErrorf("expected the path of one sql file, or - for stdin")
+	}
+
+	if *rows < 0 {
+		return usageErrorf("-rows can't be negative")
+	}
+
+	if *nullRate < 0 || *nullRate > 1 {
+		return usageErrorf("-nullrate must be between 0 and 1")
+	}
+
+	var content []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(flags.Arg(0))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	tables, err := ddl.Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("Failed to parse '%s': %s", flags.Arg(0), err)
+	}
+
+	if len(tables) == 0 {
+		return fmt.Errorf("No CREATE TABLE statements found in '%s'", flags.Arg(0))
+	}
+
+	relDataDir, err := relativeDataDir(*out, *dataDir)
+	if err != nil {
+		return err
+	}
+
+	configs := importers.ConfigurationsFromDDL(tables, importers.DDLOptions{Rows: *rows, DataDir: relDataDir, NullRate: *nullRate})
+
+	names, err := configFileNames(tables)
+	if err != nil {
+		return err
+	}
+
+	// check every file first so we don't leave a partial import behind
+	paths := make([]string, len(tables))
+	for i := range tables {
+		paths[i] = filepath.Join(*out, names[i]+".json")
+
+		if _, err := os.Stat(paths[i]); err == nil && !*force {
+			return fmt.Errorf("'%s' already exists; use -force to overwrite it", paths[i])
+		}
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		return err
+	}
+
+	for i, config := range configs {
+		bytes, err := json.MarshalIndent(config, "", "    ")
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(paths[i], append(bytes, '\n'), 0644); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stdout, "Wrote %s (%d fields)\n", paths[i], len(config.Fields))
+	}
+
+	return nil
+}
+
+// configFileNames names each table's configuration after the table without its schema, unless tables in different
+// schemas share that name; names are compared ignoring case, like filesystems that ignore it
+func configFileNames(tables []*ddl.Table) ([]string, error) {
+	shortNames := make(map[string]int)
+	fullNames := make(map[string]bool)
+
+	for _, table := range tables {
+		full := strings.ToLower(table.Name)
+		if fullNames[full] {
+			return nil, fmt.Errorf("Table '%s' is created more than once", table.Name)
+		}
+
+		fullNames[full] = true
+		shortNames[strings.ToLower(table.ShortName())]++
+	}
+
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = table.ShortName()
+		if shortNames[strings.ToLower(names[i])] > 1 {
+			names[i] = table.Name
+		}
+	}
+
+	return names, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/elauffenburger/oar/core"
+	"github.com/elauffenburger/oar/core/importers"
+)
+
+var importSchemaCommand = &command{
+	name:        "import-schema",
+	args:        "[flags] schema.json|schema.yaml",
+	description: "Write a configuration that generates objects valid against a JSON Schema or OpenAPI schema.",
+	run:         runImportSchema,
+}
+
+func runImportSchema(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	name := flags.String("name", "", "name of the schema to use from the document's components or definitions")
+	out := flags.String("out", "", "file to write the configuration to (default: stdout)")
+	rows := flags.Int("rows", 100, "rows to generate")
+	dataDir := flags.String("data", "./data", "directory containing the csv data files")
+	nullRate := flags.Float64("nullrate", 0.1, "nullrate of properties that may be null")
+	check := flags.Int("check", 100, "generate this many rows and check them against the schema before writing the configuration; 0 skips the check")
+	force := flags.Bool("force", false, "overwrite the file if it already exists")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageErrorf("expected the path of one schema document")
+	}
+
+	if *rows < 0 || *check < 0 {
+		return usageErrorf("-rows and -check can't be negative")
+	}
+
+	if *nullRate < 0 || *nullRate > 1 {
+		return usageErrorf("-nullrate must be between 0 and 1")
+	}
+
+	path := flags.Arg(0)
+
+	if len(*out) != 0 {
+		if _, err := os.Stat(*out); err == nil && !*force {
+			return fmt.Errorf("'%s' already exists; use -force to overwrite it", *out)
+		}
+	}
+
+	configDir := "."
+	if len(*out) != 0 {
+		configDir = filepath.Dir(*out)
+	}
+
+	relDataDir, err := relativeDataDir(configDir, *dataDir)
+	if err != nil {
+		return err
+	}
+
+	config, err := configFromSchema(path, *name, importers.JSONSchemaOptions{Rows: *rows, DataDir: relDataDir, NullRate: *nullRate})
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if *check > 0 {
+		if err := checkAgainstSchema(string(content), configDir, path, *name, *check); err != nil {
+			return err
+		}
+	}
+
+	if len(*out) == 0 {
+		_, err := fmt.Fprintln(os.Stdout, string(content))
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Wrote %s (%d fields)\n", *out, len(config.Fields))
+	return nil
+}
+
+// checkAgainstSchema generates rows from the configuration and validates them against the schema they came from
+func checkAgainstSchema(content string, configDir string, path string, name string, rows int) error {
+	config, err := core.LoadConfigurationFromJson(content)
+	if err != nil {
+		return fmt.Errorf("The generated configuration doesn't load: %s", err)
+	}
+
+	if config.Dir, err = filepath.Abs(configDir); err != nil {
+		return err
+	}
+	config.NumRows = rows
+
+	results, err := core.GenerateResults(config)
+	if err != nil {
+		return fmt.Errorf("The generated configuration doesn't generate: %s", err)
+	}
+
+	doc, err := importers.LoadSchemaDocument(path)
+	if err != nil {
+		return err
+	}
+
+	root, err := importers.RootSchema(doc, name)
+	if err != nil {
+		return err
+	}
+
+	problems, err := importers.ValidateRows(doc, root, results.Rows)
+	if err != nil {
+		return err
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for i, problem := range problems {
+		if i == 10 {
+			fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(problems)-i)
+			break
+		}
+
+		fmt.Fprintf(os.Stderr, "  %s\n", problem)
+	}
+
+	return fmt.Errorf("%d problems in %d generated rows don't match the schema; adjust the schema or pass -check 0 to write the configuration anyway", len(problems), rows)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elauffenburger/oar/core/importers"
+	"github.com/elauffenburger/oar/core/profile"
+)
+
+var inferCommand = &command{
+	name:        "infer",
+	args:        "[flags] sample.csv|sample.json",
+	description: "Profile a sample dataset and write a configuration that generates lookalike data.",
+	run:         runInfer,
+}
+
+func runInfer(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	name := flags.String("name", "", "name of the data set (default: the sample's file name)")
+	out := flags.String("out", "", "file to write the configuration to (default: stdout)")
+	format := flags.String("format", "", "format of the sample: csv or json, which also reads ndjson (default: from the file extension)")
+	rows := flags.Int("rows", 0, "rows to generate (default: as many as the sample has)")
+	dataDir := flags.String("data", "./data", "directory containing the csv data files")
+	maxChoices := flags.Int("max-choices", 20, "columns with at most this many distinct values pick from them")
+	force := flags.Bool("force", false, "overwrite the file if it already exists")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageErrorf("expected the path of one sample file, or - for stdin")
+	}
+
+	if *rows < 0 || *maxChoices < 0 {
+		return usageErrorf("-rows and -max-choices can't be negative")
+	}
+
+	path := flags.Arg(0)
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = "csv"
+		case ".json", ".ndjson", ".jsonl":
+			*format = "json"
+		default:
+			return usageErrorf("can't tell the format of '%s'; pass -format csv or -format json", path)
+		}
+	}
+
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if path == "-" {
+			*name = "Sample"
+		}
+	}
+
+	if len(*out) != 0 {
+		if _, err := os.Stat(*out); err == nil && !*force {
+			return fmt.Errorf("'%s' already exists; use -force to overwrite it", *out)
+		}
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		input = bufio.NewReader(file)
+	}
+
+	var p *profile.Profile
+	var err error
+
+	switch *format {
+	case "csv":
+		p, err = profile.ReadCSV(input)
+	case "json":
+		p, err = profile.ReadJSON(input)
+	default:
+		return usageErrorf("unknown format '%s'; expected csv or json", *format)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Failed to read '%s': %s", path, err)
+	}
+
+	if len(p.Columns) == 0 {
+		return fmt.Errorf("No columns found in '%s'", path)
+	}
+
+	configDir := "."
+	if len(*out) != 0 {
+		configDir = filepath.Dir(*out)
+	}
+
+	relDataDir, err := relativeDataDir(configDir, *dataDir)
+	if err != nil {
+		return err
+	}
+
+	config := importers.ConfigurationFromProfile(p, *name, importers.SampleOptions{Rows: *rows, DataDir: relDataDir, MaxChoices: *maxChoices})
+
+	content, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if len(*out) == 0 {
+		_, err := fmt.Fprintln(os.Stdout, string(content))
+		return err
+	}
+
+	if err := ioutil.WriteFile(*out, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Wrote %s (%d fields from %d rows)\n", *out, len(config.Fields), p.Rows)
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+)
+
+var initCommand = &command{
+	name:        "init",
+	args:        "[flags] [path]",
+	description: "Write a starter configuration to path (default: oar.json).",
+	run:         runInit,
+}
+
+func runInit(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	name := flags.String("name", "Users", "name of the data set (and sql table)")
+	dataDir := flags.String("data", "./data", "directory containing the csv data files")
+	force := flags.Bool("force", false, "overwrite the file if it already exists")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() > 1 {
+		return usageErrorf("expected at most one path, got %d", flags.NArg())
+	}
+
+	path := "oar.json"
+	if flags.NArg() == 1 {
+		path = flags.Arg(0)
+	}
+
+	if _, err := os.Stat(path); err == nil && !*force {
+		return fmt.Errorf("'%s' already exists; use -force to overwrite it", path)
+	}
+
+	relDataDir, err := relativeDataDir(filepath.Dir(path), *dataDir)
+	if err != nil {
+		return err
+	}
+
+	dataPath := func(file string) string {
+		return relDataDir + "/" + file
+	}
+
+	csvType := func(file string) conf.UseTypeDTO {
+		return conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "csvloader", Args: map[string]interface{}{"src": dataPath(file), "separator": "\n"}}}
+	}
+
+	config := &conf.Configuration{
+		Name:       *name,
+		OutputType: conf.JSON,
+		NumRows:    10,
+		Options:    conf.Options{},
+		Fields: conf.ConfigurationFields{
+			{Name: "Id", Type: "id"},
+			{Name: "FirstName", Type: "firstname"},
+			{Name: "LastName", Type: "lastname"},
+			{Name: "Email", Type: "email"},
+			{Name: "City", Type: "city"},
+			{Name: "State", Type: "state"},
+		},
+		Types: map[string]conf.UseTypeDTO{
+			"id":        {LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "autoincrement"}},
+			"firstname": csvType("firstnames.csv"),
+			"lastname":  csvType("lastnames.csv"),
+			"city":      csvType("cities.csv"),
+			"state":     csvType("states.csv"),
+			"email": {LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "strformat", Args: map[string]interface{}{
+				"format": "%s.%s@mailinator.com",
+				"args":   []string{"FirstName", "LastName"},
+			}}},
+		},
+	}
+
+	bytes, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, append(bytes, '\n'), 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Wrote %s; try 'oar preview %s'\n", path, path)
+	return nil
+}
+
+// relativeDataDir returns dataDir relative to configDir, since csv paths in a config are relative to the config file
+func relativeDataDir(configDir string, dataDir string) (string, error) {
+	absConfigDir, err := filepath.Abs(configDir)
+	if err != nil {
+		return "", err
+	}
+
+	absDataDir, err := filepath.Abs(dataDir)
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(absConfigDir, absDataDir); err == nil {
+		return filepath.ToSlash(rel), nil
+	}
+
+	return filepath.ToSlash(absDataDir), nil
+}
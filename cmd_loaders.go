@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/elauffenburger/oar/core"
+)
+
+var loadersCommand = &command{
+	name:        "loaders",
+	args:        "[flags]",
+	description: "List the registered loaders and the args they accept.",
+	run:         runLoaders,
+}
+
+func runLoaders(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	ctx := core.NewTypeLoaderFactoryContext()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	for i, loadername := range ctx.LoaderNames() {
+		if i != 0 {
+			fmt.Fprintln(writer)
+		}
+
+		fmt.Fprintln(writer, loadername)
+
+		argsSchema := ctx.ArgsSchema(loadername)
+		if argsSchema == nil {
+			fmt.Fprintln(writer, "  (args not described)")
+			continue
+		}
+
+		if len(argsSchema.Properties) == 0 {
+			fmt.Fprintln(writer, "  (no args)")
+			continue
+		}
+
+		required := make(map[string]bool)
+		for _, arg := range argsSchema.Required {
+			required[arg] = true
+		}
+
+		argNames := make([]string, 0, len(argsSchema.Properties))
+		for arg := range argsSchema.Properties {
+			argNames = append(argNames, arg)
+		}
+		sort.Strings(argNames)
+
+		for _, arg := range argNames {
+			prop := argsSchema.Properties[arg]
+
+			detail := "optional"
+			if required[arg] {
+				detail = "required"
+			} else if prop.Default != nil {
+				def, _ := json.Marshal(prop.Default)
+				detail = fmt.Sprintf("default %s", def)
+			}
+
+			fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\n", arg, strings.Join(prop.Type, "|"), detail, prop.Description)
+		}
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elauffenburger/oar/core"
+	"github.com/elauffenburger/oar/core/input"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+var maskCommand = &command{
+	name:        "mask",
+	args:        "[flags] -config mask.json export.csv|export.ndjson",
+	description: "Replace the configured columns of existing data with generated values, consistently across files.",
+	run:         runMask,
+}
+
+func runMask(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	configPath := flags.String("config", "", "configuration whose fields name the columns to replace and the types to replace them with")
+	key := flags.String("key", os.Getenv("OAR_MASK_KEY"), "secret that decides which fake value each real value becomes; use the same key for every file whose joins should survive (default: $OAR_MASK_KEY)")
+	format := flags.String("format", "", "format of the input and output: csv or json, which also reads ndjson and writes ndjson (default: from the file extension)")
+	out := flags.String("out", "", "file to write the masked data to (default: stdout)")
+	force := flags.Bool("force", false, "overwrite the output file if it already exists")
+	mappingPath := flags.String("mapping", "", "json file keeping the fake value each real value of a unique field got, read before masking and updated after, so every file masked with it gets the same fakes; it holds keyed hashes rather than real values. Without one, two values of a unique field drawing the same fake is an error")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 {
+		return usageErrorf("expected the path of one file to mask, or - for stdin")
+	}
+
+	if len(*configPath) == 0 {
+		return usageErrorf("-config is required")
+	}
+
+	if len(*key) == 0 {
+		return usageErrorf("-key or $OAR_MASK_KEY is required")
+	}
+
+	path := flags.Arg(0)
+
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = "csv"
+		case ".json", ".ndjson", ".jsonl":
+			*format = "json"
+		default:
+			return usageErrorf("can't tell the format of '%s'; pass -format csv or -format json", path)
+		}
+	}
+
+	read := input.ReadCSV
+	switch *format {
+	case "csv":
+	case "json":
+		read = input.ReadJSON
+	default:
+		return usageErrorf("unknown format '%s'; expected csv or json", *format)
+	}
+
+	if len(*out) != 0 {
+		if _, err := os.Stat(*out); err == nil && !*force {
+			return fmt.Errorf("'%s' already exists; use -force to overwrite it", *out)
+		}
+	}
+
+	config, err := core.LoadConfigurationFromFile(*configPath)
+	if err != nil {
+		return fmt.Errorf("Error loading configuration file: %s", err)
+	}
+
+	masker, err := core.NewMasker(config, []byte(*key))
+	if err != nil {
+		return err
+	}
+	defer masker.Close()
+
+	var mapping core.MaskMapping
+	if len(*mappingPath) != 0 {
+		if mapping, err = readMaskMapping(*mappingPath); err != nil {
+			return err
+		}
+
+		if err := masker.UseMapping(mapping); err != nil {
+			return fmt.Errorf("Failed to use mapping '%s': %s", *mappingPath, err)
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		in = file
+	}
+
+	var stream io.Writer = os.Stdout
+	if len(*out) != 0 {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		stream = file
+	}
+
+	writer := bufio.NewWriter(stream)
+
+	var encode func(names []string, row *res.ResultsRow) error
+	if *format == "csv" {
+		encode = csvRowEncoder(csv.NewWriter(writer))
+	} else {
+		encode = ndjsonRowEncoder(writer)
+	}
+
+	index := 0
+	err = read(in, func(names []string, values []interface{}) error {
+		// a column that's missing from the first row is most likely a typo, which would leave real data unmasked
+		if index == 0 {
+			if err := checkMaskedColumns(masker.Fields(), names); err != nil {
+				return err
+			}
+		}
+
+		row := core.NewResultsRowFromValues(index, names, values)
+		if err := masker.MaskRow(row); err != nil {
+			return err
+		}
+
+		index++
+		return encode(names, row)
+	})
+
+	if err != nil {
+		return fmt.Errorf("Failed to mask '%s': %s", path, err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if mapping != nil {
+		return writeMaskMapping(*mappingPath, mapping)
+	}
+
+	return nil
+}
+
+// readMaskMapping reads the mapping at path, or returns an empty one if there isn't one yet
+func readMaskMapping(path string) (core.MaskMapping, error) {
+	mapping := make(core.MaskMapping)
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return mapping, nil
+	}
+
+	if err == nil {
+		err = json.Unmarshal(content, &mapping)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read mapping '%s': %s", path, err)
+	}
+
+	return mapping, nil
+}
+
+// writeMaskMapping writes mapping next to path and renames it over it, so an interrupted write doesn't lose the fakes
+// earlier runs gave out
+func writeMaskMapping(path string, mapping core.MaskMapping) error {
+	content, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp := path + ".tmp"
+	if err := ioutil.WriteFile(temp, append(content, '\n'), 0600); err != nil {
+		return fmt.Errorf("Failed to write mapping '%s': %s", path, err)
+	}
+
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("Failed to write mapping '%s': %s", path, err)
+	}
+
+	return nil
+}
+
+func checkMaskedColumns(fields []string, names []string) error {
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+
+	for _, field := range fields {
+		if !columns[field] {
+			return fmt.Errorf("Field '%s' isn't a column of the input; it has: %s", field, strings.Join(names, ", "))
+		}
+	}
+
+	return nil
+}
+
+// csvRowEncoder writes rows with the input's header, and nulls as empty values
+func csvRowEncoder(writer *csv.Writer) func(names []string, row *res.ResultsRow) error {
+	header := false
+
+	return func(names []string, row *res.ResultsRow) error {
+		if !header {
+			if err := writer.Write(names); err != nil {
+				return err
+			}
+
+			header = true
+		}
+
+		record := make([]string, len(row.Values))
+		for i, value := range row.Values {
+			record[i] = value.Value
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+
+		writer.Flush()
+		return writer.Error()
+	}
+}
+
+// ndjsonRowEncoder writes rows as json objects, one per line, with their keys in the input's order
+func ndjsonRowEncoder(writer io.Writer) func(names []string, row *res.ResultsRow) error {
+	return func(names []string, row *res.ResultsRow) error {
+		var builder strings.Builder
+		builder.WriteByte('{')
+
+		for i, value := range row.Values {
+			name, err := json.Marshal(value.Name)
+			if err != nil {
+				return err
+			}
+
+			content, err := json.Marshal(value.JSONValue())
+			if err != nil {
+				return fmt.Errorf("Failed to encode '%s' in row %d: %s", value.Name, row.Index, err)
+			}
+
+			if i != 0 {
+				builder.WriteByte(',')
+			}
+
+			builder.Write(name)
+			builder.WriteByte(':')
+			builder.Write(content)
+		}
+
+		builder.WriteString("}\n")
+
+		_, err := io.WriteString(writer, builder.String())
+		return err
+	}
+}
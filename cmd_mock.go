@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/mock"
+)
+
+var mockCommand = &command{
+	name:        "mock",
+	args:        "[flags] -config dir|config.json",
+	description: "Serve a REST API over a dataset generated from each configuration, with paging, filtering, sorting and changes kept in memory.",
+	run:         runMock,
+}
+
+func runMock(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	configPath := flags.String("config", "", "configuration to serve, or a directory whose .json configurations are all served (or pass them as arguments)")
+	addr := flags.String("addr", "localhost:3000", "address to listen on")
+	rows := flags.Int("rows", 0, "rows to generate for each configuration (default: each configuration's rows)")
+	seed := flags.String("seed", "", "seed for every configuration, so restarts serve the same data (default: each configuration's seed option)")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(*configPath) != 0 {
+		paths = append([]string{*configPath}, paths...)
+	}
+
+	if len(paths) == 0 {
+		return usageErrorf("no configuration file or directory provided")
+	}
+
+	if *rows < 0 {
+		return usageErrorf("-rows can't be negative")
+	}
+
+	if _, err := strconv.ParseInt(*seed, 10, 64); len(*seed) != 0 && err != nil {
+		return usageErrorf("-seed must be an integer")
+	}
+
+	configs, err := loadConfigsForServing(paths)
+	if err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		if *rows != 0 {
+			config.NumRows = *rows
+		}
+
+		if len(*seed) != 0 {
+			config.Options[conf.SeedOption] = *seed
+		}
+	}
+
+	srv, err := mock.New(configs)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range srv.Names() {
+		fmt.Fprintf(os.Stderr, "Serving http://%s/%s\n", *addr, name)
+	}
+
+	return http.ListenAndServe(*addr, srv)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/elauffenburger/oar/core"
+)
+
+var previewCommand = &command{
+	name:        "preview",
+	args:        "[flags] [config.json]",
+	description: "Generate the first few rows of a configuration and print them as a table.",
+	run:         runPreview,
+}
+
+const maxPreviewValueLength = 40
+
+func runPreview(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	cf := addConfigFlags(flags)
+	n := flags.Int("n", 10, "number of rows to preview")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	if *n < 1 {
+		return usageErrorf("-n must be at least 1")
+	}
+
+	config, err := cf.load()
+	if err != nil {
+		return err
+	}
+
+	config.NumRows = *n
+
+	results, err := core.GenerateResults(config)
+	if err != nil {
+		return fmt.Errorf("Error generating results: %s", err)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	headers := make([]string, len(config.Fields))
+	for i, field := range config.Fields {
+		headers[i] = field.Name
+	}
+	fmt.Fprintln(writer, strings.Join(headers, "\t"))
+
+	for _, row := range results.Rows {
+		cells := make([]string, len(config.Fields))
+
+		for i, field := range config.Fields {
+			entry, err := row.Values.GetEntryWithName(field.Name)
+
+			switch {
+			case err != nil:
+				cells[i] = ""
+			case entry.Null:
+				cells[i] = "NULL"
+			default:
+				cells[i] = previewValue(entry.Value)
+			}
+		}
+
+		fmt.Fprintln(writer, strings.Join(cells, "\t"))
+	}
+
+	return writer.Flush()
+}
+
+func previewValue(value string) string {
+	value = strings.NewReplacer("\r", "", "\n", "\\n", "\t", " ").Replace(value)
+
+	if len([]rune(value)) > maxPreviewValueLength {
+		value = string([]rune(value)[:maxPreviewValueLength-3]) + "..."
+	}
+
+	return value
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/elauffenburger/oar/core"
+)
+
+var schemaCommand = &command{
+	name:        "schema",
+	args:        "[flags]",
+	description: "Print the JSON Schema for configuration files, including every loader's args.",
+	run:         runSchema,
+}
+
+func runSchema(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	bytes, err := json.MarshalIndent(core.GetConfigurationSchema(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error generating schema: %s", err)
+	}
+
+	_, err = fmt.Fprintln(os.Stdout, string(bytes))
+	return err
+}
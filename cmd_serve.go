@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/server"
+)
+
+var serveCommand = &command{
+	name:        "serve",
+	args:        "[flags] -config dir|config.json",
+	description: "Serve generated rows over HTTP, with an endpoint for each configuration (GET /users?rows=20&seed=7&format=ndjson).",
+	run:         runServe,
+}
+
+func runServe(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	configPath := flags.String("config", "", "configuration to serve, or a directory whose .json configurations are all served (or pass them as arguments)")
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	maxRows := flags.Int("max-rows", 10000, "most rows a request can ask for; 0 is no limit")
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	paths := flags.Args()
+	if len(*configPath) != 0 {
+		paths = append([]string{*configPath}, paths...)
+	}
+
+	if len(paths) == 0 {
+		return usageErrorf("no configuration file or directory provided")
+	}
+
+	if *maxRows < 0 {
+		return usageErrorf("-max-rows can't be negative")
+	}
+
+	configs, err := loadConfigsForServing(paths)
+	if err != nil {
+		return err
+	}
+
+	srv, err := server.New(configs, server.Options{MaxRows: *maxRows})
+	if err != nil {
+		return err
+	}
+	defer srv.Close()
+
+	for _, name := range srv.Names() {
+		fmt.Fprintf(os.Stderr, "Serving http://%s/%s\n", *addr, name)
+	}
+
+	return http.ListenAndServe(*addr, srv)
+}
+
+// loadConfigsForServing loads the configurations in paths, and the .json files in any directories among them, keyed
+// by their file names without the extension
+func loadConfigsForServing(paths []string) (map[string]*conf.Configuration, error) {
+	files := make([]string, 0)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No configurations found in %s", strings.Join(paths, ", "))
+	}
+
+	configs := make(map[string]*conf.Configuration, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if _, ok := configs[name]; ok {
+			return nil, fmt.Errorf("More than one configuration is named '%s'", name)
+		}
+
+		config, err := core.LoadConfigurationFromFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading configuration file '%s': %s", file, err)
+		}
+
+		configs[name] = config
+	}
+
+	return configs, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var typesCommand = &command{
+	name:        "types",
+	args:        "[flags] [config.json]",
+	description: "List the types in a configuration with their loaders and resolved args.",
+	run:         runTypes,
+}
+
+func runTypes(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	cf := addConfigFlags(flags)
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	config, err := cf.load()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(config.Types))
+	for typename := range config.Types {
+		names = append(names, typename)
+	}
+	sort.Strings(names)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TYPE\tLOADER\tEXTENDS\tUSED BY\tARGS")
+
+	for _, typename := range names {
+		usedBy := make([]string, 0)
+		for _, field := range config.Fields {
+			if field.Type == typename {
+				usedBy = append(usedBy, field.Name)
+			}
+		}
+
+		t, err := config.ResolveType(typename)
+		if err != nil {
+			return err
+		}
+
+		argsJson, err := json.Marshal(t.LoaderArgs.Args)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", typename, t.LoaderArgs.Name, orDash(config.Types[typename].Extends), orDash(strings.Join(usedBy, ",")), argsJson)
+	}
+
+	return writer.Flush()
+}
+
+func orDash(str string) string {
+	if len(str) == 0 {
+		return "-"
+	}
+
+	return str
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/elauffenburger/oar/core"
+)
+
+var validateCommand = &command{
+	name:        "validate",
+	args:        "[flags] [config.json]",
+	description: "Check that a configuration loads and that all of its types and loader args are valid.",
+	run:         runValidate,
+}
+
+func runValidate(cmd *command, args []string) error {
+	flags := newFlagSet(cmd)
+	cf := addConfigFlags(flags)
+
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	config, err := cf.load()
+	if err != nil {
+		return err
+	}
+
+	for _, field := range config.Fields {
+		if _, ok := config.Types[field.Type]; !ok {
+			return fmt.Errorf("Field '%s' uses unknown type '%s'", field.Name, field.Type)
+		}
+	}
+
+	loaders, err := core.BuildTypeLoadersForConfig(config, core.NewTypeLoaderFactoryContext())
+	if err != nil {
+		return err
+	}
+
+	if err := core.CloseTypeLoaders(loaders); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "ok: %d fields using %d loaders\n", len(config.Fields), len(loaders))
+	return nil
+}
@@ -0,0 +1,387 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/loaders"
+)
+
+// outputs, so configurations can be built without importing the configuration package
+const (
+	JSON   = conf.JSON
+	SQL    = conf.SQL
+	NDJSON = conf.NDJSON
+)
+
+// ConfigBuilder builds a configuration in code:
+//
+//	config, err := core.NewConfig("users").
+//		Rows(100).
+//		Seed(42).
+//		Field("id", core.AutoIncrement()).
+//		Field("email", core.Email(), core.Unique()).
+//		Field("age", core.Number(18, 90), core.NullRate(0.1)).
+//		Output(core.SQL).
+//		Build()
+//
+// Mistakes are reported by Build, so calls can be chained without checking each one.
+type ConfigBuilder struct {
+	config  *conf.Configuration
+	dataDir string
+	errs    []string
+
+	// the data/ file each type picks from, for those that pick from one
+	dataFiles map[string]string
+}
+
+// NewConfig starts a configuration with the given name and json output
+func NewConfig(name string) *ConfigBuilder {
+	config := conf.NewConfiguration()
+	config.Name = name
+	config.OutputType = conf.JSON
+	config.Types = make(map[string]conf.UseTypeDTO)
+
+	return &ConfigBuilder{config: config, dataDir: "data", dataFiles: make(map[string]string)}
+}
+
+func (b *ConfigBuilder) Rows(n int) *ConfigBuilder {
+	b.config.NumRows = n
+	return b
+}
+
+func (b *ConfigBuilder) Output(output conf.OutputType) *ConfigBuilder {
+	b.config.OutputType = output
+	return b
+}
+
+// Option sets an engine option, like those in a configuration's options block
+func (b *ConfigBuilder) Option(name string, value interface{}) *ConfigBuilder {
+	b.config.Options[name] = fmt.Sprint(value)
+	return b
+}
+
+func (b *ConfigBuilder) Seed(seed int64) *ConfigBuilder {
+	return b.Option(conf.SeedOption, seed)
+}
+
+// Dir sets the directory relative paths in loader args are resolved against (default: the working directory)
+func (b *ConfigBuilder) Dir(dir string) *ConfigBuilder {
+	b.config.Dir = dir
+	return b
+}
+
+// DataDir sets the directory of the data/ files types like FirstName and City pick from (default: data). A relative
+// directory is relative to Dir, and Build makes it absolute so the configuration still finds the files once it's saved
+// somewhere else.
+func (b *ConfigBuilder) DataDir(dir string) *ConfigBuilder {
+	b.dataDir = dir
+	return b
+}
+
+// Type adds a type under the given name, for Ref or other types' args to name
+func (b *ConfigBuilder) Type(name string, t Type) *ConfigBuilder {
+	dto := t.UseType(b.dataDir)
+	if existing, ok := b.config.Types[name]; ok && !reflect.DeepEqual(existing, dto) {
+		b.errs = append(b.errs, fmt.Sprintf("Type '%s' is added twice", name))
+		return b
+	}
+
+	b.config.Types[name] = dto
+	b.addDataFile(name, t)
+
+	return b
+}
+
+// Field adds a field of the given type; the type is added to the configuration under its name, or if that's taken by
+// a different type, the field's
+func (b *ConfigBuilder) Field(name string, t Type, options ...FieldOption) *ConfigBuilder {
+	for _, field := range b.config.Fields {
+		if field.Name == name {
+			b.errs = append(b.errs, fmt.Sprintf("Field '%s' is added twice", name))
+			return b
+		}
+	}
+
+	field := &conf.ConfigurationField{Name: name, Type: t.ref}
+	if t.ref == "" {
+		field.Type = b.addType(name, t)
+	}
+
+	for _, option := range options {
+		option(field)
+	}
+
+	b.config.Fields = append(b.config.Fields, field)
+	return b
+}
+
+func (b *ConfigBuilder) addType(fieldName string, t Type) string {
+	dto := t.UseType(b.dataDir)
+	lower := strings.ToLower(fieldName)
+
+	// the type's own name, then the field's, then the field's numbered
+	for i := 0; ; i++ {
+		name := t.name
+		switch {
+		case i == 1:
+			name = lower
+		case i > 1:
+			name = fmt.Sprintf("%s%d", lower, i)
+		}
+
+		existing, ok := b.config.Types[name]
+		if !ok {
+			b.config.Types[name] = dto
+			b.addDataFile(name, t)
+
+			return name
+		}
+
+		if reflect.DeepEqual(existing, dto) {
+			return name
+		}
+	}
+}
+
+func (b *ConfigBuilder) addDataFile(name string, t Type) {
+	if t.dataFile != "" {
+		b.dataFiles[name] = t.dataFile
+	}
+}
+
+// resolveDataFiles makes the paths of data/ files absolute, so the configuration finds them wherever it's saved
+func (b *ConfigBuilder) resolveDataFiles() {
+	dir := b.config.ResolvePath(b.dataDir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	for name, file := range b.dataFiles {
+		dto := b.config.Types[name]
+		dto.LoaderArgs.Args = conf.MergeArgs(dto.LoaderArgs.Args, map[string]interface{}{"src": filepath.Join(dir, file)})
+
+		b.config.Types[name] = dto
+	}
+}
+
+// Build returns the configuration once it's been validated like a configuration file, including loading each of its
+// types' loaders
+func (b *ConfigBuilder) Build() (*conf.Configuration, error) {
+	return b.BuildWithTypeLoaderContext(NewTypeLoaderFactoryContext())
+}
+
+func (b *ConfigBuilder) BuildWithTypeLoaderContext(loaderFactoryContext *loaders.TypeLoaderFactoryContext) (*conf.Configuration, error) {
+	if len(b.errs) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(b.errs, "; "))
+	}
+
+	b.resolveDataFiles()
+
+	if err := applyOptions(b.config); err != nil {
+		return nil, err
+	}
+
+	if err := validateConfiguration(b.config); err != nil {
+		return nil, err
+	}
+
+	for _, field := range b.config.Fields {
+		if _, ok := b.config.Types[field.Type]; !ok {
+			return nil, fmt.Errorf("Field '%s' uses unknown type '%s'", field.Name, field.Type)
+		}
+	}
+
+	// loaded to check their args, then released
+	types, err := BuildTypeLoadersForConfig(b.config, loaderFactoryContext)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CloseTypeLoaders(types); err != nil {
+		return nil, err
+	}
+
+	return b.config, nil
+}
+
+type FieldOption func(field *conf.ConfigurationField)
+
+// Unique makes sure no two rows get the same non-null value for the field
+func Unique() FieldOption {
+	return func(field *conf.ConfigurationField) {
+		field.Unique = true
+	}
+}
+
+// NullRate sets the probability (0 to 1) that the field is null in a row
+func NullRate(rate float64) FieldOption {
+	return func(field *conf.ConfigurationField) {
+		field.NullRate = rate
+	}
+}
+
+// Kind sets how the field's values are written in json output
+func Kind(kind conf.FieldKind) FieldOption {
+	return func(field *conf.ConfigurationField) {
+		field.Kind = kind
+	}
+}
+
+// Args overrides the args of the field's type for this field alone
+func Args(args map[string]interface{}) FieldOption {
+	return func(field *conf.ConfigurationField) {
+		field.Args = conf.MergeArgs(field.Args, args)
+	}
+}
+
+// Type is a loader and its args, for the fields of configurations built with NewConfig
+type Type struct {
+	// name the type is added to the configuration under
+	name string
+	dto  conf.UseTypeDTO
+
+	// name of a type added with ConfigBuilder.Type, for Ref
+	ref string
+
+	// data/ file to pick values from, relative to the builder's data directory
+	dataFile string
+}
+
+// Loader returns a type for any registered loader, named after the loader
+func Loader(name string, args map[string]interface{}) Type {
+	return Type{name: name, dto: conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: name, Args: args}}}
+}
+
+// Ref returns the type added to the configuration under the given name
+func Ref(name string) Type {
+	return Type{ref: name}
+}
+
+// Named returns a copy of the type that's added to configurations under the given name
+func (t Type) Named(name string) Type {
+	t.name = name
+	return t
+}
+
+// With returns a copy of the type with an arg set
+func (t Type) With(arg string, value interface{}) Type {
+	t.dto.LoaderArgs.Args = conf.MergeArgs(t.dto.LoaderArgs.Args, map[string]interface{}{arg: value})
+	return t
+}
+
+// Extends returns a copy of the type that extends the type added under the given name
+func (t Type) Extends(name string) Type {
+	t.dto.Extends = name
+	return t
+}
+
+func AutoIncrement() Type {
+	return Loader("autoincrement", nil).Named("id")
+}
+
+func UUID() Type {
+	return Loader("uuid", nil)
+}
+
+// Number returns whole numbers from min to max
+func Number(min int64, max int64) Type {
+	return Loader("number", map[string]interface{}{"min": min, "max": max})
+}
+
+// Decimal returns numbers from min to max with the given digits after the decimal point
+func Decimal(min int64, max int64, decimals int) Type {
+	return Loader("number", map[string]interface{}{"min": min, "max": max, "decimals": decimals})
+}
+
+// Text returns letters of a length from minLength to maxLength
+func Text(minLength int, maxLength int) Type {
+	return Loader("text", map[string]interface{}{"minlength": minLength, "maxlength": maxLength})
+}
+
+func Choice(values ...interface{}) Type {
+	return Loader("choice", map[string]interface{}{"values": values})
+}
+
+// DateTime returns times from min to max (like "2000-01-01"), written in a format like datetime's
+func DateTime(min string, max string, format string) Type {
+	return Loader("datetime", map[string]interface{}{"min": min, "max": max, "format": format})
+}
+
+func Regex(pattern string) Type {
+	return Loader("regex", map[string]interface{}{"pattern": pattern})
+}
+
+// StrFormat fills in format's verbs with the values of the named fields, which must be added before it
+func StrFormat(format string, fields ...string) Type {
+	return Loader("strformat", map[string]interface{}{"format": format, "args": fields})
+}
+
+func Email() Type {
+	return Loader("text", map[string]interface{}{"charset": "lower", "minlength": 4, "maxlength": 12, "suffix": "@example.com"}).Named("email")
+}
+
+func Phone() Type {
+	return Loader("text", map[string]interface{}{"charset": "numeric", "minlength": 10, "maxlength": 10}).Named("phone")
+}
+
+func dataFileType(name string, file string) Type {
+	t := Loader("csvloader", nil).Named(name)
+	t.dataFile = file
+
+	return t
+}
+
+func FirstName() Type {
+	return dataFileType("firstname", "firstnames.csv")
+}
+
+func LastName() Type {
+	return dataFileType("lastname", "lastnames.csv")
+}
+
+func City() Type {
+	return dataFileType("city", "cities.csv")
+}
+
+func State() Type {
+	return dataFileType("state", "states.csv")
+}
+
+func ZipCode() Type {
+	return dataFileType("zipcode", "zipcodes.csv")
+}
+
+func Company() Type {
+	return dataFileType("company", "companies.csv")
+}
+
+func Address() Type {
+	return dataFileType("address", "addresses.csv")
+}
+
+// BuiltinTypes returns the types with well-known names, like Email and City, by the names they're added under
+func BuiltinTypes() map[string]Type {
+	types := make(map[string]Type)
+	for _, t := range []Type{Email(), Phone(), FirstName(), LastName(), City(), State(), ZipCode(), Company(), Address()} {
+		types[t.name] = t
+	}
+
+	return types
+}
+
+// UseType returns the type as it's written in configurations, with data/ files in the given directory
+func (t Type) UseType(dataDir string) conf.UseTypeDTO {
+	if t.dataFile == "" {
+		return t.dto
+	}
+
+	dto := t.dto
+	dto.LoaderArgs.Args = conf.MergeArgs(dto.LoaderArgs.Args, map[string]interface{}{"src": path.Join(dataDir, t.dataFile)})
+
+	return dto
+}
@@ -1,8 +1,11 @@
 package common
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -29,3 +32,73 @@ func ReadContentFromFileAndSplit(path string, sep string) ([]string, error) {
 
 	return strings.Split(*content, sep), nil
 }
+
+// ParseByteSize parses sizes like "512", "64k", "100MB" or "1GiB" into a number of bytes
+func ParseByteSize(str string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30}, {"tib", 1 << 40},
+		{"kb", 1000}, {"mb", 1000 * 1000}, {"gb", 1000 * 1000 * 1000}, {"tb", 1000 * 1000 * 1000 * 1000},
+		{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+		{"b", 1},
+	}
+
+	lower := strings.ToLower(strings.TrimSpace(str))
+	multiplier := int64(1)
+
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSpace(strings.TrimSuffix(lower, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(lower, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size '%s'", str)
+	}
+
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatByteSize formats a number of bytes like "512 B", "64.0 KiB" or "1.5 GiB"
+func FormatByteSize(n int64) string {
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	size := float64(n)
+	for _, unit := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		size /= 1024
+		if size < 1024 || unit == "TiB" {
+			return fmt.Sprintf("%.1f %s", size, unit)
+		}
+	}
+
+	return ""
+}
+
+// ResolvePath expands environment variables and a leading '~' in path and, if the result
+// is still relative, resolves it against baseDir (or the working directory if baseDir is empty)
+func ResolvePath(baseDir string, path string) string {
+	path = os.ExpandEnv(path)
+
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+
+	if !filepath.IsAbs(path) && len(baseDir) != 0 {
+		path = filepath.Join(baseDir, path)
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	return path
+}
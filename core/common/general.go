@@ -2,11 +2,18 @@ package common
 
 import (
 	"math/rand"
-	"time"
 )
 
-var src = rand.New(rand.NewSource(time.Now().UnixNano()))
+func GetRandomValue(rnd *rand.Rand, list *[]string) string {
+	return (*list)[rnd.Intn(len(*list))]
+}
+
+// RowSeed derives an independent seed for the row at index from a run's seed
+func RowSeed(seed int64, index int) int64 {
+	// splitmix64 so neighbouring seeds and rows don't produce overlapping sequences
+	z := uint64(seed) + uint64(index+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
 
-func GetRandomValue(list *[]string) string {
-	return (*list)[rand.Intn(len(*list))]
+	return int64(z ^ (z >> 31))
 }
@@ -1,30 +1,69 @@
 package configuration
 
+import (
+	"encoding/json"
+
+	"github.com/elauffenburger/oar/core/common"
+)
+
 type UseTypeDTO struct {
+	// name of another type to inherit the loader and args of; args set on this type override the inherited ones
+	Extends string `json:"extends,omitempty"`
+
 	LoaderArgs UseTypeLoaderArgsDTO `json:"loader"`
 }
 
 type UseTypeLoaderArgsDTO struct {
 	Name string                 `json:"name"`
-	Args map[string]interface{} `json:"args"`
+	Args map[string]interface{} `json:"args,omitempty"`
 }
 
 type Configuration struct {
 	OutputType OutputType            `json:"output"`
-	Name       string                `json:"name`
+	Name       string                `json:"name"`
 	NumRows    int                   `json:"rows"`
 	Fields     ConfigurationFields   `json:"fields"`
-	Options    map[string]string     `json:"options"`
+	Options    Options               `json:"options"`
 	Types      map[string]UseTypeDTO `json:"types"`
+
+	// directory the configuration was loaded from; relative paths in loader args are resolved against it
+	Dir string `json:"-"`
 }
 
 type OutputType string
 
 const (
-	JSON OutputType = "json"
-	SQL  OutputType = "sql"
+	JSON   OutputType = "json"
+	SQL    OutputType = "sql"
+	NDJSON OutputType = "ndjson"
 )
 
 func NewConfiguration() *Configuration {
-	return &Configuration{Options: make(map[string]string), Fields: NewConfigurationFields()}
+	return &Configuration{Options: make(Options), Fields: NewConfigurationFields()}
+}
+
+// MarshalJSON writes the configuration as it's written in files, so configurations built in code can be saved and
+// loaded again
+func (config Configuration) MarshalJSON() ([]byte, error) {
+	// a type without the method, so it can be encoded as usual
+	type configuration Configuration
+	c := configuration(config)
+
+	if c.Fields == nil {
+		c.Fields = NewConfigurationFields()
+	}
+
+	if c.Options == nil {
+		c.Options = make(Options)
+	}
+
+	if c.Types == nil {
+		c.Types = make(map[string]UseTypeDTO)
+	}
+
+	return json.Marshal(c)
+}
+
+func (config *Configuration) ResolvePath(path string) string {
+	return common.ResolvePath(config.Dir, path)
 }
@@ -3,6 +3,43 @@ package configuration
 type ConfigurationField struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
+
+	// args passed to the field's type that override the type's own loader args
+	Args map[string]interface{} `json:"args,omitempty"`
+
+	// no two rows get the same non-null value for this field
+	Unique bool `json:"unique,omitempty"`
+
+	// probability (0 to 1) that the field is null in a row
+	NullRate float64 `json:"nullrate,omitempty"`
+
+	// how the value is written in json output
+	Kind FieldKind `json:"kind,omitempty"`
+}
+
+type FieldKind string
+
+const (
+	StringKind  FieldKind = "string"
+	IntegerKind FieldKind = "integer"
+	NumberKind  FieldKind = "number"
+	BooleanKind FieldKind = "boolean"
+
+	// values that are json themselves, like nested objects and arrays
+	JSONKind FieldKind = "json"
+)
+
+// FieldKinds lists the valid kinds; a field without a kind is a string
+var FieldKinds = []FieldKind{StringKind, IntegerKind, NumberKind, BooleanKind, JSONKind}
+
+// LoaderKey returns the key of the loader that generates values for this field; fields that pass
+// their own args get a loader of their own
+func (field *ConfigurationField) LoaderKey() string {
+	if len(field.Args) == 0 {
+		return field.Type
+	}
+
+	return field.Type + "#" + field.Name
 }
 
 type ConfigurationFields []*ConfigurationField
@@ -0,0 +1,270 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options are engine settings read from the "options" block of a configuration:
+//
+//	seed      - seeds random generation so the same config produces the same rows (default: random)
+//	workers   - number of goroutines generating rows (default: number of CPUs)
+//	nulls     - how null values are written: "null" for json null / sql NULL, or "empty" for an empty string (default: null)
+//	batchsize - number of rows per sql insert statement (default: 1000)
+//	pretty    - indent json output (default: false)
+//	partial   - what's done with output when generation is stopped early: "flush" it, finished so it's valid, or
+//	            "discard" it (default: flush)
+type Options map[string]string
+
+const (
+	SeedOption      = "seed"
+	WorkersOption   = "workers"
+	NullsOption     = "nulls"
+	BatchSizeOption = "batchsize"
+	PrettyOption    = "pretty"
+	PartialOption   = "partial"
+)
+
+type NullHandling string
+
+const (
+	NullsAsNull  NullHandling = "null"
+	NullsAsEmpty NullHandling = "empty"
+)
+
+type PartialOutput string
+
+const (
+	FlushPartialOutput   PartialOutput = "flush"
+	DiscardPartialOutput PartialOutput = "discard"
+)
+
+const DefaultBatchSize = 1000
+
+type optionDefinition struct {
+	description string
+	validate    func(value string) error
+}
+
+var optionDefinitions = map[string]optionDefinition{
+	SeedOption:      {"seeds random generation", validateInt(false)},
+	WorkersOption:   {"number of goroutines generating rows", validateInt(true)},
+	NullsOption:     {"how null values are written ('null' or 'empty')", validateOneOf(string(NullsAsNull), string(NullsAsEmpty))},
+	BatchSizeOption: {"number of rows per sql insert statement", validateInt(true)},
+	PrettyOption:    {"indent json output", validateBool},
+	PartialOption:   {"what's done with output when generation is stopped early ('flush' or 'discard')", validateOneOf(string(FlushPartialOutput), string(DiscardPartialOutput))},
+}
+
+func validateInt(positive bool) func(string) error {
+	return func(value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+
+		if positive && n < 1 {
+			return fmt.Errorf("expected an integer greater than 0")
+		}
+
+		return nil
+	}
+}
+
+func validateOneOf(values ...string) func(string) error {
+	return func(value string) error {
+		for _, v := range values {
+			if v == value {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("expected one of '%s'", strings.Join(values, "', '"))
+	}
+}
+
+func validateBool(value string) error {
+	if _, err := strconv.ParseBool(value); err != nil {
+		return fmt.Errorf("expected true or false")
+	}
+
+	return nil
+}
+
+// OptionNames returns the names of all known options in sorted order
+func OptionNames() []string {
+	names := make([]string, 0, len(optionDefinitions))
+	for name := range optionDefinitions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// OptionDescription returns a short description of a known option
+func OptionDescription(name string) string {
+	return optionDefinitions[name].description
+}
+
+// UnmarshalJSON accepts numbers and bools as well as strings so options like "seed": 42 can be written naturally
+func (options *Options) UnmarshalJSON(bytes []byte) error {
+	var raw map[string]interface{}
+
+	decoder := json.NewDecoder(strings.NewReader(string(bytes)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	*options = make(Options)
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			(*options)[key] = v
+		case json.Number, bool:
+			(*options)[key] = fmt.Sprint(v)
+		case nil:
+			continue
+		default:
+			return fmt.Errorf("Option '%s' must be a string, number or bool", key)
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON writes integers and bools as json numbers and bools, the way they're usually written in files
+func (options Options) MarshalJSON() ([]byte, error) {
+	raw := make(map[string]interface{}, len(options))
+	for key, value := range options {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			raw[key] = n
+		} else if value == "true" || value == "false" {
+			raw[key] = value == "true"
+		} else {
+			raw[key] = value
+		}
+	}
+
+	return json.Marshal(raw)
+}
+
+func (options Options) Validate() error {
+	for _, key := range options.keys() {
+		definition, ok := optionDefinitions[key]
+		if !ok {
+			msg := fmt.Sprintf("Unknown option '%s'", key)
+			if suggestion := closestOptionName(key); len(suggestion) != 0 {
+				msg += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+			}
+
+			return fmt.Errorf("%s; valid options are: %s", msg, strings.Join(OptionNames(), ", "))
+		}
+
+		if err := definition.validate(options[key]); err != nil {
+			return fmt.Errorf("Invalid value '%s' for option '%s': %s", options[key], key, err)
+		}
+	}
+
+	return nil
+}
+
+func (options Options) keys() []string {
+	keys := make([]string, 0, len(options))
+	for key := range options {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Seed returns the configured seed, if any
+func (options Options) Seed() (int64, bool) {
+	seed, err := strconv.ParseInt(options[SeedOption], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return seed, true
+}
+
+func (options Options) Workers() int {
+	return options.positiveInt(WorkersOption, runtime.NumCPU())
+}
+
+func (options Options) Nulls() NullHandling {
+	if nulls, ok := options[NullsOption]; ok {
+		return NullHandling(nulls)
+	}
+
+	return NullsAsNull
+}
+
+func (options Options) BatchSize() int {
+	return options.positiveInt(BatchSizeOption, DefaultBatchSize)
+}
+
+func (options Options) Pretty() bool {
+	pretty, _ := strconv.ParseBool(options[PrettyOption])
+	return pretty
+}
+
+func (options Options) Partial() PartialOutput {
+	if partial, ok := options[PartialOption]; ok {
+		return PartialOutput(partial)
+	}
+
+	return FlushPartialOutput
+}
+
+func (options Options) positiveInt(key string, def int) int {
+	n, err := strconv.Atoi(options[key])
+	if err != nil || n < 1 {
+		return def
+	}
+
+	return n
+}
+
+// closestOptionName returns the known option closest to name if it looks like a typo of it
+func closestOptionName(name string) string {
+	best, bestDistance := "", 3
+
+	for _, candidate := range OptionNames() {
+		if d := levenshtein(strings.ToLower(name), candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(prev[j]+1, current[j-1]+1, prev[j-1]+cost)
+		}
+
+		prev = current
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,128 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Override replaces the value at a dotted path (e.g. "types.city.loader.args.src") in a raw configuration
+type Override struct {
+	Path  []string
+	Value interface{}
+}
+
+// ParseOverride parses a "path=value" string; values that are valid json (numbers, bools, objects...) are
+// used as-is and anything else is treated as a string
+func ParseOverride(str string) (*Override, error) {
+	i := strings.Index(str, "=")
+	if i <= 0 {
+		return nil, fmt.Errorf("Invalid override '%s'; expected 'path=value'", str)
+	}
+
+	path := strings.Split(str[:i], ".")
+	for _, segment := range path {
+		if len(segment) == 0 {
+			return nil, fmt.Errorf("Invalid override path '%s'", str[:i])
+		}
+	}
+
+	raw := str[i+1:]
+
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil || decoder.More() {
+		value = raw
+	}
+
+	return &Override{Path: path, Value: value}, nil
+}
+
+func (override *Override) String() string {
+	return fmt.Sprintf("%s=%v", strings.Join(override.Path, "."), override.Value)
+}
+
+// Apply sets the override's value in a configuration decoded into generic maps and slices,
+// creating any missing objects along the way
+func (override *Override) Apply(root map[string]interface{}) error {
+	var current interface{} = root
+
+	for i, segment := range override.Path {
+		last := i == len(override.Path)-1
+
+		switch node := current.(type) {
+		case map[string]interface{}:
+			if last {
+				node[segment] = override.Value
+				return nil
+			}
+
+			next, ok := node[segment]
+			if !ok || next == nil {
+				next = make(map[string]interface{})
+				node[segment] = next
+			}
+
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return fmt.Errorf("Invalid index '%s' in override '%s'", segment, override)
+			}
+
+			if last {
+				node[index] = override.Value
+				return nil
+			}
+
+			current = node[index]
+		default:
+			return fmt.Errorf("Can't set '%s' in override '%s'; '%s' is not an object or array", segment, override, strings.Join(override.Path[:i], "."))
+		}
+	}
+
+	return nil
+}
+
+var envVarPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// InterpolateEnv replaces ${VAR} and ${VAR:-default} with the value of the environment variable VAR
+// (or default if VAR is unset or empty); "$$" is an escaped "$"
+func InterpolateEnv(str string) string {
+	return envVarPattern.ReplaceAllStringFunc(str, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+
+		groups := envVarPattern.FindStringSubmatch(match)
+
+		value := os.Getenv(groups[1])
+		if len(value) == 0 && len(groups[2]) != 0 {
+			return groups[3]
+		}
+
+		return value
+	})
+}
+
+// InterpolateEnvInValue runs InterpolateEnv over every string in a value decoded from json
+func InterpolateEnvInValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return InterpolateEnv(v)
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = InterpolateEnvInValue(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = InterpolateEnvInValue(child)
+		}
+	}
+
+	return value
+}
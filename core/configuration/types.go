@@ -0,0 +1,75 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResolveType returns the type with the given name with everything it extends merged in
+func (config *Configuration) ResolveType(name string) (*UseTypeDTO, error) {
+	return config.resolveType(name, nil)
+}
+
+func (config *Configuration) resolveType(name string, chain []string) (*UseTypeDTO, error) {
+	for _, seen := range chain {
+		if seen == name {
+			return nil, fmt.Errorf("Type '%s' extends itself (%s)", name, strings.Join(append(chain, name), " -> "))
+		}
+	}
+
+	t, ok := config.Types[name]
+	if !ok {
+		if len(chain) == 0 {
+			return nil, fmt.Errorf("Unknown type '%s'", name)
+		}
+
+		return nil, fmt.Errorf("Type '%s' extends unknown type '%s'", chain[len(chain)-1], name)
+	}
+
+	resolved := &UseTypeDTO{LoaderArgs: UseTypeLoaderArgsDTO{Name: t.LoaderArgs.Name, Args: MergeArgs(nil, t.LoaderArgs.Args)}}
+
+	if len(t.Extends) != 0 {
+		parent, err := config.resolveType(t.Extends, append(chain, name))
+		if err != nil {
+			return nil, err
+		}
+
+		// a type that switches to a different loader doesn't inherit the parent's args
+		if len(t.LoaderArgs.Name) == 0 || t.LoaderArgs.Name == parent.LoaderArgs.Name {
+			resolved.LoaderArgs.Name = parent.LoaderArgs.Name
+			resolved.LoaderArgs.Args = MergeArgs(parent.LoaderArgs.Args, t.LoaderArgs.Args)
+		}
+	}
+
+	if len(resolved.LoaderArgs.Name) == 0 {
+		return nil, fmt.Errorf("Type '%s' doesn't specify a loader", name)
+	}
+
+	return resolved, nil
+}
+
+// ResolveFieldType returns the field's type with the field's own args merged in
+func (config *Configuration) ResolveFieldType(field *ConfigurationField) (*UseTypeDTO, error) {
+	t, err := config.ResolveType(field.Type)
+	if err != nil {
+		return nil, fmt.Errorf("Field '%s': %s", field.Name, err)
+	}
+
+	t.LoaderArgs.Args = MergeArgs(t.LoaderArgs.Args, field.Args)
+	return t, nil
+}
+
+// MergeArgs returns a copy of base with the values in overrides replacing any existing ones
+func MergeArgs(base map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(overrides))
+
+	for key, value := range base {
+		merged[key] = value
+	}
+
+	for key, value := range overrides {
+		merged[key] = value
+	}
+
+	return merged
+}
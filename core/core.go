@@ -1,13 +1,18 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/elauffenburger/oar/core/common"
 	conf "github.com/elauffenburger/oar/core/configuration"
 	"github.com/elauffenburger/oar/core/loaders"
 	"github.com/elauffenburger/oar/core/output"
@@ -15,36 +20,125 @@ import (
 )
 
 func LoadConfigurationFromJson(content string) (*conf.Configuration, error) {
+	return LoadConfigurationFromJsonWithOverrides(content, nil)
+}
+
+func LoadConfigurationFromJsonWithOverrides(content string, overrides []*conf.Override) (*conf.Configuration, error) {
 	empty := &conf.Configuration{}
 	config := conf.NewConfiguration()
 
-	bytes := []byte(content)
-	err := json.Unmarshal(bytes, config)
+	// decode into generic values first so env vars can be interpolated and overrides applied by path
+	var raw map[string]interface{}
 
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return empty, errors.New("Failed to parse json")
+	}
+
+	conf.InterpolateEnvInValue(raw)
+
+	for _, override := range overrides {
+		if err := override.Apply(raw); err != nil {
+			return empty, err
+		}
+	}
+
+	bytes, err := json.Marshal(raw)
 	if err != nil {
 		return empty, errors.New("Failed to parse json")
 	}
 
+	err = json.Unmarshal(bytes, config)
+	if err != nil {
+		return empty, fmt.Errorf("Failed to parse configuration: %s", err)
+	}
+
 	// hook for options to modify config
-	applyOptions(config)
+	if err := applyOptions(config); err != nil {
+		return empty, err
+	}
+
+	if err := validateConfiguration(config); err != nil {
+		return empty, err
+	}
 
 	return config, nil
 }
 
-func applyOptions(config *conf.Configuration) {
+func applyOptions(config *conf.Configuration) error {
+	return config.Options.Validate()
+}
+
+func validateConfiguration(config *conf.Configuration) error {
+	switch config.OutputType {
+	case "":
+		config.OutputType = conf.JSON
+	case conf.JSON, conf.SQL, conf.NDJSON:
+	default:
+		return fmt.Errorf("Unknown output '%s'; expected '%s', '%s' or '%s'", config.OutputType, conf.JSON, conf.SQL, conf.NDJSON)
+	}
+
+	if config.NumRows < 0 {
+		return fmt.Errorf("Number of rows can't be negative (got %d)", config.NumRows)
+	}
+
+	for _, field := range config.Fields {
+		if field.NullRate < 0 || field.NullRate > 1 {
+			return fmt.Errorf("Field '%s' has a nullrate of %v; expected a value between 0 and 1", field.Name, field.NullRate)
+		}
+
+		if err := validateFieldKind(field); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateFieldKind(field *conf.ConfigurationField) error {
+	if field.Kind == "" {
+		return nil
+	}
 
+	kinds := make([]string, len(conf.FieldKinds))
+	for i, kind := range conf.FieldKinds {
+		if field.Kind == kind {
+			return nil
+		}
+
+		kinds[i] = string(kind)
+	}
+
+	return fmt.Errorf("Field '%s' has an unknown kind '%s'; expected one of %s", field.Name, field.Kind, strings.Join(kinds, ", "))
 }
 
 func LoadConfigurationFromFile(path string) (*conf.Configuration, error) {
-	empty := &conf.Configuration{}
+	return LoadConfigurationFromFileWithOverrides(path, nil)
+}
 
-	if configPath, err := filepath.Abs(path); err == nil {
-		bytes, _ := ioutil.ReadFile(configPath)
+func LoadConfigurationFromFileWithOverrides(path string, overrides []*conf.Override) (*conf.Configuration, error) {
+	empty := &conf.Configuration{}
 
-		return LoadConfigurationFromJson(string(bytes))
-	} else {
+	configPath, err := filepath.Abs(path)
+	if err != nil {
 		return empty, errors.New(fmt.Sprintf("Could not load file at path '%s'", path))
 	}
+
+	bytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return empty, errors.New(fmt.Sprintf("Could not load file at path '%s': %s", configPath, err))
+	}
+
+	config, err := LoadConfigurationFromJsonWithOverrides(string(bytes), overrides)
+	if err != nil {
+		return config, err
+	}
+
+	// loader args with relative paths are relative to the config file, not the working directory
+	config.Dir = filepath.Dir(configPath)
+
+	return config, nil
 }
 
 func GenerateResults(config *conf.Configuration) (*res.Results, error) {
@@ -52,51 +146,351 @@ func GenerateResults(config *conf.Configuration) (*res.Results, error) {
 }
 
 func GenerateResultsWithTypeLoaderContext(config *conf.Configuration, loaderFactoryContext *loaders.TypeLoaderFactoryContext) (*res.Results, error) {
-	var wg sync.WaitGroup
+	return GenerateResultsWithContextAndTypeLoaderContext(context.Background(), config, loaderFactoryContext)
+}
 
-	numRows := config.NumRows
-	results := &res.Results{Rows: make(res.ResultsRowList, numRows)}
+// GenerateResultsWithContext generates results like GenerateResults until ctx is done. A run stopped early returns
+// ctx.Err() along with the rows generated before it stopped, or no results if the partial option is discard.
+func GenerateResultsWithContext(ctx context.Context, config *conf.Configuration) (*res.Results, error) {
+	return GenerateResultsWithContextAndTypeLoaderContext(ctx, config, NewTypeLoaderFactoryContext())
+}
+
+func GenerateResultsWithContextAndTypeLoaderContext(ctx context.Context, config *conf.Configuration, loaderFactoryContext *loaders.TypeLoaderFactoryContext) (*res.Results, error) {
+	results := &res.Results{Rows: make(res.ResultsRowList, 0, config.NumRows)}
 
 	// generate type loaders to fulfill this config
-	types := BuildTypeLoadersForConfig(config, loaderFactoryContext)
+	types, err := BuildTypeLoadersForConfig(config, loaderFactoryContext)
+	if err != nil {
+		return nil, err
+	}
+
+	// rows are handed off in order
+	err = generateRows(ctx, config, types, func(row *res.ResultsRow) error {
+		results.Rows = append(results.Rows, row)
+		return nil
+	})
+
+	if err := closeAfter(err, types); err != nil {
+		if err == ctx.Err() && config.Options.Partial() == conf.FlushPartialOutput {
+			return results, err
+		}
+
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func GenerateRows(config *conf.Configuration, fn func(row *res.ResultsRow) error) error {
+	return GenerateRowsWithTypeLoaderContext(config, NewTypeLoaderFactoryContext(), fn)
+}
+
+// GenerateRowsWithTypeLoaderContext generates rows like GenerateResultsWithTypeLoaderContext, but hands each
+// row to fn in order as it's generated instead of keeping every row in memory
+func GenerateRowsWithTypeLoaderContext(config *conf.Configuration, loaderFactoryContext *loaders.TypeLoaderFactoryContext, fn func(row *res.ResultsRow) error) error {
+	return GenerateRowsWithContextAndTypeLoaderContext(context.Background(), config, loaderFactoryContext, fn)
+}
+
+// GenerateRowsWithContext generates rows like GenerateRows until ctx is done, when it returns ctx.Err(); fn has been
+// called with every row generated before then
+func GenerateRowsWithContext(ctx context.Context, config *conf.Configuration, fn func(row *res.ResultsRow) error) error {
+	return GenerateRowsWithContextAndTypeLoaderContext(ctx, config, NewTypeLoaderFactoryContext(), fn)
+}
+
+func GenerateRowsWithContextAndTypeLoaderContext(ctx context.Context, config *conf.Configuration, loaderFactoryContext *loaders.TypeLoaderFactoryContext, fn func(row *res.ResultsRow) error) error {
+	types, err := BuildTypeLoadersForConfig(config, loaderFactoryContext)
+	if err != nil {
+		return err
+	}
+
+	return closeAfter(generateRows(ctx, config, types, fn), types)
+}
+
+// GenerateRowsWithTypeLoaders generates rows like GenerateRows with loaders already built by
+// BuildTypeLoadersForConfig, so they can be reused by several runs; they're reset before the run but not closed
+func GenerateRowsWithTypeLoaders(config *conf.Configuration, types map[string]loaders.TypeLoader, fn func(row *res.ResultsRow) error) error {
+	return GenerateRowsWithContextAndTypeLoaders(context.Background(), config, types, fn)
+}
+
+func GenerateRowsWithContextAndTypeLoaders(ctx context.Context, config *conf.Configuration, types map[string]loaders.TypeLoader, fn func(row *res.ResultsRow) error) error {
+	return generateRows(ctx, config, types, fn)
+}
+
+// closeAfter closes the loaders of a run that ended with err, and returns err or else the error closing them
+func closeAfter(err error, types map[string]loaders.TypeLoader) error {
+	if closeErr := CloseTypeLoaders(types); err == nil {
+		return closeErr
+	}
+
+	return err
+}
+
+// rows generated per round by each worker before they're handed off in order
+const rowsPerWorkerChunk = 64
+
+// times a row is regenerated when it repeats a value of a unique field
+const maxUniqueAttempts = 100
+
+// generateRows generates config.NumRows rows using the configured number of workers and calls fn with each row in
+// order, until ctx is done
+func generateRows(ctx context.Context, config *conf.Configuration, types map[string]loaders.TypeLoader, fn func(row *res.ResultsRow) error) error {
+	numRows := config.NumRows
+	workers := config.Options.Workers()
+	if generatesInOrder(types) {
+		workers = 1
+	}
+
+	seed, ok := config.Options.Seed()
+	if !ok {
+		seed = time.Now().UnixNano()
+	}
+
+	run := res.NewRun(ctx, config, seed)
+	if err := loaders.ResetTypeLoaders(typeLoaderList(types), run); err != nil {
+		return err
+	}
+
+	newRow := func(index int, seed int64) *res.ResultsRow {
+		row := res.NewResultsRow(index, seed)
+		row.Run = run
+
+		return row
+	}
+
+	metrics := metricsFrom(ctx)
+	if metrics != nil {
+		metrics.start(config)
+		defer metrics.stop()
+	}
+
+	uniques := newUniqueValues(config)
+
+	// nil, so never done, for contexts that can't be cancelled
+	done := ctx.Done()
+
+	chunk := make([]*res.ResultsRow, workers*rowsPerWorkerChunk)
+	for start := 0; start < numRows; start += len(chunk) {
+		n := numRows - start
+		if n > len(chunk) {
+			n = len(chunk)
+		}
+
+		var wg sync.WaitGroup
+		var next int64 = -1
+		errs := make([]error, workers)
 
-	for i := 0; i < numRows; i++ {
-		wg.Add(1)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
 
-		go func(index int) {
-			defer wg.Done()
+			go func(worker int) {
+				defer wg.Done()
 
-			set := &res.ResultsRow{}
-			for _, field := range config.Fields {
-				entry := &res.ResultsRowValue{ConfigurationField: *field}
+				for {
+					i := int(atomic.AddInt64(&next, 1))
+					if i >= n || errs[worker] != nil {
+						return
+					}
 
-				value, err := GenerateValueForField(config, entry.ConfigurationField, set, types)
+					select {
+					case <-done:
+						return
+					default:
+					}
+
+					index := start + i
+					chunk[i], errs[worker] = generateRow(config, newRow(index, common.RowSeed(seed, index)), types, metrics)
+				}
+			}(w)
+		}
+
+		wg.Wait()
+
+		// loaders may have failed because the run was stopped, so that's reported instead
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, row := range chunk[:n] {
+			// duplicates are resolved in row order so seeded runs stay repeatable
+			for attempt := 1; !uniques.add(row); attempt++ {
+				if attempt > maxUniqueAttempts {
+					return fmt.Errorf("Failed to generate a unique value for field '%s' in row %d after %d attempts; its type may not have enough distinct values", uniques.lastConflict, row.Index, maxUniqueAttempts)
+				}
+
+				if metrics != nil {
+					atomic.AddInt64(&metrics.retries, 1)
+				}
+
+				index := start + i
+				retry, err := generateRow(config, newRow(index, common.RowSeed(common.RowSeed(seed, index), attempt)), types, metrics)
 				if err != nil {
-					// todo handle error
-					continue
+					return err
 				}
 
-				entry.Value = value
-				set.Values = append(set.Values, entry)
+				row = retry
+			}
+
+			if err := fn(row); err != nil {
+				return err
 			}
 
-			results.Rows[index] = set
-		}(i)
+			if metrics != nil {
+				atomic.AddInt64(&metrics.rows, 1)
+			}
+		}
 	}
 
-	wg.Wait()
-	return results, nil
+	return nil
+}
+
+// generatesInOrder is true if any of the loaders needs to see rows in order
+func generatesInOrder(types map[string]loaders.TypeLoader) bool {
+	for _, loader := range types {
+		if ordered, ok := loader.(loaders.TypeLoaderWithOrder); ok && ordered.GeneratesInOrder() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GenerateRow fills set with a value for each field in the config
+func GenerateRow(config *conf.Configuration, set *res.ResultsRow, types map[string]loaders.TypeLoader) (*res.ResultsRow, error) {
+	return generateRow(config, set, types, nil)
+}
+
+func generateRow(config *conf.Configuration, set *res.ResultsRow, types map[string]loaders.TypeLoader, metrics *Metrics) (*res.ResultsRow, error) {
+	for _, field := range config.Fields {
+		entry, err := generateValueForField(config, *field, set, types, metrics)
+		if err == errNoLoaderForType {
+			// todo handle fields with unknown types
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate value for field '%s' in row %d: %s", field.Name, set.Index, err)
+		}
+
+		set.Values = append(set.Values, entry)
+	}
+
+	return set, nil
+}
+
+var errNoLoaderForType = errors.New("Failed to find a loader")
+
+func GenerateValueForField(config *conf.Configuration, field conf.ConfigurationField, set *res.ResultsRow, loaders map[string]loaders.TypeLoader) (*res.ResultsRowValue, error) {
+	return generateValueForField(config, field, set, loaders, nil)
 }
 
-func GenerateValueForField(config *conf.Configuration, field conf.ConfigurationField, set *res.ResultsRow, loaders map[string]loaders.TypeLoader) (string, error) {
-	loader, ok := loaders[field.Type]
+func generateValueForField(config *conf.Configuration, field conf.ConfigurationField, set *res.ResultsRow, loaders map[string]loaders.TypeLoader, metrics *Metrics) (*res.ResultsRowValue, error) {
+	loader, ok := loaders[field.LoaderKey()]
 
 	if !ok {
-		return "", errors.New("Failed to find a loader")
+		return nil, errNoLoaderForType
 	}
 
-	val, _ := loader.GenerateSingleValue(config, set)
-	return fmt.Sprintf("%s", val), nil
+	var started time.Time
+	if metrics != nil {
+		started = time.Now()
+	}
+
+	val, err := loader.GenerateSingleValue(config, set)
+	if err != nil {
+		return nil, err
+	}
+
+	var took time.Duration
+	if metrics != nil {
+		took = time.Since(started)
+	}
+
+	entry := &res.ResultsRowValue{ConfigurationField: field}
+	if field.NullRate > 0 && set.Rand.Float64() < field.NullRate {
+		val = nil
+	}
+
+	// nulls from the nullrate count too, since they're what ends up in the output
+	if metrics != nil {
+		metrics.value(&field, took, val == nil)
+	}
+
+	if val == nil {
+		entry.SetNull(config.Options.Nulls())
+		return entry, nil
+	}
+
+	entry.Value = fmt.Sprint(val)
+	if err := checkKind(entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// checkKind returns an error if the value can't be written as its kind in json output
+func checkKind(value *res.ResultsRowValue) error {
+	if value.Value == "" {
+		return nil
+	}
+
+	switch value.Kind {
+	case conf.IntegerKind, conf.NumberKind:
+		if first := value.Value[0]; !json.Valid([]byte(value.Value)) || first != '-' && (first < '0' || first > '9') {
+			return fmt.Errorf("'%s' isn't a number, but the field's kind is %s", value.Value, value.Kind)
+		}
+	case conf.JSONKind:
+		if !json.Valid([]byte(value.Value)) {
+			return fmt.Errorf("'%s' isn't valid json, but the field's kind is json", value.Value)
+		}
+	}
+
+	return nil
+}
+
+// uniqueValues tracks the values already used by unique fields
+type uniqueValues struct {
+	seen         map[string]map[string]bool
+	lastConflict string
+}
+
+func newUniqueValues(config *conf.Configuration) *uniqueValues {
+	seen := make(map[string]map[string]bool)
+	for _, field := range config.Fields {
+		if field.Unique {
+			seen[field.Name] = make(map[string]bool)
+		}
+	}
+
+	return &uniqueValues{seen: seen}
+}
+
+// add records the row's values for unique fields, or returns false without recording any if one was already used
+func (uniques *uniqueValues) add(row *res.ResultsRow) bool {
+	if len(uniques.seen) == 0 {
+		return true
+	}
+
+	for _, value := range row.Values {
+		if seen, ok := uniques.seen[value.Name]; ok && !value.IsNull() && seen[value.Value] {
+			uniques.lastConflict = value.Name
+			return false
+		}
+	}
+
+	for _, value := range row.Values {
+		if seen, ok := uniques.seen[value.Name]; ok && !value.IsNull() {
+			seen[value.Value] = true
+		}
+	}
+
+	return true
 }
 
 func GetOutputFormatter(config *conf.Configuration) output.OutputFormatter {
@@ -104,39 +498,82 @@ func GetOutputFormatter(config *conf.Configuration) output.OutputFormatter {
 
 	switch outputtype {
 	case conf.JSON:
-		return &output.JsonOutputFormatter{}
+		return &output.JsonOutputFormatter{Pretty: config.Options.Pretty()}
 	case conf.SQL:
-		return output.NewSqlOutputFormatter(config.Name)
+		formatter := output.NewSqlOutputFormatter(config.Name)
+		formatter.BatchSize = config.Options.BatchSize()
+
+		return formatter
+	case conf.NDJSON:
+		return &output.NdjsonOutputFormatter{}
 	}
 
 	panic("Couldn't figure out which output formatter to use")
 }
 
-func BuildTypeLoadersForConfig(config *conf.Configuration, typeLoaderFactoryCtx *loaders.TypeLoaderFactoryContext) map[string]loaders.TypeLoader {
+// BuildTypeLoadersForConfig creates and loads the loaders needed by the config's fields, keyed by
+// ConfigurationField.LoaderKey. Callers close them with CloseTypeLoaders once they're done with them; if any fails
+// to load, those already loaded are closed.
+func BuildTypeLoadersForConfig(config *conf.Configuration, typeLoaderFactoryCtx *loaders.TypeLoaderFactoryContext) (map[string]loaders.TypeLoader, error) {
 	types := make(map[string]loaders.TypeLoader)
 
-	// load custom types
-	for typename, t := range config.Types {
-		if _, exists := types[typename]; exists {
+	for _, field := range config.Fields {
+		key := field.LoaderKey()
+		if _, exists := types[key]; exists {
 			continue
 		}
 
-		loadername := t.LoaderArgs.Name
-		factory, ok := (*typeLoaderFactoryCtx)[loadername]
-
-		if !ok {
-			// todo handle unknown loader
+		if _, exists := config.Types[field.Type]; !exists {
+			// todo handle fields with unknown types
 			continue
 		}
 
-		// create a loader for this type
-		loader := factory()
-		loader.Load(&t)
+		loader, err := buildFieldTypeLoader(config, field, typeLoaderFactoryCtx)
+		if err != nil {
+			CloseTypeLoaders(types)
+			return nil, err
+		}
+
+		types[key] = loader
+	}
+
+	return types, nil
+}
+
+func buildFieldTypeLoader(config *conf.Configuration, field *conf.ConfigurationField, typeLoaderFactoryCtx *loaders.TypeLoaderFactoryContext) (loaders.TypeLoader, error) {
+	t, err := config.ResolveFieldType(field)
+	if err != nil {
+		return nil, err
+	}
+
+	loader, err := BuildTypeLoader(config, t, typeLoaderFactoryCtx)
+	if err != nil {
+		if len(field.Args) != 0 {
+			return nil, fmt.Errorf("Failed to load type '%s' for field '%s': %s", field.Type, field.Name, err)
+		}
+
+		return nil, fmt.Errorf("Failed to load type '%s': %s", field.Type, err)
+	}
+
+	return loader, nil
+}
+
+// CloseTypeLoaders releases whatever the loaders hold, like files or programs, and returns the first error closing one
+func CloseTypeLoaders(types map[string]loaders.TypeLoader) error {
+	return loaders.CloseTypeLoaders(typeLoaderList(types))
+}
 
-		types[typename] = loader
+func typeLoaderList(types map[string]loaders.TypeLoader) []loaders.TypeLoader {
+	list := make([]loaders.TypeLoader, 0, len(types))
+	for _, loader := range types {
+		list = append(list, loader)
 	}
 
-	return types
+	return list
+}
+
+func BuildTypeLoader(config *conf.Configuration, t *conf.UseTypeDTO, typeLoaderFactoryCtx *loaders.TypeLoaderFactoryContext) (loaders.TypeLoader, error) {
+	return typeLoaderFactoryCtx.NewLoader(config, t)
 }
 
 func NewTypeLoaderFactoryContext() *loaders.TypeLoaderFactoryContext {
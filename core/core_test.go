@@ -1,7 +1,20 @@
 package core
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/loaders"
+	"github.com/elauffenburger/oar/core/output"
+	res "github.com/elauffenburger/oar/core/results"
+	"github.com/elauffenburger/oar/core/schema"
 )
 
 func TestLoadJsonConfiguration(t *testing.T) {
@@ -28,3 +41,781 @@ func TestLoadJsonConfiguration(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestLoadJsonConfigurationWithEnvAndOverrides(t *testing.T) {
+	os.Setenv("OAR_TEST_NAME", "Users")
+	os.Unsetenv("OAR_TEST_SRC")
+
+	overrides := make([]*conf.Override, 0)
+	for _, str := range []string{"rows=100", "types.city.loader.args.src=/data/cities.csv", "fields.0.type=city"} {
+		override, err := conf.ParseOverride(str)
+		if err != nil {
+			t.Fatalf("Error parsing override: %s", err)
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	config, err := LoadConfigurationFromJsonWithOverrides(`{
+		"name": "${OAR_TEST_NAME}", "rows": 5,
+		"fields": [{"name": "City", "type": "number"}],
+		"types": {"city": {"loader": {"name": "csvloader", "args": {"src": "${OAR_TEST_SRC:-./cities.csv}"}}},
+			"state": {"loader": {"name": "csvloader", "args": {"src": "${OAR_TEST_SRC:-./states.csv}"}}}}
+	}`, overrides)
+
+	if err != nil {
+		t.Fatalf("Error loading configuration: %s", err)
+	}
+
+	if config.Name != "Users" || config.NumRows != 100 || config.Fields[0].Type != "city" {
+		t.Errorf("Env vars or overrides weren't applied: %+v", config)
+	}
+
+	if src := config.Types["city"].LoaderArgs.Args["src"]; src != "/data/cities.csv" {
+		t.Errorf("Expected override of src, got '%v'", src)
+	}
+
+	if src := config.Types["state"].LoaderArgs.Args["src"]; src != "./states.csv" {
+		t.Errorf("Expected default value for src, got '%v'", src)
+	}
+}
+
+func TestSeedOptionGeneratesSameResults(t *testing.T) {
+	json := `{
+		"rows": 500, "options": {"seed": 42, "workers": 4},
+		"fields": [{"name": "Id", "type": "uuid"}, {"name": "Number", "type": "number"}],
+		"types": {"uuid": {"loader": {"name": "uuid"}}, "number": {"loader": {"name": "number"}}}
+	}`
+
+	config, err := LoadConfigurationFromJson(json)
+	if err != nil {
+		t.Fatalf("Error loading configuration: %s", err)
+	}
+
+	results1, _ := GenerateResults(config)
+
+	config.Options[conf.WorkersOption] = "1"
+	results2, _ := GenerateResults(config)
+
+	for i := range results1.Rows {
+		for j := range results1.Rows[i].Values {
+			if results1.Rows[i].Values[j].Value != results2.Rows[i].Values[j].Value {
+				t.Fatalf("Row %d differs between runs with the same seed", i)
+			}
+		}
+	}
+
+	config.Options[conf.SeedOption] = "43"
+	results3, _ := GenerateResults(config)
+
+	if results1.Rows[0].Values[0].Value == results3.Rows[0].Values[0].Value {
+		t.Errorf("Expected different seeds to generate different values")
+	}
+}
+
+type greetingLoader struct{}
+
+func (loader *greetingLoader) Load(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+	return nil
+}
+
+func (loader *greetingLoader) GenerateSingleValue(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+	return "hello", nil
+}
+
+func (loader *greetingLoader) ArgsSchema() *schema.Schema {
+	return schema.Object(map[string]*schema.Schema{"greeting": schema.Of("string", "")}, "greeting")
+}
+
+func TestConfigurationSchemaIncludesLoaderArgs(t *testing.T) {
+	ctx := NewTypeLoaderFactoryContext()
+	ctx.AddLoaderFactory("greeting", func() loaders.TypeLoader { return &greetingLoader{} })
+
+	bytes, err := json.Marshal(GetConfigurationSchemaWithTypeLoaderContext(ctx))
+	if err != nil {
+		t.Fatalf("Error marshalling schema: %s", err)
+	}
+
+	var doc map[string]interface{}
+	json.Unmarshal(bytes, &doc)
+
+	loader := doc["properties"].(map[string]interface{})["types"].(map[string]interface{})["additionalProperties"].(map[string]interface{})["properties"].(map[string]interface{})["loader"].(map[string]interface{})
+
+	found := make(map[string]interface{})
+	for _, branch := range loader["oneOf"].([]interface{}) {
+		props := branch.(map[string]interface{})["properties"].(map[string]interface{})
+		if name, ok := props["name"].(map[string]interface{}); ok {
+			found[name["const"].(string)] = props["args"]
+		}
+	}
+
+	if _, ok := found["csvloader"]; !ok {
+		t.Errorf("Expected schema to include csvloader")
+	}
+
+	greeting, ok := found["greeting"].(map[string]interface{})
+	if !ok || greeting["required"].([]interface{})[0] != "greeting" {
+		t.Errorf("Expected schema to include the custom loader's args, got: %v", found["greeting"])
+	}
+}
+
+func TestTypesCanExtendTypesAndFieldsCanPassArgs(t *testing.T) {
+	config, err := LoadConfigurationFromJson(`{
+		"rows": 50,
+		"fields": [
+			{"name": "Age", "type": "number", "args": {"min": 18, "max": 90}},
+			{"name": "Big", "type": "number", "args": {"min": 1000, "max": 1000}},
+			{"name": "WorkEmail", "type": "workemail"}
+		],
+		"types": {
+			"number": {"loader": {"name": "number"}},
+			"email": {"loader": {"name": "strformat", "args": {"format": "%s@%s", "args": ["Age"]}}},
+			"workemail": {"extends": "email", "loader": {"args": {"format": "%s@work.com"}}}
+		}
+	}`)
+
+	if err != nil {
+		t.Fatalf("Error loading configuration: %s", err)
+	}
+
+	results, err := GenerateResults(config)
+	if err != nil {
+		t.Fatalf("Error generating results: %s", err)
+	}
+
+	for _, row := range results.Rows {
+		age, _ := row.Values.GetEntryWithName("Age")
+		big, _ := row.Values.GetEntryWithName("Big")
+		email, _ := row.Values.GetEntryWithName("WorkEmail")
+
+		if n, _ := strconv.Atoi(age.Value); n < 18 || n > 90 {
+			t.Errorf("Expected age between 18 and 90, got %s", age.Value)
+		}
+
+		if big.Value != "1000" {
+			t.Errorf("Expected field args to apply only to their field, got %s", big.Value)
+		}
+
+		if email.Value != age.Value+"@work.com" {
+			t.Errorf("Expected inherited args to be overridden, got %s", email.Value)
+		}
+	}
+
+	config.Types["email"] = conf.UseTypeDTO{Extends: "workemail"}
+	if _, err := GenerateResults(config); err == nil || !strings.Contains(err.Error(), "extends itself") {
+		t.Errorf("Expected an error for a cycle of types, got: %v", err)
+	}
+}
+
+func TestUnknownOptionIsAnError(t *testing.T) {
+	_, err := LoadConfigurationFromJson(`{"rows": 1, "options": {"sed": "42"}}`)
+
+	if err == nil || !strings.Contains(err.Error(), "did you mean 'seed'") {
+		t.Errorf("Expected a helpful error for an unknown option, got: %v", err)
+	}
+
+	_, err = LoadConfigurationFromJson(`{"rows": 1, "options": {"workers": "many"}}`)
+	if err == nil {
+		t.Errorf("Expected an error for an invalid option value")
+	}
+}
+
+func TestUniqueFieldsAndNullRates(t *testing.T) {
+	config, err := LoadConfigurationFromJson(`{
+		"rows": 500,
+		"options": {"seed": 3, "workers": 4},
+		"fields": [
+			{"name": "Code", "type": "code", "unique": true},
+			{"name": "Size", "type": "size", "nullrate": 0.5}
+		],
+		"types": {
+			"code": {"loader": {"name": "number", "args": {"min": 1, "max": 600}}},
+			"size": {"loader": {"name": "choice", "args": {"values": ["S", "M", "L"], "weights": [0, 1, 3]}}}
+		}
+	}`)
+
+	if err != nil {
+		t.Fatalf("Error loading configuration: %s", err)
+	}
+
+	results, err := GenerateResults(config)
+	if err != nil {
+		t.Fatalf("Error generating results: %s", err)
+	}
+
+	codes := make(map[string]bool)
+	nulls := 0
+
+	for _, row := range results.Rows {
+		code, _ := row.Values.GetEntryWithName("Code")
+		if codes[code.Value] {
+			t.Errorf("Expected unique codes, got %s twice", code.Value)
+		}
+		codes[code.Value] = true
+
+		size, _ := row.Values.GetEntryWithName("Size")
+		if size.Null {
+			nulls++
+		} else if size.Value == "S" {
+			t.Errorf("Expected a value with no weight to never be picked")
+		}
+	}
+
+	if nulls < 200 || nulls > 300 {
+		t.Errorf("Expected about half of the sizes to be null, got %d of 500", nulls)
+	}
+
+	config.NumRows = 700
+	if _, err := GenerateResults(config); err == nil || !strings.Contains(err.Error(), "unique value for field 'Code'") {
+		t.Errorf("Expected an error when there aren't enough unique values, got: %v", err)
+	}
+
+	if _, err := LoadConfigurationFromJson(`{"fields": [{"name": "A", "type": "a", "nullrate": 2}]}`); err == nil {
+		t.Errorf("Expected an error for a nullrate greater than 1")
+	}
+}
+
+func TestMaskRowReplacesValuesConsistently(t *testing.T) {
+	config, err := LoadConfigurationFromJson(`{
+		"fields": [{"name": "Email", "type": "email"}],
+		"types": {"email": {"loader": {"name": "text", "args": {"charset": "lower", "suffix": "@example.com"}}}}
+	}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mask := func(key string, email interface{}) *res.ResultsRow {
+		masker, err := NewMasker(config, []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row := NewResultsRowFromValues(0, []string{"Id", "Email"}, []interface{}{json.Number("7"), email})
+		if err := masker.MaskRow(row); err != nil {
+			t.Fatal(err)
+		}
+
+		return row
+	}
+
+	first, second := mask("key", "jane@corp.com"), mask("key", "jane@corp.com")
+	email := first.Values[1].Value
+
+	if !strings.HasSuffix(email, "@example.com") || email != second.Values[1].Value {
+		t.Errorf("Expected the same fake email both times, got '%s' and '%s'", email, second.Values[1].Value)
+	}
+
+	if id := first.Values[0]; id.Value != "7" || id.JSONValue() != json.Number("7") {
+		t.Errorf("Expected columns without a field to be kept, got %+v", id)
+	}
+
+	if other := mask("other key", "jane@corp.com").Values[1].Value; other == email {
+		t.Errorf("Expected a different key to give a different email, got '%s' for both", other)
+	}
+
+	if null := mask("key", nil).Values[1]; !null.Null {
+		t.Errorf("Expected null values to stay null, got %+v", null)
+	}
+}
+
+func TestConfigBuilderBuildsConfigurationsThatRoundTrip(t *testing.T) {
+	config, err := NewConfig("users").
+		Rows(20).
+		Seed(42).
+		DataDir("../data").
+		Type("word", Text(3, 8).With("charset", "lower")).
+		Field("id", AutoIncrement()).
+		Field("first_name", FirstName()).
+		Field("email", Email(), Unique()).
+		Field("backup_email", Email().With("suffix", "@example.org"), NullRate(0.5)).
+		Field("age", Number(18, 90), Kind(conf.IntegerKind)).
+		Field("nickname", Ref("word")).
+		Field("greeting", StrFormat("hi %s", "first_name")).
+		Output(SQL).
+		Build()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.OutputType != conf.SQL || config.NumRows != 20 || config.Options[conf.SeedOption] != "42" {
+		t.Errorf("Expected the builder's settings, got %+v", config)
+	}
+
+	// a type that's already taken by a different type is added under the field's name
+	if config.Fields[2].Type != "email" || config.Fields[3].Type != "backup_email" || config.Fields[1].Type != "firstname" {
+		t.Errorf("Expected types named after the builder's types or their fields, got %s, %s and %s", config.Fields[1].Type, config.Fields[2].Type, config.Fields[3].Type)
+	}
+
+	content, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(content), `"options":{"seed":42}`) {
+		t.Errorf("Expected options to be written as they are in files, got %s", content)
+	}
+
+	loaded, err := LoadConfigurationFromJson(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := json.Marshal(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(again) != string(content) {
+		t.Errorf("Expected the configuration to load as it was saved:\n%s\n%s", content, again)
+	}
+
+	// saved somewhere else, it still finds the data/ files
+	path := filepath.Join(t.TempDir(), "configs", "users.json")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if fromFile, err := LoadConfigurationFromFile(path); err != nil {
+		t.Fatal(err)
+	} else if _, err := GenerateResults(fromFile); err != nil {
+		t.Errorf("Expected the saved configuration to generate rows, got %s", err)
+	}
+
+	built, err := GenerateResults(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := GenerateResults(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, row := range built.Rows {
+		for j, value := range row.Values {
+			if other := saved.Rows[i].Values[j]; value.Value != other.Value || value.Null != other.Null {
+				t.Fatalf("Expected the saved configuration to generate the same rows, got '%s' and '%s' for %s", value.Value, other.Value, value.Name)
+			}
+		}
+	}
+}
+
+func TestConfigBuilderReportsMistakes(t *testing.T) {
+	cases := map[string]*ConfigBuilder{
+		"is added twice":      NewConfig("t").Field("a", UUID()).Field("a", UUID()),
+		"unknown type 'nope'": NewConfig("t").Field("a", Ref("nope")),
+		"min (9) is greater":  NewConfig("t").Field("a", Number(9, 1)),
+		"Unknown option":      NewConfig("t").Option("sede", 1),
+		"Unknown output":      NewConfig("t").Output("xml"),
+		"nullrate of 2":       NewConfig("t").Field("a", UUID(), NullRate(2)),
+	}
+
+	for expected, builder := range cases {
+		if _, err := builder.Build(); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing '%s', got %v", expected, err)
+		}
+	}
+}
+
+// lifecycleLoader counts the rows of each run and records its lifecycle
+type lifecycleLoader struct {
+	events *[]string
+	failAt *int
+	count  int
+}
+
+func (loader *lifecycleLoader) Load(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+	if dto.LoaderArgs.Args["fail"] == true {
+		return fmt.Errorf("failed to load")
+	}
+
+	*loader.events = append(*loader.events, "load")
+	return nil
+}
+
+func (loader *lifecycleLoader) Reset(run *res.Run) error {
+	*loader.events = append(*loader.events, "reset "+run.Table)
+	loader.count = 0
+
+	return nil
+}
+
+func (loader *lifecycleLoader) GenerateSingleValue(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+	if set.Run == nil || set.Run.NumRows != config.NumRows {
+		return nil, fmt.Errorf("expected the row's run")
+	}
+
+	loader.count++
+	if set.Index == *loader.failAt {
+		return nil, fmt.Errorf("failed to generate")
+	}
+
+	return loader.count, nil
+}
+
+func (loader *lifecycleLoader) Close() error {
+	*loader.events = append(*loader.events, "close")
+	return nil
+}
+
+func TestLoadersAreResetAndClosed(t *testing.T) {
+	var events []string
+	failAt := -1
+
+	ctx := NewTypeLoaderFactoryContext()
+	ctx.AddLoaderFactory("lifecycle", func() loaders.TypeLoader { return &lifecycleLoader{events: &events, failAt: &failAt} })
+
+	config := NewConfig("counts").Rows(5).Option(conf.WorkersOption, 1).Type("count", Loader("lifecycle", nil)).Field("n", Ref("count")).config
+	config.Types["broken"] = conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "lifecycle", Args: map[string]interface{}{"fail": true}}}
+
+	types, err := BuildTypeLoadersForConfig(config, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// loaders reused by several runs start over each time
+	for run := 0; run < 2; run++ {
+		var last string
+		err := GenerateRowsWithTypeLoaders(config, types, func(row *res.ResultsRow) error {
+			last = row.Values[0].Value
+			return nil
+		})
+
+		if err != nil || last != "5" {
+			t.Errorf("Expected run %d to count 5 rows, got %s (%v)", run, last, err)
+		}
+	}
+
+	CloseTypeLoaders(types)
+	if got := strings.Join(events, ", "); got != "load, reset counts, reset counts, close" {
+		t.Errorf("Expected the loader to be loaded, reset for each run and closed, got %s", got)
+	}
+
+	// runs that fail still close their loaders
+	events = nil
+	failAt = 3
+	if _, err := GenerateResultsWithTypeLoaderContext(config, ctx); err == nil || events[len(events)-1] != "close" {
+		t.Errorf("Expected a failed run to close its loaders, got %v (%v)", events, err)
+	}
+
+	// and so do configurations with a type that fails to load
+	events = nil
+	config.Fields = append(config.Fields, &conf.ConfigurationField{Name: "broken", Type: "broken"})
+	if _, err := BuildTypeLoadersForConfig(config, ctx); err == nil || strings.Join(events, ", ") != "load, close, close" {
+		t.Errorf("Expected the loaded loaders to be closed when another fails to load, got %v (%v)", events, err)
+	}
+}
+
+// cancellingLoader stops the run once it's generated a row for the given index
+type cancellingLoader struct {
+	cancel context.CancelFunc
+	at     int
+}
+
+func (loader *cancellingLoader) Load(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+	return nil
+}
+
+func (loader *cancellingLoader) GenerateSingleValue(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+	if set.Index == loader.at {
+		loader.cancel()
+	}
+
+	return set.Index, nil
+}
+
+func TestGenerationStopsWhenContextIsDone(t *testing.T) {
+	for _, partial := range []conf.PartialOutput{conf.FlushPartialOutput, conf.DiscardPartialOutput} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		loaderCtx := NewTypeLoaderFactoryContext()
+		loaderCtx.AddLoaderFactory("cancel", func() loaders.TypeLoader { return &cancellingLoader{cancel: cancel, at: 300} })
+
+		config := NewConfig("t").Rows(100000).Option(conf.WorkersOption, 4).Option(conf.PartialOption, partial).Field("n", Loader("cancel", nil)).config
+
+		results, err := GenerateResultsWithContextAndTypeLoaderContext(ctx, config, loaderCtx)
+		if err != context.Canceled {
+			t.Fatalf("Expected generation to stop with context.Canceled, got %v", err)
+		}
+
+		if partial == conf.DiscardPartialOutput {
+			if results != nil {
+				t.Errorf("Expected discarded results, got %d rows", len(results.Rows))
+			}
+
+			continue
+		}
+
+		// the rows before the one that cancelled are all there, in order, and generation stopped soon after
+		if n := len(results.Rows); n < 256 || n > 1024 {
+			t.Fatalf("Expected the rows generated before stopping, got %d", n)
+		}
+
+		for i, row := range results.Rows {
+			if row.Index != i {
+				t.Fatalf("Expected row %d at %d", row.Index, i)
+			}
+		}
+
+		var buf strings.Builder
+		formatter := &output.JsonOutputFormatter{}
+
+		if err := output.FormatToStreamWithContext(context.Background(), formatter, results, &buf, partial); err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []interface{}
+		if err := json.Unmarshal([]byte(buf.String()), &rows); err != nil || len(rows) != len(results.Rows) {
+			t.Errorf("Expected the partial results to be written as valid json, got %d rows (%v)", len(rows), err)
+		}
+
+		// output stopped early is finished, or with discard, not written at all
+		for _, partial := range []conf.PartialOutput{conf.FlushPartialOutput, conf.DiscardPartialOutput} {
+			buf.Reset()
+			if err := output.FormatToStreamWithContext(ctx, formatter, results, &buf, partial); err != context.Canceled {
+				t.Errorf("Expected formatting to stop with context.Canceled, got %v", err)
+			}
+
+			if expected := map[conf.PartialOutput]string{conf.FlushPartialOutput: "[]", conf.DiscardPartialOutput: ""}[partial]; buf.String() != expected {
+				t.Errorf("Expected '%s' to be written with partial %s, got '%s'", expected, partial, buf.String())
+			}
+		}
+	}
+}
+
+func TestMetricsCountRowsValuesAndRetries(t *testing.T) {
+	config, err := NewConfig("t").Rows(50).Seed(1).Field("n", Number(1, 60), Unique()).Field("maybe", Choice("a"), NullRate(0.5)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := NewMetrics()
+	if _, err := GenerateResultsWithContext(WithMetrics(context.Background(), metrics), config); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := metrics.Summary()
+	if summary.Rows != 50 || summary.UniqueRetries == 0 || summary.Elapsed <= 0 {
+		t.Fatalf("Expected 50 rows, some retries and the time taken, got %+v", summary)
+	}
+
+	types := make(map[string]TypeMetrics)
+	for _, t := range summary.Types {
+		types[t.Type] = t
+	}
+
+	// every attempt is timed, including rows generated again
+	if n := types["number"]; n.Loader != "number" || n.Values != 50+summary.UniqueRetries {
+		t.Errorf("Expected a value for every row and retry, got %+v", n)
+	}
+
+	if c := types["choice"]; c.Values != types["number"].Values {
+		t.Errorf("Expected choice's values to be counted, got %+v", c)
+	}
+}
+
+func TestMetricsCountNullsFromNullRate(t *testing.T) {
+	config, err := NewConfig("t").Rows(20).Seed(1).Field("never", Choice("a"), NullRate(1)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := NewMetrics()
+	if _, err := GenerateResultsWithContext(WithMetrics(context.Background(), metrics), config); err != nil {
+		t.Fatal(err)
+	}
+
+	if types := metrics.Summary().Types; len(types) != 1 || types[0].Values != 20 || types[0].Nulls != 20 {
+		t.Errorf("Expected all 20 values to be counted as nulls, got %+v", types)
+	}
+}
+
+func TestMaskRowKeepsUniqueFieldsUnique(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/names.txt", []byte("ann\nbob\ncy\ndee\neve"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfigurationFromJson(`{
+		"fields": [{"name": "Name", "type": "name", "unique": true}],
+		"types": {"name": {"loader": {"name": "csvloader", "args": {"src": "names.txt"}}}}
+	}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.Dir = dir
+
+	newMasker := func(mapping MaskMapping) *Masker {
+		masker, err := NewMasker(config, []byte("key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if mapping != nil {
+			if err := masker.UseMapping(mapping); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return masker
+	}
+
+	mask := func(masker *Masker, name string) (string, error) {
+		row := NewResultsRowFromValues(0, []string{"Name"}, []interface{}{name})
+		err := masker.MaskRow(row)
+
+		return row.Values[0].Value, err
+	}
+
+	names := []string{"Alice", "Brian", "Carol", "David", "Ellen"}
+
+	// without a mapping, the fake a colliding name got would depend on the names masked before it
+	unmapped := newMasker(nil)
+	defer unmapped.Close()
+
+	for _, name := range names {
+		if _, err = mask(unmapped, name); err != nil {
+			break
+		}
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "already given to another value") {
+		t.Errorf("Expected a collision without a mapping to be an error, got %v", err)
+	}
+
+	// five real names can only get the five fake ones if collisions are drawn again
+	mapping := make(MaskMapping)
+	masker := newMasker(mapping)
+	defer masker.Close()
+
+	fakes := make(map[string]string)
+	for _, name := range names {
+		fake, err := mask(masker, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if other, ok := fakes[fake]; ok {
+			t.Errorf("Expected '%s' and '%s' to get different fake names, got '%s' for both", other, name, fake)
+		}
+
+		fakes[fake] = name
+	}
+
+	// a later run with the mapping gives each name the same fake, whatever order they're masked in
+	later := newMasker(mapping)
+	defer later.Close()
+
+	for i := len(names) - 1; i >= 0; i-- {
+		if fake, _ := mask(later, names[i]); fakes[fake] != names[i] {
+			t.Errorf("Expected '%s' to get the fake name it got before, got '%s'", names[i], fake)
+		}
+	}
+
+	for hash := range mapping["Name"] {
+		if fakes[mapping["Name"][hash]] == hash {
+			t.Errorf("Expected the mapping to hold hashes rather than real names, got '%s'", hash)
+		}
+	}
+
+	if _, err := mask(later, "Frank"); err == nil || !strings.Contains(err.Error(), "no unique value") {
+		t.Errorf("Expected a sixth name to run out of fake ones, got %v", err)
+	}
+}
+
+func TestUniqueFieldsKeepTheirNullRateWhenNullsAreEmpty(t *testing.T) {
+	config, err := LoadConfigurationFromJson(`{
+		"rows": 200,
+		"options": {"seed": 3, "nulls": "empty"},
+		"fields": [{"name": "Code", "type": "code", "unique": true, "nullrate": 0.3}],
+		"types": {"code": {"loader": {"name": "number", "args": {"min": 1, "max": 1000000}}}}
+	}`)
+
+	if err != nil {
+		t.Fatalf("Error loading configuration: %s", err)
+	}
+
+	results, err := GenerateResults(config)
+	if err != nil {
+		t.Fatalf("Error generating results: %s", err)
+	}
+
+	// nulls written as empty values can repeat, like nulls
+	empty := 0
+	for _, row := range results.Rows {
+		if code, _ := row.Values.GetEntryWithName("Code"); code.Value == "" {
+			empty++
+		}
+	}
+
+	if empty < 40 || empty > 80 {
+		t.Errorf("Expected about 30%% of the codes to be empty, got %d of 200", empty)
+	}
+}
+
+func TestValuesAreWrittenAsTheirKinds(t *testing.T) {
+	config, err := LoadConfigurationFromJson(`{
+		"rows": 20,
+		"options": {"seed": 1, "nulls": "empty"},
+		"fields": [
+			{"name": "Age", "type": "age", "kind": "integer", "nullrate": 0.5},
+			{"name": "Tags", "type": "tags", "kind": "json", "nullrate": 0.5}
+		],
+		"types": {
+			"age": {"loader": {"name": "number", "args": {"min": 1, "max": 90}}},
+			"tags": {"loader": {"name": "choice", "args": {"values": ["[1]", "{\"a\": 2}"]}}}
+		}
+	}`)
+
+	if err != nil {
+		t.Fatalf("Error loading configuration: %s", err)
+	}
+
+	results, err := GenerateResults(config)
+	if err != nil {
+		t.Fatalf("Error generating results: %s", err)
+	}
+
+	// nulls written as empty values stay empty rather than becoming zeros
+	var rows []map[string]interface{}
+	if err := json.Unmarshal([]byte(GetOutputFormatter(config).Format(results)), &rows); err != nil {
+		t.Fatal(err)
+	}
+
+	empty := 0
+	for _, row := range rows {
+		if row["Age"] == "" {
+			empty++
+		} else if age, ok := row["Age"].(float64); !ok || age == 0 {
+			t.Errorf("Expected an age or an empty value, got %v", row["Age"])
+		}
+	}
+
+	if empty == 0 {
+		t.Errorf("Expected some ages to be empty")
+	}
+
+	for kind, value := range map[string]string{"json": "not json", "integer": "abc"} {
+		config, err := LoadConfigurationFromJson(fmt.Sprintf(`{
+			"rows": 1,
+			"fields": [{"name": "A", "type": "a", "kind": %q}],
+			"types": {"a": {"loader": {"name": "choice", "args": {"values": [%q]}}}}
+		}`, kind, value))
+
+		if err != nil {
+			t.Fatalf("Error loading configuration: %s", err)
+		}
+
+		if _, err := GenerateResults(config); err == nil || !strings.Contains(err.Error(), "the field's kind is "+kind) {
+			t.Errorf("Expected '%s' to be rejected for kind %s, got %v", value, kind, err)
+		}
+	}
+}
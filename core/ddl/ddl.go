@@ -0,0 +1,1068 @@
+// Package ddl parses the tables out of SQL CREATE TABLE statements, as written for PostgreSQL, MySQL, SQLite and SQL Server.
+package ddl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Table struct {
+	// name as written, without quotes, e.g. "public.users"
+	Name string
+
+	Columns    []*Column
+	PrimaryKey []string
+}
+
+type Column struct {
+	Name string
+
+	// lowercased type name without its params, e.g. "varchar", "double precision", "timestamp with time zone"
+	Type string
+
+	// params of the type, e.g. ["255"] for varchar(255) and ["10", "2"] for decimal(10,2)
+	Params []string
+
+	Unsigned bool
+	Array    bool
+
+	NotNull       bool
+	PrimaryKey    bool
+	Unique        bool
+	AutoIncrement bool
+
+	// computed columns are filled in by the database and can't be inserted into
+	Computed bool
+
+	// the default's expression as written, e.g. "'active'", "0" or "CURRENT_TIMESTAMP"
+	Default    string
+	HasDefault bool
+
+	// allowed values, from enum types and CHECK (col IN (...)) constraints
+	Enum []string
+
+	// bounds from CHECK constraints like CHECK (col >= 0) or CHECK (col BETWEEN 1 AND 5)
+	Min *float64
+	Max *float64
+
+	References *Reference
+}
+
+type Reference struct {
+	Table  string
+	Column string
+}
+
+// ShortName returns the table's name without its schema or database
+func (table *Table) ShortName() string {
+	return table.Name[strings.LastIndex(table.Name, ".")+1:]
+}
+
+// Column returns the column with the given name, ignoring case, or nil
+func (table *Table) Column(name string) *Column {
+	for _, column := range table.Columns {
+		if strings.EqualFold(column.Name, name) {
+			return column
+		}
+	}
+
+	return nil
+}
+
+// Parse returns the tables created by the CREATE TABLE statements in sql. Constraints added afterwards with
+// ALTER TABLE ... ADD are applied to their tables; other statements are ignored.
+func Parse(sql string) ([]*Table, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]*Table, 0)
+	byName := make(map[string]*Table)
+	enums := make(map[string][]string)
+
+	for _, statement := range splitStatements(tokens) {
+		p := &parser{tokens: statement}
+
+		switch {
+		case p.peekIs("CREATE", "TYPE"):
+			name, values, err := p.parseCreateEnum()
+			if err != nil {
+				return nil, err
+			}
+
+			if values != nil {
+				enums[strings.ToLower(name)] = values
+			}
+
+		case p.peekIs("CREATE"):
+			table, err := p.parseCreateTable()
+			if err != nil {
+				return nil, err
+			}
+
+			if table != nil {
+				tables = append(tables, table)
+				byName[strings.ToLower(table.Name)] = table
+			}
+
+		case p.peekIs("ALTER"):
+			if err := p.parseAlterTable(byName); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// columns of postgres enum types get the type's values
+	for _, table := range tables {
+		for _, column := range table.Columns {
+			if values, ok := enums[column.Type]; ok && column.Enum == nil {
+				column.Enum = values
+			}
+		}
+	}
+
+	return tables, nil
+}
+
+// splitStatements splits tokens on semicolons and on T-SQL's GO batch separator
+func splitStatements(tokens []token) [][]token {
+	statements := make([][]token, 0)
+	start := 0
+
+	flush := func(end int) {
+		if end > start {
+			statements = append(statements, tokens[start:end])
+		}
+	}
+
+	for i, t := range tokens {
+		isGo := t.is("GO") && (i == 0 || tokens[i-1].line < t.line) && (i+1 == len(tokens) || tokens[i+1].line > t.line)
+
+		if t.is(";") || isGo {
+			flush(i)
+			start = i + 1
+		}
+	}
+
+	flush(len(tokens))
+	return statements
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: tokenSymbol}
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *parser) peekIs(texts ...string) bool {
+	for i, text := range texts {
+		if p.pos+i >= len(p.tokens) || !p.tokens[p.pos+i].is(text) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+
+	return t
+}
+
+// accept consumes the given sequence of keywords if they're next
+func (p *parser) accept(texts ...string) bool {
+	if !p.peekIs(texts...) {
+		return false
+	}
+
+	p.pos += len(texts)
+	return true
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 0
+	if len(p.tokens) != 0 {
+		line = p.tokens[len(p.tokens)-1].line
+		if !p.done() {
+			line = p.peek().line
+		}
+	}
+
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		if p.done() {
+			return p.errorf("expected '%s' but the statement ended", text)
+		}
+
+		return p.errorf("expected '%s' but got '%s'", text, p.peek().text)
+	}
+
+	return nil
+}
+
+func (p *parser) parseName() (string, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenQuotedName {
+		return "", p.errorf("expected a name but got '%s'", t.text)
+	}
+
+	return t.text, nil
+}
+
+// parseQualifiedName parses a possibly qualified name like schema.table
+func (p *parser) parseQualifiedName() (string, error) {
+	parts := make([]string, 0, 1)
+
+	for {
+		name, err := p.parseName()
+		if err != nil {
+			return "", err
+		}
+
+		parts = append(parts, name)
+		if !p.accept(".") {
+			return strings.Join(parts, "."), nil
+		}
+	}
+}
+
+// parseNameList parses a parenthesised list of column names, dropping any sort order or length
+func (p *parser) parseNameList() ([]string, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, element := range p.splitGroup() {
+		if len(element) != 0 {
+			names = append(names, element[0].text)
+		}
+	}
+
+	return names, nil
+}
+
+// skipGroup skips a parenthesised group whose opening paren has been consumed, returning its tokens
+func (p *parser) skipGroup() []token {
+	start := p.pos
+	depth := 1
+
+	for !p.done() {
+		t := p.next()
+
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+			if depth == 0 {
+				return p.tokens[start : p.pos-1]
+			}
+		}
+	}
+
+	return p.tokens[start:]
+}
+
+// splitGroup skips a parenthesised group whose opening paren has been consumed, returning its comma separated elements
+func (p *parser) splitGroup() [][]token {
+	return splitTopLevel(p.skipGroup())
+}
+
+func splitTopLevel(tokens []token) [][]token {
+	elements := make([][]token, 0)
+	depth, start := 0, 0
+
+	for i, t := range tokens {
+		switch {
+		case t.is("("), t.is("["):
+			depth++
+		case t.is(")"), t.is("]"):
+			depth--
+		case t.is(",") && depth == 0:
+			elements = append(elements, tokens[start:i])
+			start = i + 1
+		}
+	}
+
+	if start < len(tokens) {
+		elements = append(elements, tokens[start:])
+	}
+
+	return elements
+}
+
+func (p *parser) parseCreateTable() (*Table, error) {
+	p.accept("CREATE")
+	p.accept("OR", "REPLACE")
+
+	for p.accept("TEMPORARY") || p.accept("TEMP") || p.accept("GLOBAL") || p.accept("LOCAL") || p.accept("UNLOGGED") {
+	}
+
+	if !p.accept("TABLE") {
+		// views, indexes, sequences, ...
+		return nil, nil
+	}
+
+	p.accept("IF", "NOT", "EXISTS")
+
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &Table{Name: name, Columns: make([]*Column, 0)}
+
+	if !p.accept("(") {
+		// CREATE TABLE ... AS SELECT and the like have no columns to read
+		return nil, nil
+	}
+
+	for _, element := range p.splitGroup() {
+		if len(element) == 0 {
+			continue
+		}
+
+		ep := &parser{tokens: element}
+		if ep.peekTableConstraint() {
+			if err := ep.parseTableConstraint(table); err != nil {
+				return nil, fmt.Errorf("Table '%s': %s", name, err)
+			}
+
+			continue
+		}
+
+		column, err := ep.parseColumn()
+		if err != nil {
+			return nil, fmt.Errorf("Table '%s': %s", name, err)
+		}
+
+		table.Columns = append(table.Columns, column)
+	}
+
+	for _, column := range table.Columns {
+		if column.PrimaryKey {
+			table.PrimaryKey = append(table.PrimaryKey, column.Name)
+		}
+	}
+
+	return table, nil
+}
+
+// parseCreateEnum parses postgres' CREATE TYPE name AS ENUM ('a', 'b'), returning nil values for other types
+func (p *parser) parseCreateEnum() (string, []string, error) {
+	p.accept("CREATE", "TYPE")
+
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !p.accept("AS", "ENUM") {
+		return name, nil, nil
+	}
+
+	if err := p.expect("("); err != nil {
+		return "", nil, err
+	}
+
+	values := make([]string, 0)
+	for _, t := range p.skipGroup() {
+		if t.kind == tokenString {
+			values = append(values, t.text)
+		}
+	}
+
+	// columns refer to the type without its schema
+	return name[strings.LastIndex(name, ".")+1:], values, nil
+}
+
+// parseAlterTable applies the constraints of an ALTER TABLE ... ADD statement, as written by pg_dump
+func (p *parser) parseAlterTable(tables map[string]*Table) error {
+	if !p.accept("ALTER", "TABLE") {
+		return nil
+	}
+
+	p.accept("IF", "EXISTS")
+	p.accept("ONLY")
+
+	name, err := p.parseQualifiedName()
+	if err != nil {
+		return err
+	}
+
+	table, ok := tables[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+
+	for _, action := range splitTopLevel(p.tokens[p.pos:]) {
+		ap := &parser{tokens: action}
+
+		switch {
+		case ap.accept("ADD"):
+			if ap.peekTableConstraint() {
+				if err := ap.parseTableConstraint(table); err != nil {
+					return fmt.Errorf("Table '%s': %s", name, err)
+				}
+			}
+
+		case ap.accept("ALTER"):
+			// ALTER COLUMN id SET DEFAULT nextval('users_id_seq'::regclass)
+			ap.accept("COLUMN")
+
+			column := table.Column(ap.next().text)
+			if column != nil && ap.accept("SET", "DEFAULT") {
+				column.setDefault(ap.tokens[ap.pos:])
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) peekTableConstraint() bool {
+	for _, keyword := range []string{"CONSTRAINT", "PRIMARY", "FOREIGN", "CHECK", "KEY", "INDEX", "FULLTEXT", "SPATIAL", "EXCLUDE"} {
+		if p.peekIs(keyword) {
+			return true
+		}
+	}
+
+	// a column could be called "unique", but then it would be followed by its type rather than a column list or KEY
+	return p.peekIs("UNIQUE") && (p.peekIs("UNIQUE", "(") || p.peekIs("UNIQUE", "KEY") || p.peekIs("UNIQUE", "INDEX") ||
+		p.peekIs("UNIQUE", "CLUSTERED") || p.peekIs("UNIQUE", "NONCLUSTERED") || p.pos+2 < len(p.tokens) && p.tokens[p.pos+2].is("("))
+}
+
+func (p *parser) parseTableConstraint(table *Table) error {
+	if p.accept("CONSTRAINT") {
+		if _, err := p.parseName(); err != nil {
+			return err
+		}
+	}
+
+	// skip the optional index name and index type between a keyword and its column list
+	skipToColumns := func() {
+		for !p.done() && !p.peekIs("(") {
+			p.next()
+		}
+	}
+
+	switch {
+	case p.accept("PRIMARY", "KEY"):
+		skipToColumns()
+
+		columns, err := p.parseNameList()
+		if err != nil {
+			return err
+		}
+
+		table.PrimaryKey = columns
+		for _, name := range columns {
+			if column := table.Column(name); column != nil {
+				column.PrimaryKey = true
+				column.NotNull = true
+			}
+		}
+
+		// a single column primary key is also unique
+		if len(columns) == 1 {
+			if column := table.Column(columns[0]); column != nil {
+				column.Unique = true
+			}
+		}
+
+	case p.accept("UNIQUE"):
+		skipToColumns()
+
+		columns, err := p.parseNameList()
+		if err != nil {
+			return err
+		}
+
+		// a unique combination of columns doesn't make any one of them unique
+		if len(columns) == 1 {
+			if column := table.Column(columns[0]); column != nil {
+				column.Unique = true
+			}
+		}
+
+	case p.accept("FOREIGN", "KEY"):
+		columns, err := p.parseNameList()
+		if err != nil {
+			return err
+		}
+
+		if err := p.expect("REFERENCES"); err != nil {
+			return err
+		}
+
+		reference, refColumns, err := p.parseReference()
+		if err != nil {
+			return err
+		}
+
+		for i, name := range columns {
+			column := table.Column(name)
+			if column == nil {
+				continue
+			}
+
+			column.References = &Reference{Table: reference}
+			if i < len(refColumns) {
+				column.References.Column = refColumns[i]
+			}
+		}
+
+	case p.accept("CHECK"):
+		if err := p.expect("("); err != nil {
+			return err
+		}
+
+		applyCheck(table, p.skipGroup())
+	}
+
+	return nil
+}
+
+// parseReference parses the table and optional column list after REFERENCES, skipping any ON DELETE/UPDATE actions
+func (p *parser) parseReference() (string, []string, error) {
+	table, err := p.parseQualifiedName()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if !p.peekIs("(") {
+		return table, nil, nil
+	}
+
+	columns, err := p.parseNameList()
+	return table, columns, err
+}
+
+// keywords that end a column's type and start its constraints
+var columnConstraintKeywords = []string{
+	"NOT", "NULL", "PRIMARY", "UNIQUE", "DEFAULT", "CHECK", "REFERENCES", "CONSTRAINT", "AUTO_INCREMENT", "AUTOINCREMENT",
+	"IDENTITY", "GENERATED", "COLLATE", "COMMENT", "ON", "AS", "ENCODE", "STORAGE", "COMPRESSION", "ROWGUIDCOL", "SPARSE",
+}
+
+func (p *parser) atColumnConstraint() bool {
+	if p.peekIs("CHARACTER", "SET") || p.peekIs("CHARSET") {
+		return true
+	}
+
+	for _, keyword := range columnConstraintKeywords {
+		if p.peekIs(keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *parser) parseColumn() (*Column, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	column := &Column{Name: name}
+
+	// sql server's computed columns have no type: total AS (price * quantity)
+	if p.peekIs("AS") {
+		column.Computed = true
+		return column, nil
+	}
+
+	if err := p.parseType(column); err != nil {
+		return nil, fmt.Errorf("column '%s': %s", name, err)
+	}
+
+	for !p.done() {
+		switch {
+		case p.accept("CONSTRAINT"):
+			p.next()
+
+		case p.accept("NOT", "NULL"):
+			column.NotNull = true
+
+		case p.accept("NULL"):
+
+		case p.accept("PRIMARY", "KEY"):
+			column.PrimaryKey = true
+			column.NotNull = true
+			column.Unique = true
+
+			p.accept("ASC")
+			p.accept("DESC")
+			p.accept("CLUSTERED")
+			p.accept("NONCLUSTERED")
+
+		case p.accept("UNIQUE"):
+			column.Unique = true
+
+			p.accept("KEY")
+			p.accept("CLUSTERED")
+			p.accept("NONCLUSTERED")
+
+		case p.accept("AUTO_INCREMENT"), p.accept("AUTOINCREMENT"):
+			column.AutoIncrement = true
+
+		case p.accept("IDENTITY"):
+			column.AutoIncrement = true
+			if p.accept("(") {
+				p.skipGroup()
+			}
+
+		case p.accept("GENERATED"):
+			// GENERATED {ALWAYS | BY DEFAULT} AS IDENTITY [(...)] or GENERATED ALWAYS AS (expr) [STORED | VIRTUAL]
+			p.accept("ALWAYS")
+			p.accept("BY", "DEFAULT")
+			p.accept("ON", "NULL")
+
+			if err := p.expect("AS"); err != nil {
+				return nil, fmt.Errorf("column '%s': %s", name, err)
+			}
+
+			if p.accept("IDENTITY") {
+				column.AutoIncrement = true
+			} else {
+				column.Computed = true
+			}
+
+			if p.accept("(") {
+				p.skipGroup()
+			}
+
+		case p.accept("AS"):
+			// mysql's generated columns: total DECIMAL(10,2) AS (price * quantity)
+			column.Computed = true
+			if p.accept("(") {
+				p.skipGroup()
+			}
+
+		case p.accept("DEFAULT"):
+			start := p.pos
+			p.skipExpression()
+			column.setDefault(p.tokens[start:p.pos])
+
+		case p.accept("CHECK"):
+			if err := p.expect("("); err != nil {
+				return nil, fmt.Errorf("column '%s': %s", name, err)
+			}
+
+			applyCheckToColumn(column, p.skipGroup())
+
+		case p.accept("REFERENCES"):
+			table, columns, err := p.parseReference()
+			if err != nil {
+				return nil, fmt.Errorf("column '%s': %s", name, err)
+			}
+
+			column.References = &Reference{Table: table}
+			if len(columns) != 0 {
+				column.References.Column = columns[0]
+			}
+
+		case p.accept("ON"):
+			// ON UPDATE CURRENT_TIMESTAMP, ON DELETE CASCADE, ...
+			p.next()
+			p.skipExpression()
+
+		default:
+			// COLLATE x, COMMENT 'x', CHARACTER SET x and anything else we don't know about
+			p.next()
+		}
+	}
+
+	return column, nil
+}
+
+// skipExpression skips a single value or parenthesised expression, along with any function call arguments
+// and casts, stopping at the next constraint keyword
+func (p *parser) skipExpression() {
+	for !p.done() {
+		switch {
+		case p.accept("("):
+			p.skipGroup()
+		case p.accept("::"):
+			p.next()
+			if p.accept("(") {
+				p.skipGroup()
+			}
+		case p.atColumnConstraint():
+			return
+		default:
+			p.next()
+		}
+	}
+}
+
+// multi-word type names, longest first, and the words that can follow a type name
+var typeSuffixes = [][]string{
+	{"VARYING"},
+	{"PRECISION"},
+	{"WITH", "TIME", "ZONE"},
+	{"WITHOUT", "TIME", "ZONE"},
+	{"LARGE", "OBJECT"},
+}
+
+func (p *parser) parseType(column *Column) error {
+	if p.done() {
+		// sqlite allows columns without a type
+		return nil
+	}
+
+	first := p.next()
+	if first.kind != tokenWord && first.kind != tokenQuotedName {
+		return p.errorf("expected a type but got '%s'", first.text)
+	}
+
+	words := []string{strings.ToLower(first.text)}
+
+	// qualified types like pg_catalog.int4 or public.mood
+	for p.accept(".") {
+		words = []string{strings.ToLower(p.next().text)}
+	}
+
+	for {
+		if p.accept("(") {
+			group := p.skipGroup()
+			column.Params = column.Params[:0]
+
+			for _, element := range splitTopLevel(group) {
+				parts := make([]string, len(element))
+				for i, t := range element {
+					parts[i] = t.text
+				}
+
+				column.Params = append(column.Params, strings.Join(parts, " "))
+			}
+
+			continue
+		}
+
+		if p.accept("[") {
+			column.Array = true
+			for !p.done() && !p.accept("]") {
+				p.next()
+			}
+
+			continue
+		}
+
+		if p.accept("UNSIGNED") {
+			column.Unsigned = true
+			continue
+		}
+
+		if p.accept("SIGNED") || p.accept("ZEROFILL") || p.accept("BINARY") {
+			continue
+		}
+
+		if p.accept("ARRAY") {
+			column.Array = true
+			continue
+		}
+
+		matched := false
+		for _, suffix := range typeSuffixes {
+			if p.accept(suffix...) {
+				words = append(words, strings.ToLower(strings.Join(suffix, " ")))
+				matched = true
+				break
+			}
+		}
+
+		// two word types like "double precision" and "character varying" have no keyword between their words
+		if !matched && !p.done() && p.peek().kind == tokenWord && !p.atColumnConstraint() && len(words) == 1 && isTypePrefix(words[0]) {
+			words = append(words, strings.ToLower(p.next().text))
+			matched = true
+		}
+
+		if !matched {
+			break
+		}
+	}
+
+	column.Type = strings.Join(words, " ")
+
+	// mysql's ENUM('a', 'b') and SET('a', 'b') list their values as params
+	if column.Type == "enum" || column.Type == "set" {
+		column.Enum = make([]string, len(column.Params))
+		for i, param := range column.Params {
+			column.Enum[i] = param
+		}
+	}
+
+	return nil
+}
+
+// type names that can be followed by a second word
+func isTypePrefix(word string) bool {
+	switch word {
+	case "double", "long", "national", "native", "character", "char", "bit", "nchar":
+		return true
+	}
+
+	return false
+}
+
+// setDefault records the default expression and picks up auto increment defaults like nextval('seq')
+func (column *Column) setDefault(tokens []token) {
+	parts := make([]string, 0, len(tokens))
+
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenString:
+			parts = append(parts, "'"+strings.Replace(t.text, "'", "''", -1)+"'")
+		default:
+			parts = append(parts, t.text)
+		}
+	}
+
+	column.Default = strings.Join(parts, " ")
+	column.HasDefault = true
+
+	if len(tokens) != 0 && (tokens[0].is("nextval") || tokens[0].is("AUTOINCREMENT")) {
+		column.AutoIncrement = true
+	}
+}
+
+// DefaultValue returns the default's value if it's a literal string or number, unwrapping parens and casts
+// like ('active'::text) and ((0))
+func (column *Column) DefaultValue() (string, bool) {
+	if !column.HasDefault {
+		return "", false
+	}
+
+	tokens, err := tokenize(column.Default)
+	if err != nil {
+		return "", false
+	}
+
+	for len(tokens) >= 2 && tokens[0].is("(") && tokens[len(tokens)-1].is(")") {
+		tokens = tokens[1 : len(tokens)-1]
+	}
+
+	// drop casts
+	for i, t := range tokens {
+		if t.is("::") {
+			tokens = tokens[:i]
+			break
+		}
+	}
+
+	if len(tokens) == 2 && tokens[0].is("-") && tokens[1].kind == tokenNumber {
+		return "-" + tokens[1].text, true
+	}
+
+	if len(tokens) != 1 {
+		return "", false
+	}
+
+	switch {
+	case tokens[0].kind == tokenString, tokens[0].kind == tokenNumber:
+		return tokens[0].text, true
+	case tokens[0].is("TRUE"), tokens[0].is("FALSE"):
+		return strings.ToLower(tokens[0].text), true
+	}
+
+	return "", false
+}
+
+// applyCheck applies a table CHECK constraint to the columns it names
+func applyCheck(table *Table, tokens []token) {
+	for _, condition := range splitConditions(tokens) {
+		name := checkedColumn(condition)
+		if column := table.Column(name); column != nil {
+			applyCondition(column, condition)
+		}
+	}
+}
+
+// applyCheckToColumn applies a column CHECK constraint, which may only name its own column
+func applyCheckToColumn(column *Column, tokens []token) {
+	for _, condition := range splitConditions(tokens) {
+		if strings.EqualFold(checkedColumn(condition), column.Name) {
+			applyCondition(column, condition)
+		}
+	}
+}
+
+// splitConditions splits a check's expression on its top-level ANDs, leaving BETWEEN's AND alone
+func splitConditions(tokens []token) [][]token {
+	for len(tokens) >= 2 && tokens[0].is("(") && tokens[len(tokens)-1].is(")") && closes(tokens) {
+		tokens = tokens[1 : len(tokens)-1]
+	}
+
+	conditions := make([][]token, 0)
+	depth, start, between := 0, 0, false
+
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+		case t.is("BETWEEN") && depth == 0:
+			between = true
+		case t.is("AND") && depth == 0:
+			if between {
+				between = false
+				continue
+			}
+
+			conditions = append(conditions, stripParens(tokens[start:i]))
+			start = i + 1
+		case t.is("OR") && depth == 0:
+			// alternatives can't be mapped to a single range or list
+			return nil
+		}
+	}
+
+	return append(conditions, stripParens(tokens[start:]))
+}
+
+// closes reports whether the first token's paren is closed by the last token
+func closes(tokens []token) bool {
+	depth := 0
+	for i, t := range tokens {
+		switch {
+		case t.is("("):
+			depth++
+		case t.is(")"):
+			depth--
+			if depth == 0 {
+				return i == len(tokens)-1
+			}
+		}
+	}
+
+	return false
+}
+
+func stripParens(tokens []token) []token {
+	for len(tokens) >= 2 && tokens[0].is("(") && tokens[len(tokens)-1].is(")") && closes(tokens) {
+		tokens = tokens[1 : len(tokens)-1]
+	}
+
+	return tokens
+}
+
+// checkedColumn returns the name of the column a condition constrains, unwrapping pg_dump's ((status)::text = ...)
+func checkedColumn(condition []token) string {
+	for len(condition) != 0 && condition[0].is("(") {
+		condition = condition[1:]
+	}
+
+	if len(condition) == 0 || (condition[0].kind != tokenWord && condition[0].kind != tokenQuotedName) {
+		return ""
+	}
+
+	return condition[0].text
+}
+
+// applyCondition reads the column's allowed values or bounds out of conditions like status IN ('a', 'b'),
+// (status)::text = ANY ((ARRAY['a'::text, 'b'::text])), age >= 18 and age BETWEEN 18 AND 90
+func applyCondition(column *Column, condition []token) {
+	// skip the column, and any parens and casts around it
+	i := 0
+	for i < len(condition) && (condition[i].is("(") || condition[i].is(")") || condition[i].kind == tokenWord && strings.EqualFold(condition[i].text, column.Name) || condition[i].kind == tokenQuotedName) {
+		i++
+	}
+
+	for i < len(condition) && condition[i].is("::") {
+		i += 2
+		for i < len(condition) && condition[i].is(")") {
+			i++
+		}
+	}
+
+	if i >= len(condition) {
+		return
+	}
+
+	rest := condition[i+1:]
+
+	switch op := condition[i]; {
+	case op.is("IN"), op.is("=") && len(rest) != 0 && rest[0].is("ANY"):
+		values := make([]string, 0)
+		for _, t := range rest {
+			if t.kind == tokenString || t.kind == tokenNumber {
+				values = append(values, t.text)
+			}
+		}
+
+		if len(values) != 0 {
+			column.Enum = values
+		}
+
+	case op.is("BETWEEN"):
+		numbers := numbersIn(rest)
+		if len(numbers) == 2 {
+			column.Min, column.Max = &numbers[0], &numbers[1]
+		}
+
+	case op.is(">="), op.is(">"), op.is("<="), op.is("<"):
+		numbers := numbersIn(rest)
+		if len(numbers) != 1 {
+			return
+		}
+
+		bound := numbers[0]
+		switch {
+		case op.is(">"):
+			bound++
+		case op.is("<"):
+			bound--
+		}
+
+		if op.is(">=") || op.is(">") {
+			column.Min = &bound
+		} else {
+			column.Max = &bound
+		}
+	}
+}
+
+// numbersIn returns the numbers among tokens, keeping their signs
+func numbersIn(tokens []token) []float64 {
+	numbers := make([]float64, 0)
+
+	for i, t := range tokens {
+		if t.kind != tokenNumber {
+			continue
+		}
+
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			continue
+		}
+
+		if i > 0 && tokens[i-1].is("-") {
+			n = -n
+		}
+
+		numbers = append(numbers, n)
+	}
+
+	return numbers
+}
@@ -0,0 +1,123 @@
+package ddl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsesColumnsAndConstraintsAcrossDialects(t *testing.T) {
+	sql := `
+-- postgres
+CREATE TYPE mood AS ENUM ('happy', 'sad');
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    email character varying(255) NOT NULL,
+    mood mood,
+    balance numeric(10,2) DEFAULT 0 NOT NULL,
+    status text DEFAULT 'active'::text,
+    CONSTRAINT users_status_check CHECK (((status)::text = ANY ((ARRAY['active'::character varying, 'banned'::character varying])::text[])))
+);
+ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('users_id_seq'::regclass);
+ALTER TABLE ONLY public.users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+/* mysql */
+CREATE TABLE ` + "`orders`" + ` (
+  ` + "`id`" + ` int(11) unsigned NOT NULL AUTO_INCREMENT,
+  ` + "`user_id`" + ` int NOT NULL,
+  ` + "`size`" + ` enum('S','M') NOT NULL DEFAULT 'M',
+  ` + "`total`" + ` decimal(8,2) AS (price * quantity),
+  PRIMARY KEY (` + "`id`" + `),
+  CONSTRAINT ` + "`fk`" + ` FOREIGN KEY (` + "`user_id`" + `) REFERENCES ` + "`users`" + ` (` + "`id`" + `) ON DELETE CASCADE
+) ENGINE=InnoDB;
+
+CREATE TABLE notes (id INTEGER PRIMARY KEY AUTOINCREMENT, body, priority INT CHECK (priority BETWEEN 1 AND 5));
+
+CREATE TABLE [dbo].[Accounts](
+	[AccountId] [int] IDENTITY(1,1) NOT NULL,
+	[Kind] [nvarchar](10) NOT NULL CONSTRAINT [DF_Kind] DEFAULT (N'basic'),
+	CONSTRAINT [PK_Accounts] PRIMARY KEY CLUSTERED ([AccountId] ASC),
+	CONSTRAINT [CK_Kind] CHECK ([Kind] IN (N'basic', N'pro'))
+) ON [PRIMARY]
+GO
+`
+
+	tables, err := Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = table.Name
+	}
+
+	if !reflect.DeepEqual(names, []string{"public.users", "orders", "notes", "dbo.Accounts"}) {
+		t.Fatalf("unexpected tables %v", names)
+	}
+
+	users, orders, notes, accounts := tables[0], tables[1], tables[2], tables[3]
+
+	if id := users.Column("id"); !id.AutoIncrement || !id.NotNull {
+		t.Errorf("expected users.id to be a not null auto increment column: %+v", id)
+	}
+
+	if email := users.Column("email"); email.Type != "character varying" || !reflect.DeepEqual(email.Params, []string{"255"}) || !email.Unique {
+		t.Errorf("unexpected users.email: %+v", email)
+	}
+
+	if mood := users.Column("mood"); !reflect.DeepEqual(mood.Enum, []string{"happy", "sad"}) {
+		t.Errorf("expected users.mood to get the enum type's values: %+v", mood)
+	}
+
+	if balance := users.Column("balance"); balance.Type != "numeric" || !reflect.DeepEqual(balance.Params, []string{"10", "2"}) {
+		t.Errorf("unexpected users.balance: %+v", balance)
+	}
+
+	status := users.Column("status")
+	if !reflect.DeepEqual(status.Enum, []string{"active", "banned"}) {
+		t.Errorf("expected users.status to get the check's values: %+v", status)
+	}
+
+	if value, ok := status.DefaultValue(); !ok || value != "active" {
+		t.Errorf("expected users.status to default to 'active', got '%s'", value)
+	}
+
+	if id := orders.Column("id"); !id.AutoIncrement || !id.Unsigned || !id.PrimaryKey {
+		t.Errorf("unexpected orders.id: %+v", id)
+	}
+
+	if ref := orders.Column("user_id").References; ref == nil || ref.Table != "users" || ref.Column != "id" {
+		t.Errorf("unexpected orders.user_id reference: %+v", ref)
+	}
+
+	if size := orders.Column("size"); !reflect.DeepEqual(size.Enum, []string{"S", "M"}) {
+		t.Errorf("unexpected orders.size: %+v", size)
+	}
+
+	if total := orders.Column("total"); !total.Computed {
+		t.Errorf("expected orders.total to be computed: %+v", total)
+	}
+
+	if body := notes.Column("body"); body == nil || body.Type != "" {
+		t.Errorf("expected notes.body to have no type: %+v", body)
+	}
+
+	if priority := notes.Column("priority"); priority.Min == nil || *priority.Min != 1 || priority.Max == nil || *priority.Max != 5 {
+		t.Errorf("expected notes.priority to be between 1 and 5: %+v", priority)
+	}
+
+	if id := accounts.Column("AccountId"); !id.AutoIncrement || !id.PrimaryKey || id.Type != "int" {
+		t.Errorf("unexpected Accounts.AccountId: %+v", id)
+	}
+
+	if kind := accounts.Column("Kind"); !reflect.DeepEqual(kind.Enum, []string{"basic", "pro"}) {
+		t.Errorf("unexpected Accounts.Kind: %+v", kind)
+	}
+}
+
+func TestParseReportsTheLineOfAnError(t *testing.T) {
+	_, err := Parse("CREATE TABLE users (\n  id int,\n  name varchar(10) CHECK 'x'\n);")
+	if err == nil || err.Error() != "Table 'users': column 'name': line 3: expected '(' but got 'x'" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package ddl
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenQuotedName
+	tokenString
+	tokenNumber
+	tokenSymbol
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// is reports whether the token is the given keyword or symbol, ignoring case; quoted names are never keywords
+func (t token) is(text string) bool {
+	return (t.kind == tokenWord || t.kind == tokenSymbol) && strings.EqualFold(t.text, text)
+}
+
+// tokenize splits sql into tokens, dropping whitespace and comments. Quoted names ("x", `x`, [x]) and
+// strings ('x', N'x', E'x') are unquoted.
+func tokenize(sql string) ([]token, error) {
+	tokens := make([]token, 0)
+	runes := []rune(sql)
+	line := 1
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case unicode.IsSpace(c):
+			i++
+
+		// -- and # comments run to the end of the line
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-', c == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated comment", start)
+			}
+			i += 2
+
+		case c == '\'', (c == 'N' || c == 'n' || c == 'E' || c == 'e') && i+1 < len(runes) && runes[i+1] == '\'':
+			if c != '\'' {
+				i++
+			}
+
+			text, next, lines, err := readQuoted(runes, i, '\'')
+			if err != nil {
+				return nil, fmt.Errorf("line %d: unterminated string", line)
+			}
+
+			tokens = append(tokens, token{kind: tokenString, text: text, line: line})
+			line += lines
+			i = next
+
+		// a [ straight after a name is an array subscript, like text[] or ARRAY['a'], rather than a quoted name
+		case c == '"' || c == '`' || c == '[' && !(i > 0 && (unicode.IsLetter(runes[i-1]) || unicode.IsDigit(runes[i-1]) || runes[i-1] == '_')):
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+
+			text, next, lines, err := readQuoted(runes, i, end)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: unterminated quoted name", line)
+			}
+
+			tokens = append(tokens, token{kind: tokenQuotedName, text: text, line: line})
+			line += lines
+			i = next
+
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				((runes[i] == '-' || runes[i] == '+') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[start:i]), line: line})
+
+		case unicode.IsLetter(c) || c == '_' || c == '@' || c == '$':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$' || runes[i] == '@') {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[start:i]), line: line})
+
+		case c == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			tokens = append(tokens, token{kind: tokenSymbol, text: "::", line: line})
+			i += 2
+
+		case (c == '<' || c == '>' || c == '!') && i+1 < len(runes) && (runes[i+1] == '=' || runes[i+1] == '>'):
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(runes[i : i+2]), line: line})
+			i += 2
+
+		default:
+			tokens = append(tokens, token{kind: tokenSymbol, text: string(c), line: line})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+// readQuoted reads the quoted text starting at runes[start], where a doubled end quote is an escaped quote
+func readQuoted(runes []rune, start int, end rune) (string, int, int, error) {
+	var builder strings.Builder
+	lines := 0
+
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == end {
+			if i+1 < len(runes) && runes[i+1] == end {
+				builder.WriteRune(end)
+				i++
+				continue
+			}
+
+			return builder.String(), i + 1, lines, nil
+		}
+
+		if runes[i] == '\n' {
+			lines++
+		}
+
+		builder.WriteRune(runes[i])
+	}
+
+	return "", 0, 0, fmt.Errorf("unterminated")
+}
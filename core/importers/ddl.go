@@ -0,0 +1,516 @@
+// Package importers builds configurations from existing descriptions of data, like SQL DDL.
+package importers
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/ddl"
+)
+
+type DDLOptions struct {
+	// rows to generate for each table; foreign keys to generated ids are kept within this many rows
+	Rows int
+
+	// directory of the csv data files, as it should be written in csvloader srcs
+	DataDir string
+
+	// nullrate given to nullable columns
+	NullRate float64
+}
+
+// ConfigurationsFromDDL returns a configuration with sql output for each table
+func ConfigurationsFromDDL(tables []*ddl.Table, options DDLOptions) []*conf.Configuration {
+	configs := make([]*conf.Configuration, len(tables))
+
+	byName := make(map[string]*ddl.Table)
+	for _, table := range tables {
+		byName[strings.ToLower(table.Name)] = table
+		byName[strings.ToLower(table.ShortName())] = table
+	}
+
+	for i, table := range tables {
+		config := &conf.Configuration{
+			Name:       table.Name,
+			OutputType: conf.SQL,
+			NumRows:    options.Rows,
+			Options:    conf.Options{},
+			Fields:     conf.NewConfigurationFields(),
+			Types:      make(map[string]conf.UseTypeDTO),
+		}
+
+		m := &ddlMapper{options: options, tables: byName, config: config}
+		for _, column := range table.Columns {
+			if column.Computed {
+				continue
+			}
+
+			m.addColumn(table, column)
+		}
+
+		configs[i] = config
+	}
+
+	return configs
+}
+
+type ddlMapper struct {
+	options DDLOptions
+	tables  map[string]*ddl.Table
+	config  *conf.Configuration
+}
+
+func (m *ddlMapper) addColumn(table *ddl.Table, column *ddl.Column) {
+	name, t := m.typeFor(table, column)
+
+	field := &conf.ConfigurationField{Name: column.Name, Type: addType(m.config, name, t)}
+
+	// autoincrement values are unique already
+	if column.Unique && t.LoaderArgs.Name != "autoincrement" {
+		field.Unique = true
+	}
+
+	if !column.NotNull && !column.PrimaryKey {
+		field.NullRate = m.options.NullRate
+	}
+
+	m.config.Fields = append(m.config.Fields, field)
+}
+
+// addType adds t to the config's types under name, or a numbered variant of name if a different type already has it
+func addType(config *conf.Configuration, name string, t conf.UseTypeDTO) string {
+	candidate := name
+	for n := 2; ; n++ {
+		existing, ok := config.Types[candidate]
+		if !ok {
+			config.Types[candidate] = t
+			return candidate
+		}
+
+		if reflect.DeepEqual(existing, t) {
+			return candidate
+		}
+
+		candidate = fmt.Sprintf("%s_%d", name, n)
+	}
+}
+
+func loaderType(name string, args map[string]interface{}) conf.UseTypeDTO {
+	return conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: name, Args: args}}
+}
+
+// typeFor picks a type name and type for the column, from its constraints, its name and its sql type, in that order
+func (m *ddlMapper) typeFor(table *ddl.Table, column *ddl.Column) (string, conf.UseTypeDTO) {
+	typeName := strings.ToLower(column.Name)
+	sqlType := column.Type
+
+	if column.AutoIncrement || (isIntegerType(sqlType) && column.PrimaryKey && len(table.PrimaryKey) == 1 && column.References == nil) {
+		return "id", loaderType("autoincrement", nil)
+	}
+
+	if len(column.Enum) != 0 {
+		return typeName, m.choiceType(column, column.Enum)
+	}
+
+	if t, ok := m.referenceType(column); ok {
+		return typeName, t
+	}
+
+	// postgres array literals; an empty array is valid whatever the element type
+	if column.Array {
+		return typeName, loaderType("choice", map[string]interface{}{"values": []string{"{}"}})
+	}
+
+	if isBoolType(column) {
+		values := []string{"true", "false"}
+		if sqlType != "bool" && sqlType != "boolean" {
+			values = []string{"1", "0"}
+		}
+
+		return typeName, m.choiceType(column, values)
+	}
+
+	if isTextType(sqlType) {
+		if name, t, ok := m.heuristicType(column); ok {
+			return name, t
+		}
+	}
+
+	return typeName, m.sqlType(column)
+}
+
+// choiceType picks from values, favouring a default among them
+func (m *ddlMapper) choiceType(column *ddl.Column, values []string) conf.UseTypeDTO {
+	args := map[string]interface{}{"values": values}
+
+	if def, ok := column.DefaultValue(); ok && len(values) > 1 {
+		weights := make([]float64, len(values))
+		found := false
+
+		for i, value := range values {
+			weights[i] = 1
+			if value == def {
+				weights[i] = 3
+				found = true
+			}
+		}
+
+		if found {
+			args["weights"] = weights
+		}
+	}
+
+	return loaderType("choice", args)
+}
+
+// referenceType keeps foreign keys to another table's generated ids within the ids that table generates
+func (m *ddlMapper) referenceType(column *ddl.Column) (conf.UseTypeDTO, bool) {
+	if column.References == nil {
+		return conf.UseTypeDTO{}, false
+	}
+
+	table, ok := m.tables[strings.ToLower(column.References.Table)]
+	if !ok {
+		return conf.UseTypeDTO{}, false
+	}
+
+	var referenced *ddl.Column
+	if column.References.Column != "" {
+		referenced = table.Column(column.References.Column)
+	} else if len(table.PrimaryKey) == 1 {
+		referenced = table.Column(table.PrimaryKey[0])
+	}
+
+	if referenced == nil || !isIntegerType(referenced.Type) || !(referenced.AutoIncrement || referenced.PrimaryKey && len(table.PrimaryKey) == 1) {
+		return conf.UseTypeDTO{}, false
+	}
+
+	// a unique reference is one-to-one, so give each row its own id in turn
+	if column.Unique {
+		return loaderType("autoincrement", nil), true
+	}
+
+	return loaderType("number", map[string]interface{}{"min": 1, "max": m.options.Rows}), true
+}
+
+// a data file, the name of its type and the length of its longest value, so it's only used for columns that can hold its values
+type dataFile struct {
+	file      string
+	typeName  string
+	maxLength int
+}
+
+// column names (lowercased, without separators) that are filled from the data/ files
+var dataFileColumns = map[string]dataFile{
+	"firstname":     {"firstnames.csv", "firstname", 11},
+	"fname":         {"firstnames.csv", "firstname", 11},
+	"givenname":     {"firstnames.csv", "firstname", 11},
+	"forename":      {"firstnames.csv", "firstname", 11},
+	"lastname":      {"lastnames.csv", "lastname", 13},
+	"lname":         {"lastnames.csv", "lastname", 13},
+	"surname":       {"lastnames.csv", "lastname", 13},
+	"familyname":    {"lastnames.csv", "lastname", 13},
+	"city":          {"cities.csv", "city", 16},
+	"town":          {"cities.csv", "city", 16},
+	"state":         {"states.csv", "state", 2},
+	"statecode":     {"states.csv", "state", 2},
+	"zip":           {"zipcodes.csv", "zipcode", 5},
+	"zipcode":       {"zipcodes.csv", "zipcode", 5},
+	"postalcode":    {"zipcodes.csv", "zipcode", 5},
+	"postcode":      {"zipcodes.csv", "zipcode", 5},
+	"company":       {"companies.csv", "company", 33},
+	"companyname":   {"companies.csv", "company", 33},
+	"employer":      {"companies.csv", "company", 33},
+	"organization":  {"companies.csv", "company", 33},
+	"address":       {"addresses.csv", "address", 26},
+	"address1":      {"addresses.csv", "address", 26},
+	"addressline1":  {"addresses.csv", "address", 26},
+	"street":        {"addresses.csv", "address", 26},
+	"streetaddress": {"addresses.csv", "address", 26},
+	"domain":        {"domains.csv", "domain", 23},
+	"website":       {"domains.csv", "domain", 23},
+	"url":           {"domains.csv", "domain", 23},
+	"homepage":      {"domains.csv", "domain", 23},
+}
+
+// normalizeName lowercases a column or property name and drops separators, so first_name, firstName and
+// first-name are all "firstname"
+func normalizeName(name string) string {
+	return strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(name))
+}
+
+// dataFileType picks a csvloader type over a data/ file for well-known names, if the file's values fit in length
+func dataFileType(name string, length int, hasLength bool, dataDir string) (string, conf.UseTypeDTO, bool) {
+	data, ok := dataFileColumns[normalizeName(name)]
+	if !ok || hasLength && length < data.maxLength {
+		return "", conf.UseTypeDTO{}, false
+	}
+
+	return data.typeName, loaderType("csvloader", map[string]interface{}{"src": path.Join(dataDir, data.file)}), true
+}
+
+// heuristicType picks a type for text columns with well-known names, like first_name, email or created_at
+func (m *ddlMapper) heuristicType(column *ddl.Column) (string, conf.UseTypeDTO, bool) {
+	lower := strings.ToLower(column.Name)
+	normalized := normalizeName(lower)
+	length, hasLength := textLength(column)
+
+	if name, t, ok := dataFileType(column.Name, length, hasLength, m.options.DataDir); ok {
+		return name, t, true
+	}
+
+	switch {
+	case strings.Contains(normalized, "email"):
+		first, last := m.fieldWithType("firstname"), m.fieldWithType("lastname")
+		if first != "" && last != "" && (!hasLength || length >= 40) {
+			return "email", loaderType("strformat", map[string]interface{}{"format": "%s.%s@mailinator.com", "args": []string{first, last}}), true
+		}
+
+		max := 12
+		if hasLength && length-len("@example.com") < max {
+			max = length - len("@example.com")
+		}
+
+		if max >= 1 {
+			return "email", loaderType("text", map[string]interface{}{"charset": "lower", "minlength": 1 + (max-1)/2, "maxlength": max, "suffix": "@example.com"}), true
+		}
+
+	case strings.Contains(normalized, "phone") || normalized == "mobile" || normalized == "fax":
+		if !hasLength || length >= 10 {
+			return "phone", loaderType("text", map[string]interface{}{"charset": "numeric", "minlength": 10, "maxlength": 10}), true
+		}
+
+	case strings.Contains(normalized, "uuid") || strings.Contains(normalized, "guid"):
+		if !hasLength || length >= 36 {
+			return "uuid", loaderType("uuid", nil), true
+		}
+
+	// sqlite and friends often keep dates in text columns
+	case isDateName(lower):
+		if !hasLength || length >= 19 {
+			return "datetime", dateTimeType(lower, "datetime"), true
+		}
+	}
+
+	return "", conf.UseTypeDTO{}, false
+}
+
+// fieldWithType returns the name of a field already added with the given type, or ""
+func (m *ddlMapper) fieldWithType(typeName string) string {
+	for _, field := range m.config.Fields {
+		if field.Type == typeName {
+			return field.Name
+		}
+	}
+
+	return ""
+}
+
+func isDateName(lower string) bool {
+	for _, suffix := range []string{"_at", "_on", "_date", "_time", "date", "timestamp"} {
+		if strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+
+	switch lower {
+	case "created", "updated", "modified", "deleted", "dob":
+		return true
+	}
+
+	return strings.Contains(lower, "birth")
+}
+
+// dateTimeType generates times from a range that suits the column, like birth dates in the past
+func dateTimeType(lower string, format string) conf.UseTypeDTO {
+	args := map[string]interface{}{"format": format, "min": "2000-01-01", "max": "2025-12-31"}
+	if strings.Contains(lower, "birth") || lower == "dob" {
+		args["min"], args["max"] = "1940-01-01", "2005-12-31"
+	}
+
+	return loaderType("datetime", args)
+}
+
+// sqlType picks a type from the column's sql type, honouring its length, precision and any CHECK bounds
+func (m *ddlMapper) sqlType(column *ddl.Column) conf.UseTypeDTO {
+	sqlType := column.Type
+	lower := strings.ToLower(column.Name)
+
+	switch {
+	case isIntegerType(sqlType):
+		min, max := 0.0, float64(integerMax(column))
+		return loaderType("number", numberArgs(column, min, max, 0))
+
+	case isDecimalType(sqlType):
+		decimals, max := 2, 9999.0
+		if len(column.Params) == 2 {
+			precision, perr := strconv.Atoi(column.Params[0])
+			scale, serr := strconv.Atoi(column.Params[1])
+
+			if perr == nil && serr == nil && precision >= scale {
+				decimals, max = scale, math.Pow(10, float64(precision-scale))-1
+			}
+		} else if len(column.Params) == 1 {
+			if precision, err := strconv.Atoi(column.Params[0]); err == nil {
+				decimals, max = 0, math.Pow(10, float64(precision))-1
+			}
+		}
+
+		return loaderType("number", numberArgs(column, 0, math.Min(max, 1e15), decimals))
+
+	case isFloatType(sqlType):
+		return loaderType("number", numberArgs(column, 0, 9999, 2))
+
+	case sqlType == "uuid" || sqlType == "uniqueidentifier":
+		return loaderType("uuid", nil)
+
+	case sqlType == "date":
+		return dateTimeType(lower, "date")
+
+	case sqlType == "time" || strings.HasPrefix(sqlType, "time with"):
+		return loaderType("datetime", map[string]interface{}{"format": "time", "min": "2000-01-01", "max": "2000-01-01T23:59:59Z"})
+
+	case strings.HasPrefix(sqlType, "timestamp") || strings.HasPrefix(sqlType, "datetime") || sqlType == "smalldatetime" || sqlType == "timestamptz":
+		return dateTimeType(lower, "datetime")
+
+	case sqlType == "year":
+		return loaderType("number", map[string]interface{}{"min": 1970, "max": 2030})
+
+	case sqlType == "json" || sqlType == "jsonb":
+		return loaderType("choice", map[string]interface{}{"values": []string{"{}"}})
+
+	case strings.Contains(sqlType, "binary") || strings.Contains(sqlType, "blob") || sqlType == "bytea" || sqlType == "image":
+		return loaderType("text", map[string]interface{}{"charset": "hex", "minlength": 8, "maxlength": 32})
+	}
+
+	return loaderType("text", textArgs(column))
+}
+
+// numberArgs narrows the default range to the column's CHECK bounds
+func numberArgs(column *ddl.Column, min float64, max float64, decimals int) map[string]interface{} {
+	if column.Min != nil {
+		min = *column.Min
+	}
+
+	if column.Max != nil {
+		max = *column.Max
+	}
+
+	args := map[string]interface{}{"min": int64(math.Ceil(min))}
+
+	// float64 can't hold the largest int64, so leave max to number's default instead
+	if max < math.MaxInt64 {
+		args["max"] = int64(math.Floor(max))
+	}
+
+	if decimals > 0 {
+		args["decimals"] = decimals
+	}
+
+	return args
+}
+
+// text columns get short values, since long random ones are no more useful; fixed length columns are filled
+func textArgs(column *ddl.Column) map[string]interface{} {
+	max := 16
+
+	length, ok := textLength(column)
+	if ok && length < max {
+		max = length
+	}
+
+	min := 1
+	if ok && strings.Contains(column.Type, "char") && !strings.Contains(column.Type, "var") {
+		min = max
+	}
+
+	return map[string]interface{}{"minlength": min, "maxlength": max}
+}
+
+// textLength returns the column's maximum length, if it has one
+func textLength(column *ddl.Column) (int, bool) {
+	if len(column.Params) == 0 || !isTextType(column.Type) {
+		return 0, false
+	}
+
+	length, err := strconv.Atoi(column.Params[0])
+	if err != nil || length <= 0 {
+		// varchar(max)
+		return 0, false
+	}
+
+	return length, true
+}
+
+func isIntegerType(sqlType string) bool {
+	switch sqlType {
+	case "int", "integer", "int2", "int4", "int8", "smallint", "tinyint", "mediumint", "bigint",
+		"serial", "serial4", "serial8", "smallserial", "bigserial":
+		return true
+	}
+
+	return false
+}
+
+func isDecimalType(sqlType string) bool {
+	switch sqlType {
+	case "decimal", "numeric", "dec", "number", "money", "smallmoney":
+		return true
+	}
+
+	return false
+}
+
+func isFloatType(sqlType string) bool {
+	switch sqlType {
+	case "real", "float", "float4", "float8", "double", "double precision":
+		return true
+	}
+
+	return false
+}
+
+func isBoolType(column *ddl.Column) bool {
+	switch column.Type {
+	case "bool", "boolean":
+		return true
+	case "bit", "tinyint":
+		return len(column.Params) == 1 && column.Params[0] == "1" || column.Type == "bit" && len(column.Params) == 0
+	}
+
+	return false
+}
+
+// isTextType reports whether the sql type holds text; sqlite columns may have no type at all
+func isTextType(sqlType string) bool {
+	return sqlType == "" || strings.Contains(sqlType, "char") || strings.Contains(sqlType, "text") ||
+		strings.Contains(sqlType, "clob") || sqlType == "string" || sqlType == "citext"
+}
+
+// integerMax returns the largest value of the column's integer type
+func integerMax(column *ddl.Column) int64 {
+	var max int64 = math.MaxInt32
+
+	switch column.Type {
+	case "tinyint":
+		max = math.MaxInt8
+	case "smallint", "int2":
+		max = math.MaxInt16
+	case "mediumint":
+		max = 1<<23 - 1
+	case "bigint", "int8":
+		max = math.MaxInt64
+	}
+
+	// unsigned columns hold twice as much, less one; bigint's would overflow so it stays put
+	if column.Unsigned && max != math.MaxInt64 {
+		max = max*2 + 1
+	}
+
+	return max
+}
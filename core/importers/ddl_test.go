@@ -0,0 +1,85 @@
+package importers
+
+import (
+	"testing"
+
+	"github.com/elauffenburger/oar/core/ddl"
+)
+
+func TestConfigurationsFromDDL(t *testing.T) {
+	tables, err := ddl.Parse(`
+		CREATE TABLE users (
+			id serial PRIMARY KEY,
+			first_name varchar(50) NOT NULL,
+			last_name varchar(50) NOT NULL,
+			email varchar(100) NOT NULL UNIQUE,
+			state char(2),
+			status varchar(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'banned'))
+		);
+		CREATE TABLE orders (
+			id integer PRIMARY KEY,
+			user_id integer NOT NULL REFERENCES users (id),
+			total decimal(6,2) CHECK (total >= 1)
+		);`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs := ConfigurationsFromDDL(tables, DDLOptions{Rows: 20, DataDir: "../data", NullRate: 0.25})
+	users, orders := configs[0], configs[1]
+
+	loaderOf := func(name string) string {
+		for _, config := range configs {
+			for _, field := range config.Fields {
+				if config.Name+"."+field.Name == name {
+					return config.Types[field.Type].LoaderArgs.Name
+				}
+			}
+		}
+
+		return ""
+	}
+
+	expected := map[string]string{
+		"users.id":         "autoincrement",
+		"users.first_name": "csvloader",
+		"users.last_name":  "csvloader",
+		"users.email":      "strformat",
+		"users.state":      "csvloader",
+		"users.status":     "choice",
+		"orders.id":        "autoincrement",
+		"orders.user_id":   "number",
+		"orders.total":     "number",
+	}
+
+	for name, loader := range expected {
+		if actual := loaderOf(name); actual != loader {
+			t.Errorf("Expected %s to use %s, got '%s'", name, loader, actual)
+		}
+	}
+
+	if src := users.Types["state"].LoaderArgs.Args["src"]; src != "../data/states.csv" {
+		t.Errorf("Expected the state type to read ../data/states.csv, got %v", src)
+	}
+
+	if email := users.Fields[3]; !email.Unique || email.NullRate != 0 {
+		t.Errorf("Expected a unique, not null email field, got %+v", email)
+	}
+
+	if state := users.Fields[4]; state.NullRate != 0.25 {
+		t.Errorf("Expected the nullable state field to get the nullrate, got %+v", state)
+	}
+
+	if weights := users.Types["status"].LoaderArgs.Args["weights"].([]float64); weights[0] <= weights[1] {
+		t.Errorf("Expected the default status to be favoured, got weights %v", weights)
+	}
+
+	if args := orders.Types["user_id"].LoaderArgs.Args; args["min"] != 1 || args["max"] != 20 {
+		t.Errorf("Expected user ids between 1 and the rows of users, got %v", args)
+	}
+
+	if args := orders.Types["total"].LoaderArgs.Args; args["min"] != int64(1) || args["max"] != int64(9999) || args["decimals"] != 2 {
+		t.Errorf("Expected totals between 1 and 9999 with 2 decimals, got %v", args)
+	}
+}
@@ -0,0 +1,625 @@
+package importers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/output"
+	res "github.com/elauffenburger/oar/core/results"
+	"github.com/elauffenburger/oar/core/schema"
+	"gopkg.in/yaml.v3"
+)
+
+type JSONSchemaOptions struct {
+	Rows int
+
+	// directory of the csv data files, as it should be written in csvloader srcs
+	DataDir string
+
+	// nullrate given to properties that may be null
+	NullRate float64
+}
+
+// LoadSchemaDocument reads a JSON Schema or OpenAPI document written in json or yaml
+func LoadSchemaDocument(path string) (*schema.Document, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw interface{}
+		if err := yaml.Unmarshal(content, &raw); err != nil {
+			return nil, fmt.Errorf("Failed to parse '%s': %s", path, err)
+		}
+
+		if content, err = json.Marshal(jsonCompatible(raw)); err != nil {
+			return nil, fmt.Errorf("Failed to parse '%s': %s", path, err)
+		}
+	}
+
+	doc, err := schema.ParseDocument(content)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse '%s': %s", path, err)
+	}
+
+	return doc, nil
+}
+
+// jsonCompatible converts the maps yaml decodes with non-string keys into maps json can encode
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = jsonCompatible(item)
+		}
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[fmt.Sprint(key)] = jsonCompatible(item)
+		}
+
+		return object
+	case []interface{}:
+		for i, item := range v {
+			v[i] = jsonCompatible(item)
+		}
+	}
+
+	return value
+}
+
+// RootSchema returns the schema with the given name from the document's components or definitions, or the
+// document itself if name is empty
+func RootSchema(doc *schema.Document, name string) (*schema.Schema, error) {
+	if name != "" {
+		return doc.Named(name)
+	}
+
+	if doc.IsOpenAPI() {
+		return nil, fmt.Errorf("OpenAPI documents describe several schemas; pick one of: %s", strings.Join(doc.Names(), ", "))
+	}
+
+	return doc.Root, nil
+}
+
+// ConfigurationFromJSONSchema returns a configuration with json output whose rows are valid against s, an object schema
+func ConfigurationFromJSONSchema(doc *schema.Document, s *schema.Schema, name string, options JSONSchemaOptions) (*conf.Configuration, error) {
+	m := &schemaMapper{doc: doc, options: options, refs: make(map[string]bool)}
+
+	root, err := m.flatten(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(root.Properties) == 0 {
+		return nil, errors.New("Expected an object schema with properties")
+	}
+
+	if name == "" {
+		name = root.Title
+	}
+
+	m.config = &conf.Configuration{
+		Name:       name,
+		OutputType: conf.JSON,
+		NumRows:    options.Rows,
+		Options:    conf.Options{},
+		Types:      make(map[string]conf.UseTypeDTO),
+	}
+
+	fields, err := m.properties(root, "")
+	if err != nil {
+		return nil, err
+	}
+
+	m.config.Fields = fields
+	return m.config, nil
+}
+
+type schemaMapper struct {
+	doc     *schema.Document
+	options JSONSchemaOptions
+	config  *conf.Configuration
+
+	// refs being mapped, to stop recursive schemas
+	refs map[string]bool
+}
+
+var errRecursive = errors.New("recursive")
+
+// properties maps an object schema's properties to fields, in name order
+func (m *schemaMapper) properties(s *schema.Schema, path string) (conf.ConfigurationFields, error) {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	required := make(map[string]bool)
+	for _, name := range s.Required {
+		required[name] = true
+	}
+
+	fields := conf.NewConfigurationFields()
+	for _, name := range names {
+		field, err := m.field(name, s.Properties[name], path+name)
+
+		// a property that refers back to an object containing it can only be left out
+		if err == errRecursive && !required[name] {
+			continue
+		}
+
+		if err == errRecursive {
+			return nil, fmt.Errorf("Property '%s' is required but refers to a schema containing it", path+name)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+func (m *schemaMapper) field(name string, s *schema.Schema, path string) (*conf.ConfigurationField, error) {
+	ref := s.Ref
+	if ref != "" {
+		if m.refs[ref] {
+			return nil, errRecursive
+		}
+
+		m.refs[ref] = true
+		defer delete(m.refs, ref)
+	}
+
+	s, err := m.flatten(s)
+	if err != nil {
+		return nil, fmt.Errorf("Property '%s': %s", path, err)
+	}
+
+	typeName, t, kind, nullable, err := m.typeFor(name, s, path)
+	if err != nil {
+		return nil, err
+	}
+
+	field := &conf.ConfigurationField{Name: name, Type: addType(m.config, typeName, t)}
+	if kind != conf.StringKind {
+		field.Kind = kind
+	}
+
+	if nullable {
+		field.NullRate = m.options.NullRate
+	}
+
+	return field, nil
+}
+
+// flatten follows s's $refs and merges its allOf into a single schema
+func (m *schemaMapper) flatten(s *schema.Schema) (*schema.Schema, error) {
+	s, err := m.doc.Deref(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.AllOf) == 0 {
+		return s, nil
+	}
+
+	merged := *s
+	merged.AllOf = nil
+	merged.Properties = make(map[string]*schema.Schema)
+	for name, property := range s.Properties {
+		merged.Properties[name] = property
+	}
+
+	for _, sub := range s.AllOf {
+		sub, err := m.flatten(sub)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, property := range sub.Properties {
+			merged.Properties[name] = property
+		}
+
+		merged.Required = append(merged.Required, sub.Required...)
+		mergeKeywords(&merged, sub)
+	}
+
+	return &merged, nil
+}
+
+// mergeKeywords copies the keywords that into doesn't set from sub
+func mergeKeywords(into *schema.Schema, sub *schema.Schema) {
+	if len(into.Type) == 0 {
+		into.Type = sub.Type
+	}
+
+	if len(into.Enum) == 0 {
+		into.Enum = sub.Enum
+	}
+
+	if into.Format == "" {
+		into.Format = sub.Format
+	}
+
+	if into.Pattern == "" {
+		into.Pattern = sub.Pattern
+	}
+
+	if into.Minimum == nil {
+		into.Minimum, into.ExclusiveMinimum = sub.Minimum, sub.ExclusiveMinimum
+	}
+
+	if into.Maximum == nil {
+		into.Maximum, into.ExclusiveMaximum = sub.Maximum, sub.ExclusiveMaximum
+	}
+
+	if into.MinLength == nil {
+		into.MinLength = sub.MinLength
+	}
+
+	if into.MaxLength == nil {
+		into.MaxLength = sub.MaxLength
+	}
+
+	if into.Items == nil {
+		into.Items = sub.Items
+	}
+
+	if into.MinItems == nil {
+		into.MinItems = sub.MinItems
+	}
+
+	if into.MaxItems == nil {
+		into.MaxItems = sub.MaxItems
+	}
+}
+
+// typeFor picks a type for the values of a property or array item
+func (m *schemaMapper) typeFor(name string, s *schema.Schema, path string) (string, conf.UseTypeDTO, conf.FieldKind, bool, error) {
+	nullable := s.Nullable
+
+	// generate from the first alternative that isn't just null
+	if alternatives := append(s.OneOf, s.AnyOf...); len(alternatives) != 0 {
+		var chosen *schema.Schema
+
+		for _, alternative := range alternatives {
+			alternative, err := m.flatten(alternative)
+			if err != nil {
+				return "", conf.UseTypeDTO{}, "", false, fmt.Errorf("Property '%s': %s", path, err)
+			}
+
+			if len(alternative.Type) == 1 && alternative.Type[0] == "null" {
+				nullable = true
+			} else if chosen == nil {
+				chosen = alternative
+			}
+		}
+
+		if chosen != nil {
+			typeName, t, kind, chosenNullable, err := m.typeFor(name, chosen, path)
+			return typeName, t, kind, nullable || chosenNullable, err
+		}
+	}
+
+	types := make([]string, 0, len(s.Type))
+	for _, t := range s.Type {
+		if t == "null" {
+			nullable = true
+		} else {
+			types = append(types, t)
+		}
+	}
+
+	typeName := strings.ToLower(path)
+
+	if s.Const != nil {
+		t, kind := choiceOf([]interface{}{s.Const})
+		return typeName, t, kind, false, nil
+	}
+
+	if len(s.Enum) != 0 {
+		t, kind := choiceOf(s.Enum)
+		return typeName, t, kind, false, nil
+	}
+
+	jsonType := inferType(s, types)
+
+	switch jsonType {
+	case "null":
+		return typeName, loaderType("choice", map[string]interface{}{"values": []interface{}{nil}}), conf.StringKind, true, nil
+
+	case "boolean":
+		return typeName, loaderType("choice", map[string]interface{}{"values": []bool{true, false}}), conf.BooleanKind, nullable, nil
+
+	case "integer":
+		return typeName, loaderType("number", integerArgs(s)), conf.IntegerKind, nullable, nil
+
+	case "number":
+		return typeName, loaderType("number", numberArgsFor(s)), conf.NumberKind, nullable, nil
+
+	case "object":
+		if len(s.Properties) == 0 {
+			return typeName, loaderType("choice", map[string]interface{}{"values": []string{"{}"}}), conf.JSONKind, nullable, nil
+		}
+
+		fields, err := m.properties(s, path+".")
+		if err != nil {
+			return "", conf.UseTypeDTO{}, "", false, err
+		}
+
+		return typeName, loaderType("object", map[string]interface{}{"fields": fields}), conf.JSONKind, nullable, nil
+
+	case "array":
+		t, err := m.arrayType(s, path)
+		return typeName, t, conf.JSONKind, nullable, err
+	}
+
+	stringName, t := m.stringType(name, s, typeName)
+	return stringName, t, conf.StringKind, nullable, nil
+}
+
+// inferType returns the json type to generate, from the schema's type or, without one, its other keywords
+func inferType(s *schema.Schema, types []string) string {
+	switch {
+	case len(types) != 0:
+		return types[0]
+	case len(s.Type) != 0:
+		return "null"
+	case len(s.Properties) != 0:
+		return "object"
+	case s.Items != nil || s.MinItems != nil || s.MaxItems != nil:
+		return "array"
+	case s.Minimum != nil || s.Maximum != nil || s.MultipleOf != nil:
+		return "number"
+	}
+
+	return "string"
+}
+
+// choiceOf picks from an enum's values; values of mixed types are written as json
+func choiceOf(values []interface{}) (conf.UseTypeDTO, conf.FieldKind) {
+	kinds := make(map[conf.FieldKind]bool)
+	for _, value := range values {
+		switch v := value.(type) {
+		case nil:
+		case bool:
+			kinds[conf.BooleanKind] = true
+		case float64:
+			if v == math.Trunc(v) {
+				kinds[conf.IntegerKind] = true
+			} else {
+				kinds[conf.NumberKind] = true
+			}
+		case string:
+			kinds[conf.StringKind] = true
+		default:
+			kinds[conf.JSONKind] = true
+		}
+	}
+
+	if kinds[conf.IntegerKind] && kinds[conf.NumberKind] {
+		delete(kinds, conf.IntegerKind)
+	}
+
+	if len(kinds) == 1 && !kinds[conf.JSONKind] {
+		for kind := range kinds {
+			return loaderType("choice", map[string]interface{}{"values": values}), kind
+		}
+	}
+
+	encoded := make([]interface{}, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+
+		raw, _ := json.Marshal(value)
+		encoded[i] = string(raw)
+	}
+
+	return loaderType("choice", map[string]interface{}{"values": encoded}), conf.JSONKind
+}
+
+// default range of numbers when a schema only gives one bound, or none
+const defaultNumberSpan = 1000
+
+// integerArgs generates integers within the schema's bounds that are multiples of its multipleOf
+func integerArgs(s *schema.Schema) map[string]interface{} {
+	lo, hi := bounds(s, 1)
+
+	step := int64(1)
+	if s.MultipleOf != nil && *s.MultipleOf >= 1 && *s.MultipleOf == math.Trunc(*s.MultipleOf) {
+		step = int64(*s.MultipleOf)
+		lo = int64(math.Ceil(float64(lo)/float64(step))) * step
+	}
+
+	args := map[string]interface{}{"min": lo, "max": hi}
+	if step > 1 {
+		args["step"] = step
+	}
+
+	return args
+}
+
+// numberArgsFor generates numbers with as many decimals as the schema's multipleOf allows (2 without one)
+func numberArgsFor(s *schema.Schema) map[string]interface{} {
+	if s.MultipleOf != nil && *s.MultipleOf >= 1 && *s.MultipleOf == math.Trunc(*s.MultipleOf) {
+		return integerArgs(s)
+	}
+
+	decimals := 2
+	if s.MultipleOf != nil {
+		// multiples of 0.01 have two decimals; integers are multiples of anything like 0.5 or 0.25
+		decimals = 0
+		for d := 1; d <= 6; d++ {
+			if math.Abs(math.Pow(10, float64(-d))-*s.MultipleOf) < 1e-12 {
+				decimals = d
+			}
+		}
+	}
+
+	// values are rounded to the decimals, so exclusive bounds move in by a whole number to stay exclusive
+	lo, hi := bounds(s, 1)
+	args := map[string]interface{}{"min": lo, "max": hi}
+	if decimals > 0 {
+		args["decimals"] = decimals
+	}
+
+	return args
+}
+
+// bounds returns the schema's integer range, moving exclusive bounds in by shift
+func bounds(s *schema.Schema, shift int64) (int64, int64) {
+	min, minExclusive, max, maxExclusive := s.Bounds()
+
+	var lo, hi int64
+	switch {
+	case min != nil && max != nil:
+		lo, hi = int64(math.Ceil(*min)), int64(math.Floor(*max))
+	case min != nil:
+		lo = int64(math.Ceil(*min))
+		hi = lo + defaultNumberSpan
+	case max != nil:
+		hi = int64(math.Floor(*max))
+		lo = hi - defaultNumberSpan
+	default:
+		lo, hi = 0, defaultNumberSpan
+	}
+
+	if minExclusive && float64(lo) == *min {
+		lo += shift
+	}
+
+	if maxExclusive && float64(hi) == *max {
+		hi -= shift
+	}
+
+	return lo, hi
+}
+
+func (m *schemaMapper) arrayType(s *schema.Schema, path string) (conf.UseTypeDTO, error) {
+	minItems, maxItems := 0, 3
+	if s.MinItems != nil {
+		minItems = *s.MinItems
+	}
+
+	if s.MaxItems != nil {
+		maxItems = *s.MaxItems
+	} else if maxItems < minItems {
+		maxItems = minItems + 3
+	}
+
+	items := s.Items
+	if items == nil {
+		items = &schema.Schema{Type: schema.Types{"string"}}
+	}
+
+	item, err := m.field("item", items, path+"[]")
+	if err == errRecursive && minItems == 0 {
+		// items that refer back to the array's own schema can only be left out
+		return loaderType("choice", map[string]interface{}{"values": []string{"[]"}}), nil
+	}
+
+	if err == errRecursive {
+		return conf.UseTypeDTO{}, fmt.Errorf("Property '%s' needs at least %d items, but they refer to a schema containing them", path, minItems)
+	}
+
+	if err != nil {
+		return conf.UseTypeDTO{}, err
+	}
+
+	kind := item.Kind
+	if kind == "" {
+		kind = conf.StringKind
+	}
+
+	args := map[string]interface{}{"type": item.Type, "kind": string(kind), "minitems": minItems, "maxitems": maxItems}
+	if s.UniqueItems {
+		args["unique"] = true
+	}
+
+	return loaderType("array", args), nil
+}
+
+// stringType picks a type from the schema's format or pattern, or a data/ file for well-known property names
+func (m *schemaMapper) stringType(name string, s *schema.Schema, typeName string) (string, conf.UseTypeDTO) {
+	minLength, maxLength := 1, 16
+	if s.MinLength != nil {
+		minLength = *s.MinLength
+	}
+
+	if s.MaxLength != nil {
+		maxLength = *s.MaxLength
+	}
+
+	if maxLength < minLength {
+		maxLength = minLength + 16
+	}
+
+	if s.Pattern != "" {
+		return typeName, loaderType("regex", map[string]interface{}{"pattern": s.Pattern})
+	}
+
+	switch s.Format {
+	case "email":
+		return "email", loaderType("text", map[string]interface{}{"charset": "lower", "minlength": 5, "maxlength": 12, "suffix": "@example.com"})
+	case "uuid":
+		return "uuid", loaderType("uuid", nil)
+	case "date-time":
+		return "datetime", loaderType("datetime", map[string]interface{}{"format": "rfc3339", "min": "2000-01-01", "max": "2025-12-31"})
+	case "date":
+		return "date", loaderType("datetime", map[string]interface{}{"format": "date", "min": "2000-01-01", "max": "2025-12-31"})
+	case "time":
+		return "time", loaderType("datetime", map[string]interface{}{"format": "15:04:05Z", "min": "2000-01-01", "max": "2000-01-01T23:59:59Z"})
+	case "uri", "url":
+		return "uri", loaderType("text", map[string]interface{}{"charset": "lower", "minlength": 3, "maxlength": 12, "prefix": "https://", "suffix": ".example.com"})
+	case "hostname":
+		return "hostname", loaderType("text", map[string]interface{}{"charset": "lower", "minlength": 3, "maxlength": 12, "suffix": ".example.com"})
+	case "ipv4":
+		return "ipv4", loaderType("regex", map[string]interface{}{"pattern": `(([1-9]?[0-9]|1[0-9]{2})\.){3}([1-9]?[0-9]|1[0-9]{2})`})
+	case "ipv6":
+		return "ipv6", loaderType("regex", map[string]interface{}{"pattern": `([0-9a-f]{1,4}:){7}[0-9a-f]{1,4}`})
+	}
+
+	if dataName, t, ok := dataFileType(name, maxLength, s.MaxLength != nil, m.options.DataDir); ok && minLength <= 1 {
+		return dataName, t
+	}
+
+	return typeName, loaderType("text", map[string]interface{}{"minlength": minLength, "maxlength": maxLength})
+}
+
+// ValidateRows checks the json output of rows against s and returns each problem prefixed with its row's index
+func ValidateRows(doc *schema.Document, s *schema.Schema, rows []*res.ResultsRow) ([]string, error) {
+	problems := make([]string, 0)
+
+	for _, row := range rows {
+		raw, err := json.Marshal(output.ToJsonObject(row))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode row %d: %s", row.Index, err)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+
+		for _, problem := range doc.Validate(s, value) {
+			problems = append(problems, fmt.Sprintf("row %d: %s", row.Index, problem))
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,112 @@
+package importers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/schema"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["id", "email", "age", "tags", "address"],
+	"properties": {
+		"id": {"type": "string", "format": "uuid"},
+		"email": {"type": "string", "format": "email"},
+		"age": {"type": "integer", "minimum": 18, "exclusiveMaximum": 100},
+		"score": {"type": "number", "multipleOf": 0.25, "minimum": 0, "maximum": 5},
+		"code": {"type": "string", "pattern": "^[A-Z]{3}-\\d{4}$"},
+		"status": {"enum": ["active", "banned", null]},
+		"tags": {"type": "array", "items": {"type": "string", "maxLength": 8}, "uniqueItems": true, "maxItems": 4},
+		"address": {"$ref": "#/definitions/Address"},
+		"manager": {"$ref": "#"}
+	},
+	"definitions": {
+		"Address": {
+			"type": "object",
+			"required": ["city"],
+			"properties": {"city": {"type": "string", "minLength": 1}, "ip": {"type": "string", "format": "ipv4"}},
+			"additionalProperties": false
+		}
+	}
+}`
+
+func TestConfigurationFromJSONSchemaValidates(t *testing.T) {
+	doc, err := schema.ParseDocument([]byte(userSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ConfigurationFromJSONSchema(doc, doc.Root, "users", JSONSchemaOptions{Rows: 500, DataDir: "../../data", NullRate: 0.2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := core.LoadConfigurationFromJson(string(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Dir = "."
+	loaded.Options[conf.SeedOption] = "1"
+
+	results, err := core.GenerateResults(loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := ValidateRows(doc, doc.Root, results.Rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(problems) != 0 {
+		t.Errorf("Expected every row to match the schema, got:\n%s", strings.Join(problems, "\n"))
+	}
+}
+
+func TestValidateReportsProblems(t *testing.T) {
+	doc, err := schema.ParseDocument([]byte(userSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value interface{}
+	json.Unmarshal([]byte(`{"id": "nope", "age": 100, "code": "abc", "tags": ["a", "a"], "address": {"zip": 1}}`), &value)
+
+	expected := []string{
+		"/: missing required property 'email'",
+		"/address: missing required property 'city'",
+		"/address: property 'zip' isn't allowed",
+		"/age: 100 is greater than the maximum of 100",
+		"/code: 'abc' doesn't match the pattern '^[A-Z]{3}-\\d{4}$'",
+		"/id: 'nope' isn't a valid uuid",
+		"/tags/1: 'a' repeats item 0",
+	}
+
+	if problems := doc.Validate(doc.Root, value); strings.Join(problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(problems, "\n"))
+	}
+}
+
+func TestRootSchemaOfOpenAPIDocument(t *testing.T) {
+	doc, err := schema.ParseDocument([]byte(`{"openapi": "3.0.0", "components": {"schemas": {"Pet": {"type": "object"}, "Owner": {"type": "object"}}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RootSchema(doc, ""); err == nil || !strings.Contains(err.Error(), "Owner, Pet") {
+		t.Errorf("Expected an error listing the schemas, got %v", err)
+	}
+
+	if _, err := RootSchema(doc, "Pet"); err != nil {
+		t.Errorf("Expected to find Pet, got %s", err)
+	}
+}
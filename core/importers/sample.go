@@ -0,0 +1,264 @@
+package importers
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/profile"
+)
+
+type SampleOptions struct {
+	// rows to generate; 0 generates as many rows as the sample had
+	Rows int
+
+	// directory of the csv data files, as it should be written in csvloader srcs
+	DataDir string
+
+	// columns with at most this many distinct values pick from them, with the sample's frequencies
+	MaxChoices int
+}
+
+// buckets numbers' distributions are approximated with, and the values a sample needs before they're used
+const (
+	sampleBuckets         = 10
+	minDistributionValues = 100
+)
+
+// unique columns need this many values before they're assumed to be unique by design, rather than by chance
+const minUniqueValues = 20
+
+// ConfigurationFromProfile returns a configuration with json output whose fields reproduce the profiled columns'
+// types, null rates and distributions, without copying their values (other than those of low cardinality columns)
+func ConfigurationFromProfile(p *profile.Profile, name string, options SampleOptions) *conf.Configuration {
+	rows := options.Rows
+	if rows == 0 {
+		rows = p.Rows
+	}
+
+	config := &conf.Configuration{
+		Name:       name,
+		OutputType: conf.JSON,
+		NumRows:    rows,
+		Options:    conf.Options{},
+		Fields:     conf.NewConfigurationFields(),
+		Types:      make(map[string]conf.UseTypeDTO),
+	}
+
+	for _, column := range p.Columns {
+		typeName, t, unique := sampleType(column, options)
+
+		field := &conf.ConfigurationField{
+			Name:     column.Name,
+			Type:     addType(config, typeName, t),
+			Kind:     fieldKind(column.Kind()),
+			NullRate: math.Round(column.NullRate()*10000) / 10000,
+			Unique:   unique && column.Count >= minUniqueValues,
+		}
+
+		if column.Count == 0 {
+			field.NullRate = 0
+		}
+
+		config.Fields = append(config.Fields, field)
+	}
+
+	return config
+}
+
+func fieldKind(kind profile.Kind) conf.FieldKind {
+	switch kind {
+	case profile.IntegerKind:
+		return conf.IntegerKind
+	case profile.NumberKind:
+		return conf.NumberKind
+	case profile.BooleanKind:
+		return conf.BooleanKind
+	case profile.JSONKind:
+		return conf.JSONKind
+	}
+
+	return ""
+}
+
+// sampleType picks a type name and type for the column, and whether its values should be unique
+func sampleType(column *profile.Column, options SampleOptions) (string, conf.UseTypeDTO, bool) {
+	typeName := strings.ToLower(column.Name)
+	kind := column.Kind()
+
+	if column.Count == 0 {
+		return typeName, loaderType("choice", map[string]interface{}{"values": []interface{}{nil}}), false
+	}
+
+	// an id counting up from 1
+	if kind == profile.IntegerKind && column.Unique() && column.Nulls == 0 && column.Min == 1 && column.Max == float64(column.Count) {
+		return "id", loaderType("autoincrement", nil), false
+	}
+
+	if distinct, exact := column.Distinct(); exact && distinct <= options.MaxChoices && distinct*2 <= column.Count {
+		return typeName, frequencyChoice(column), false
+	}
+
+	switch kind {
+	case profile.IntegerKind:
+		return typeName, loaderType("number", distributionArgs(column, 0)), column.Unique()
+
+	case profile.NumberKind:
+		decimals := column.Decimals
+		if decimals < 1 {
+			decimals = 1
+		}
+
+		if decimals > 6 {
+			decimals = 6
+		}
+
+		return typeName, loaderType("number", distributionArgs(column, decimals)), column.Unique()
+
+	case profile.BooleanKind:
+		return typeName, frequencyChoice(column), false
+
+	case profile.TimeKind:
+		return typeName, timeType(column), column.Unique()
+
+	case profile.JSONKind:
+		empty := "{}"
+		if top := column.Top(1); strings.HasPrefix(top[0].Value, "[") {
+			empty = "[]"
+		}
+
+		return typeName, loaderType("choice", map[string]interface{}{"values": []string{empty}}), false
+	}
+
+	name, t := textType(column, typeName, options)
+	return name, t, column.Unique()
+}
+
+// frequencyChoice picks from the column's values as often as they appeared
+func frequencyChoice(column *profile.Column) conf.UseTypeDTO {
+	top := column.Top(-1)
+
+	values := make([]string, len(top))
+	weights := make([]float64, len(top))
+	for i, value := range top {
+		values[i], weights[i] = value.Value, float64(value.Count)
+	}
+
+	args := map[string]interface{}{"values": values}
+	if top[0].Count != top[len(top)-1].Count {
+		args["weights"] = weights
+	}
+
+	return loaderType("choice", args)
+}
+
+// distributionArgs covers the column's range, following its distribution when there are enough values to tell it
+func distributionArgs(column *profile.Column, decimals int) map[string]interface{} {
+	args := map[string]interface{}{"min": int64(math.Floor(column.Min)), "max": int64(math.Ceil(column.Max))}
+
+	if decimals > 0 {
+		args["decimals"] = decimals
+	}
+
+	if column.Count >= minDistributionValues && column.Max > column.Min {
+		histogram := column.Histogram(sampleBuckets)
+		weights := make([]float64, len(histogram))
+
+		uniform := true
+		for i, count := range histogram {
+			weights[i] = float64(count)
+			uniform = uniform && count == histogram[0]
+		}
+
+		if !uniform {
+			args["weights"] = weights
+		}
+	}
+
+	return args
+}
+
+// datetime formats for the layouts profiles recognize times in
+var sampleTimeFormats = map[string]string{
+	time.RFC3339Nano:      "rfc3339",
+	"2006-01-02 15:04:05": "datetime",
+	"2006-01-02":          "date",
+	"15:04:05":            "time",
+}
+
+func timeType(column *profile.Column) conf.UseTypeDTO {
+	format, ok := sampleTimeFormats[column.TimeLayout()]
+	if !ok {
+		format = column.TimeLayout()
+	}
+
+	return loaderType("datetime", map[string]interface{}{
+		"format": format,
+		"min":    column.MinTime.UTC().Format(time.RFC3339),
+		"max":    column.MaxTime.UTC().Format(time.RFC3339),
+	})
+}
+
+// textType picks, in order, a data/ file for well-known names, a uuid, an email, a pattern matching the values'
+// shapes, or text of the values' lengths and characters
+func textType(column *profile.Column, typeName string, options SampleOptions) (string, conf.UseTypeDTO) {
+	if name, t, ok := dataFileType(column.Name, 0, false, options.DataDir); ok {
+		return name, t
+	}
+
+	if column.Formats["uuid"] == column.Count {
+		return typeName, loaderType("uuid", nil)
+	}
+
+	if float64(column.Formats["email"]) >= 0.95*float64(column.Count) {
+		suffix := "@example.com"
+		min, max := column.MinLocalLength, column.MaxLocalLength
+
+		if min < 1 {
+			min = 1
+		}
+
+		if max < min {
+			max = min
+		}
+
+		return typeName, loaderType("text", map[string]interface{}{"charset": "lower", "minlength": min, "maxlength": max, "suffix": suffix})
+	}
+
+	if pattern, ok := column.Pattern(); ok {
+		return typeName, loaderType("regex", map[string]interface{}{"pattern": pattern})
+	}
+
+	args := map[string]interface{}{"minlength": column.MinLength, "maxlength": column.MaxLength}
+	if charset := sampleCharset(column); charset != "alpha" {
+		args["charset"] = charset
+	}
+
+	return typeName, loaderType("text", args)
+}
+
+// sampleCharset returns the smallest of text's named charsets holding every character of the column's values, or
+// the characters themselves
+func sampleCharset(column *profile.Column) string {
+	chars, ok := column.Chars()
+	if !ok {
+		return "alphanumeric"
+	}
+
+	named := []struct{ name, chars string }{
+		{"numeric", "0123456789"},
+		{"lower", "abcdefghijklmnopqrstuvwxyz"},
+		{"upper", "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+		{"alpha", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+		{"alphanumeric", "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"},
+	}
+
+	for _, charset := range named {
+		if strings.Trim(chars, charset.chars) == "" {
+			return charset.name
+		}
+	}
+
+	return chars
+}
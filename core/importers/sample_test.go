@@ -0,0 +1,85 @@
+package importers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/elauffenburger/oar/core/profile"
+)
+
+func TestConfigurationFromProfile(t *testing.T) {
+	var sample strings.Builder
+	sample.WriteString("id,first_name,status,code,age,token\n")
+
+	for i := 1; i <= 200; i++ {
+		status := "active"
+		if i%10 == 0 {
+			status = "banned"
+		}
+
+		// ages bunch up in the middle of their range
+		age := 20 + (i*37)%41 + (i*13)%23
+
+		fmt.Fprintf(&sample, "%d,Name%d,%s,X%03d,%d,%x\n", i, i, status, i, age, i*7919)
+	}
+
+	p, err := profile.ReadCSV(strings.NewReader(sample.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := ConfigurationFromProfile(p, "people", SampleOptions{DataDir: "data", MaxChoices: 20})
+
+	loaders := make([]string, len(config.Fields))
+	for i, field := range config.Fields {
+		loaders[i] = field.Name + ":" + config.Types[field.Type].LoaderArgs.Name
+	}
+
+	if actual := strings.Join(loaders, " "); actual != "id:autoincrement first_name:csvloader status:choice code:regex age:number token:text" {
+		t.Errorf("Unexpected loaders: %s", actual)
+	}
+
+	if config.NumRows != 200 {
+		t.Errorf("Expected as many rows as the sample, got %d", config.NumRows)
+	}
+
+	if args := config.Types["status"].LoaderArgs.Args; fmt.Sprint(args["values"], args["weights"]) != "[active banned] [180 20]" {
+		t.Errorf("Expected statuses weighted by their frequency, got %v", args)
+	}
+
+	if pattern := config.Types["code"].LoaderArgs.Args["pattern"]; pattern != "[A-Z][0-9]{3}" {
+		t.Errorf("Expected codes to match [A-Z][0-9]{3}, got %v", pattern)
+	}
+
+	args := config.Types["age"].LoaderArgs.Args
+	if weights, ok := args["weights"].([]float64); !ok || weights[0] >= weights[4] || weights[9] >= weights[5] {
+		t.Errorf("Expected ages weighted towards the middle of their range, got %v", args)
+	}
+
+	if token := config.Fields[5]; !token.Unique || config.Types["token"].LoaderArgs.Args["charset"] != "alphanumeric" {
+		t.Errorf("Expected unique alphanumeric tokens, got %+v with %v", token, config.Types["token"].LoaderArgs.Args)
+	}
+}
+
+func TestEmailsKeepTheLengthsOfTheirLocalParts(t *testing.T) {
+	var sample strings.Builder
+	sample.WriteString("contact\n")
+
+	domains := []string{"x.com", "example.org", "a-much-longer-domain.co.uk"}
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&sample, "%c%05d@%s\n", 'a'+i%26, i, domains[i%len(domains)])
+	}
+
+	p, err := profile.ReadCSV(strings.NewReader(sample.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := ConfigurationFromProfile(p, "contacts", SampleOptions{DataDir: "data"})
+
+	args := config.Types[config.Fields[0].Type].LoaderArgs.Args
+	if args["suffix"] != "@example.com" || args["minlength"] != 6 || args["maxlength"] != 6 {
+		t.Errorf("Expected emails with 6 characters before the @, got %v", args)
+	}
+}
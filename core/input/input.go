@@ -0,0 +1,151 @@
+// Package input reads rows of existing data, like csv files and json exports, one at a time.
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RowFn is called with each row's column names and values, in the order they're written
+type RowFn func(names []string, values []interface{}) error
+
+// ReadCSV reads csv with a header row; every value is a string
+func ReadCSV(r io.Reader, fn RowFn) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return fmt.Errorf("Expected a header row")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(header))
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(record) != len(header) {
+			line, _ := reader.FieldPos(0)
+			return fmt.Errorf("line %d has %d values; expected %d", line, len(record), len(header))
+		}
+
+		for i, value := range record {
+			values[i] = value
+		}
+
+		if err := fn(header, values); err != nil {
+			return err
+		}
+	}
+}
+
+// ReadJSON reads a json array of objects, or objects one per line (ndjson). Values are decoded like
+// encoding/json does, except numbers are json.Numbers
+func ReadJSON(r io.Reader, fn RowFn) error {
+	reader := bufio.NewReader(r)
+
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	decoder.UseNumber()
+
+	array := first == '['
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	for row := 0; decoder.More(); row++ {
+		names, values, err := readObject(decoder)
+		if err != nil {
+			return fmt.Errorf("row %d: %s", row, err)
+		}
+
+		if err := fn(names, values); err != nil {
+			return err
+		}
+	}
+
+	if array {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+
+		reader.ReadByte()
+	}
+}
+
+// readObject reads an object's keys in the order they're written, which a map would lose
+func readObject(decoder *json.Decoder) ([]string, []interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, nil, fmt.Errorf("expected an object")
+	}
+
+	names := make([]string, 0)
+	values := make([]interface{}, 0)
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+
+		names = append(names, token.(string))
+		values = append(values, value)
+	}
+
+	// the closing brace
+	if _, err := decoder.Token(); err != nil {
+		return nil, nil, err
+	}
+
+	return names, values, nil
+}
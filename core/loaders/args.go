@@ -0,0 +1,324 @@
+package loaders
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/elauffenburger/oar/core/schema"
+)
+
+// Loader args are declared as structs whose fields are tagged with the name of the arg they're decoded from:
+//
+//	type csvLoaderArgs struct {
+//		Src       string `arg:"src,required" desc:"path to the file to pick values from"`
+//		Separator string `arg:"separator" default:"\n" desc:"separator between values in the file"`
+//	}
+//
+// Supported field types are strings, bools, ints, floats, interface{}, maps with string keys, slices of those and
+// pointers to any of them.
+
+type argField struct {
+	name        string
+	required    bool
+	def         string
+	hasDefault  bool
+	description string
+	index       int
+}
+
+func argFieldsOf(t reflect.Type) []argField {
+	fields := make([]argField, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("arg")
+		if !ok {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		field := argField{name: parts[0], index: i, description: t.Field(i).Tag.Get("desc")}
+		field.def, field.hasDefault = t.Field(i).Tag.Lookup("default")
+
+		for _, flag := range parts[1:] {
+			if flag == "required" {
+				field.required = true
+			}
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// DecodeArgs decodes raw loader args into the args struct pointed to by out, applying defaults and
+// reporting every missing, unknown or mistyped arg
+func DecodeArgs(loaderName string, raw map[string]interface{}, out interface{}) error {
+	value := reflect.ValueOf(out).Elem()
+	fields := argFieldsOf(value.Type())
+
+	problems := make([]string, 0)
+	known := make(map[string]bool)
+
+	for _, field := range fields {
+		known[field.name] = true
+		target := value.Field(field.index)
+
+		rawValue, ok := raw[field.name]
+		if !ok || rawValue == nil {
+			if field.required {
+				problems = append(problems, fmt.Sprintf("argument '%s' is required", field.name))
+				continue
+			}
+
+			if field.hasDefault {
+				if err := decodeDefault(field.def, target); err != nil {
+					problems = append(problems, fmt.Sprintf("invalid default for argument '%s': %s", field.name, err))
+				}
+			}
+
+			continue
+		}
+
+		if err := decodeArg(rawValue, target); err != nil {
+			problems = append(problems, fmt.Sprintf("argument '%s' %s", field.name, err))
+		}
+	}
+
+	unknown := make([]string, 0)
+	for name := range raw {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+
+		validNames := make([]string, len(fields))
+		for i, field := range fields {
+			validNames[i] = field.name
+		}
+
+		valid := "none"
+		if len(validNames) != 0 {
+			valid = strings.Join(validNames, ", ")
+		}
+
+		problems = append(problems, fmt.Sprintf("unknown argument(s) '%s'; valid arguments are: %s", strings.Join(unknown, "', '"), valid))
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%s: %s", loaderName, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func decodeDefault(def string, target reflect.Value) error {
+	if target.Kind() == reflect.String {
+		target.SetString(def)
+		return nil
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal([]byte(def), &raw); err != nil {
+		return err
+	}
+
+	return decodeArg(raw, target)
+}
+
+func decodeArg(raw interface{}, target reflect.Value) error {
+	switch target.Kind() {
+	case reflect.Interface:
+		// a null leaves the interface nil
+		if raw != nil {
+			target.Set(reflect.ValueOf(raw))
+		}
+
+		return nil
+	case reflect.Ptr:
+		// pointers let loaders tell an arg that wasn't given apart from its zero value
+		elem := reflect.New(target.Type().Elem())
+		if err := decodeArg(raw, elem.Elem()); err != nil {
+			return err
+		}
+
+		target.Set(elem)
+		return nil
+	case reflect.String:
+		if str, ok := raw.(string); ok {
+			target.SetString(str)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := raw.(bool); ok {
+			target.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := toFloat(raw); ok {
+			if n != float64(int64(n)) {
+				return fmt.Errorf("must be a whole number, got %v", raw)
+			}
+
+			target.SetInt(int64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := toFloat(raw); ok {
+			target.SetFloat(n)
+			return nil
+		}
+	case reflect.Slice:
+		// lists decoded from json, or typed slices like []string from configurations built in code
+		if list := reflect.ValueOf(raw); raw != nil && list.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(target.Type(), list.Len(), list.Len())
+			for i := 0; i < list.Len(); i++ {
+				if err := decodeArg(list.Index(i).Interface(), slice.Index(i)); err != nil {
+					return fmt.Errorf("item %d %s", i, err)
+				}
+			}
+
+			target.Set(slice)
+			return nil
+		}
+	case reflect.Map:
+		if obj, ok := raw.(map[string]interface{}); ok && target.Type().Key().Kind() == reflect.String {
+			m := reflect.MakeMapWithSize(target.Type(), len(obj))
+			for key, item := range obj {
+				elem := reflect.New(target.Type().Elem()).Elem()
+				if err := decodeArg(item, elem); err != nil {
+					return fmt.Errorf("key '%s' %s", key, err)
+				}
+
+				m.SetMapIndex(reflect.ValueOf(key).Convert(target.Type().Key()), elem)
+			}
+
+			target.Set(m)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("must be %s, got %s", describeKind(target.Type()), describeValue(raw))
+}
+
+func toFloat(raw interface{}) (float64, bool) {
+	switch n := raw.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+
+	switch v := reflect.ValueOf(raw); v.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	}
+
+	return 0, false
+}
+
+func describeKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return describeKind(t.Elem())
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "a whole number"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list"
+	case reflect.Map:
+		return "an object"
+	}
+
+	return t.String()
+}
+
+func describeValue(raw interface{}) string {
+	switch raw.(type) {
+	case string:
+		return fmt.Sprintf("the string '%s'", raw)
+	case bool:
+		return fmt.Sprintf("%v", raw)
+	case float64, float32, int, int64, json.Number:
+		return fmt.Sprintf("the number %v", raw)
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "an object"
+	}
+
+	return fmt.Sprintf("%v", raw)
+}
+
+// ArgsSchemaFor derives a schema from an args struct (or a pointer to one)
+func ArgsSchemaFor(args interface{}) *schema.Schema {
+	t := reflect.TypeOf(args)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	properties := make(map[string]*schema.Schema)
+	required := make([]string, 0)
+
+	for _, field := range argFieldsOf(t) {
+		prop := schemaForType(t.Field(field.index).Type)
+		prop.Description = field.description
+
+		if field.hasDefault {
+			if t.Field(field.index).Type.Kind() == reflect.String {
+				prop.Default = field.def
+			} else {
+				json.Unmarshal([]byte(field.def), &prop.Default)
+			}
+		}
+
+		if field.required {
+			required = append(required, field.name)
+		}
+
+		properties[field.name] = prop
+	}
+
+	return schema.Object(properties, required...)
+}
+
+func schemaForType(t reflect.Type) *schema.Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaForType(t.Elem())
+	case reflect.String:
+		return &schema.Schema{Type: schema.Types{"string"}}
+	case reflect.Bool:
+		return &schema.Schema{Type: schema.Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &schema.Schema{Type: schema.Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &schema.Schema{Type: schema.Types{"number"}}
+	case reflect.Slice:
+		return &schema.Schema{Type: schema.Types{"array"}, Items: schemaForType(t.Elem())}
+	case reflect.Map:
+		return &schema.Schema{Type: schema.Types{"object"}, AdditionalProperties: schemaForType(t.Elem())}
+	}
+
+	return &schema.Schema{}
+}
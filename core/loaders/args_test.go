@@ -0,0 +1,60 @@
+package loaders
+
+import (
+	"strings"
+	"testing"
+)
+
+type testArgs struct {
+	Src       string   `arg:"src,required"`
+	Separator string   `arg:"separator" default:"\n"`
+	Min       int      `arg:"min" default:"5"`
+	Names     []string `arg:"names"`
+}
+
+func TestDecodeArgsAppliesDefaults(t *testing.T) {
+	args := &testArgs{}
+
+	err := DecodeArgs("test", map[string]interface{}{"src": "./names.csv", "names": []interface{}{"a", "b"}}, args)
+	if err != nil {
+		t.Fatalf("Error decoding args: %s", err)
+	}
+
+	if args.Src != "./names.csv" || args.Separator != "\n" || args.Min != 5 || len(args.Names) != 2 {
+		t.Errorf("Args weren't decoded correctly: %+v", args)
+	}
+}
+
+func TestDecodeArgsReportsProblems(t *testing.T) {
+	args := &testArgs{}
+
+	err := DecodeArgs("test", map[string]interface{}{"separator": 5.0, "min": 1.5, "sep": ","}, args)
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+
+	for _, expected := range []string{
+		"argument 'src' is required",
+		"argument 'separator' must be a string, got the number 5",
+		"argument 'min' must be a whole number",
+		"unknown argument(s) 'sep'",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain \"%s\", got: %s", expected, err)
+		}
+	}
+}
+
+func TestDecodeArgsAcceptsTypedValues(t *testing.T) {
+	args := &testArgs{}
+
+	// like the args of configurations built in code rather than decoded from json
+	err := DecodeArgs("test", map[string]interface{}{"src": "./names.csv", "min": int32(3), "names": []string{"a", "b", "c"}}, args)
+	if err != nil {
+		t.Fatalf("Error decoding args: %s", err)
+	}
+
+	if args.Min != 3 || len(args.Names) != 3 || args.Names[2] != "c" {
+		t.Errorf("Args weren't decoded correctly: %+v", args)
+	}
+}
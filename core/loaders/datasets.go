@@ -0,0 +1,482 @@
+package loaders
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Datasets are the values of files split by a separator, like csvloader's; a separator at the end of a file, like a
+// trailing newline, doesn't start another value. They're parsed once per process and shared
+// by every loader reading the same file with the same separator, and parsed again when the file changes. With an index
+// directory set, the offsets of each file's values are also kept on disk, so later processes skip splitting the file.
+// Files too large to load are read through a datasetReader instead, which only keeps their offsets in memory.
+
+type datasetKey struct {
+	path      string
+	separator string
+}
+
+type dataset struct {
+	size    int64
+	modTime int64
+	values  []string
+}
+
+var datasetCache = struct {
+	sync.Mutex
+	entries  map[datasetKey]*dataset
+	indexes  map[datasetKey]*datasetIndex
+	indexDir string
+}{entries: make(map[datasetKey]*dataset), indexes: make(map[datasetKey]*datasetIndex)}
+
+// SetDatasetIndexDir keeps indexes of the datasets loaders read in dir, creating it if needed; an empty dir stops
+// indexing
+func SetDatasetIndexDir(dir string) {
+	datasetCache.Lock()
+	defer datasetCache.Unlock()
+
+	datasetCache.indexDir = dir
+}
+
+// ClearDatasets forgets the datasets parsed so far, e.g. to free their memory in a long-lived process
+func ClearDatasets() {
+	datasetCache.Lock()
+	defer datasetCache.Unlock()
+
+	datasetCache.entries = make(map[datasetKey]*dataset)
+	datasetCache.indexes = make(map[datasetKey]*datasetIndex)
+}
+
+// loadDataset returns the values of the file at path split by separator; the values are shared, so they mustn't be
+// modified
+func loadDataset(path string, separator string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	datasetCache.Lock()
+	defer datasetCache.Unlock()
+
+	key := datasetKey{path: path, separator: separator}
+	if entry, ok := datasetCache.entries[key]; ok && entry.size == info.Size() && entry.modTime == info.ModTime().UnixNano() {
+		return entry.values, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &dataset{size: info.Size(), modTime: info.ModTime().UnixNano()}
+	text := string(content)
+
+	// splitting by runes isn't worth indexing
+	if len(separator) == 0 {
+		entry.values = strings.Split(text, separator)
+		datasetCache.entries[key] = entry
+
+		return entry.values, nil
+	}
+
+	index := readDatasetIndex(datasetCache.indexDir, key, info, func() ([sha256.Size]byte, error) {
+		return sha256.Sum256(content), nil
+	})
+
+	if index == nil {
+		// reading from memory can't fail
+		index, _ = scanDatasetIndex(bytes.NewReader(content), info, separator)
+		writeDatasetIndex(datasetCache.indexDir, key, index)
+	}
+
+	entry.values = index.values(text, separator)
+	datasetCache.entries[key] = entry
+
+	return entry.values, nil
+}
+
+// datasetIndex is where each of a file's values starts, and what the file was when it was indexed
+type datasetIndex struct {
+	size    int64
+	modTime int64
+	hash    [sha256.Size]byte
+
+	starts []int64
+}
+
+// loadDatasetIndex returns where the values of the file at path start, reading it a block at a time rather than
+// keeping it in memory
+func loadDatasetIndex(path string, separator string) (*datasetIndex, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	datasetCache.Lock()
+	defer datasetCache.Unlock()
+
+	key := datasetKey{path: path, separator: separator}
+	if index, ok := datasetCache.indexes[key]; ok && index.size == info.Size() && index.modTime == info.ModTime().UnixNano() {
+		return index, nil
+	}
+
+	index := readDatasetIndex(datasetCache.indexDir, key, info, func() ([sha256.Size]byte, error) {
+		return hashFile(path)
+	})
+
+	if index == nil {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		index, err = scanDatasetIndex(file, info, separator)
+		file.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		writeDatasetIndex(datasetCache.indexDir, key, index)
+	}
+
+	datasetCache.indexes[key] = index
+	return index, nil
+}
+
+// bytes read at a time while indexing a file
+const datasetScanSize = 1 << 20
+
+// scanDatasetIndex finds where the values of the file r reads start, and hashes it
+func scanDatasetIndex(r io.Reader, info os.FileInfo, separator string) (*datasetIndex, error) {
+	index := &datasetIndex{size: info.Size(), modTime: info.ModTime().UnixNano(), starts: []int64{0}}
+	hash := sha256.New()
+
+	sep := []byte(separator)
+	chunk := make([]byte, datasetScanSize)
+
+	// what's left of the last chunk that could be the start of a separator, and where it is in the file
+	buf := make([]byte, 0, datasetScanSize+len(sep))
+	offset := int64(0)
+
+	for {
+		n, err := r.Read(chunk)
+		hash.Write(chunk[:n])
+		buf = append(buf, chunk[:n]...)
+
+		i := 0
+		for {
+			j := bytes.Index(buf[i:], sep)
+			if j < 0 {
+				break
+			}
+
+			i += j + len(sep)
+			index.starts = append(index.starts, offset+int64(i))
+		}
+
+		keep := len(sep) - 1
+		if rest := len(buf) - i; rest < keep {
+			keep = rest
+		}
+
+		offset += int64(len(buf) - keep)
+		buf = append(buf[:0], buf[len(buf)-keep:]...)
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	copy(index.hash[:], hash.Sum(nil))
+	return index, nil
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return sum, err
+	}
+
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
+
+// len is the number of values in the file; a value starting at its end is the empty one strings.Split would find after
+// a trailing separator (or in an empty file), so it isn't counted, but its start still marks where the last value ends
+func (index *datasetIndex) len() int {
+	n := len(index.starts)
+	if n > 0 && index.starts[n-1] == index.size {
+		n--
+	}
+
+	return n
+}
+
+func (index *datasetIndex) values(text string, separator string) []string {
+	values := make([]string, index.len())
+	for i := range values {
+		start, end := index.starts[i], int64(len(text))
+		if i+1 < len(index.starts) {
+			end = index.starts[i+1] - int64(len(separator))
+		}
+
+		values[i] = text[start:end]
+	}
+
+	return values
+}
+
+// fits is true if the index's values could be in a file of its size, so a damaged index can't slice outside it
+func (index *datasetIndex) fits(separatorLength int) bool {
+	if len(index.starts) == 0 || index.starts[0] != 0 {
+		return false
+	}
+
+	for i := 1; i < len(index.starts); i++ {
+		if index.starts[i]-index.starts[i-1] < int64(separatorLength) {
+			return false
+		}
+	}
+
+	return index.starts[len(index.starts)-1] <= index.size
+}
+
+// an index file is this header, the indexed file's size, modification time and hash, then the number of values and
+// the gaps between their starts as varints
+var datasetIndexHeader = []byte("oar-dataset-index 1\n")
+
+// datasetIndexPath names an index after the file and separator it's for, so files with the same name don't clash
+func datasetIndexPath(dir string, key datasetKey) string {
+	sum := sha256.Sum256([]byte(key.path + "\x00" + key.separator))
+	return filepath.Join(dir, filepath.Base(key.path)+"-"+hex.EncodeToString(sum[:8])+".idx")
+}
+
+// readDatasetIndex returns the index of the file if there's one for it as it is now, or nil. A file that was only
+// touched since it was indexed has the same hash, and its index is kept with the new modification time.
+func readDatasetIndex(dir string, key datasetKey, info os.FileInfo, hash func() ([sha256.Size]byte, error)) *datasetIndex {
+	if len(dir) == 0 {
+		return nil
+	}
+
+	path := datasetIndexPath(dir, key)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+
+	index, err := decodeDatasetIndex(bufio.NewReader(file))
+	file.Close()
+
+	if err != nil || index.size != info.Size() || !index.fits(len(key.separator)) {
+		return nil
+	}
+
+	if modTime := info.ModTime().UnixNano(); index.modTime != modTime {
+		if sum, err := hash(); err != nil || sum != index.hash {
+			return nil
+		}
+
+		index.modTime = modTime
+		writeDatasetIndex(dir, key, index)
+	}
+
+	return index
+}
+
+// writeDatasetIndex keeps index in dir if it's set; failing to is only slower, so errors are ignored
+func writeDatasetIndex(dir string, key datasetKey, index *datasetIndex) {
+	if len(dir) == 0 || os.MkdirAll(dir, 0755) != nil {
+		return
+	}
+
+	path := datasetIndexPath(dir, key)
+
+	// written next to the index and renamed over it, so other processes never read half an index
+	file, err := ioutil.TempFile(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return
+	}
+
+	w := bufio.NewWriter(file)
+	err = encodeDatasetIndex(w, index)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+	}
+}
+
+func encodeDatasetIndex(w io.Writer, index *datasetIndex) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	put := func(n int64) error {
+		_, err := w.Write(buf[:binary.PutVarint(buf, n)])
+		return err
+	}
+
+	if _, err := w.Write(datasetIndexHeader); err != nil {
+		return err
+	}
+
+	if err := put(index.size); err != nil {
+		return err
+	}
+
+	if err := put(index.modTime); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(index.hash[:]); err != nil {
+		return err
+	}
+
+	if err := put(int64(len(index.starts))); err != nil {
+		return err
+	}
+
+	previous := int64(0)
+	for _, start := range index.starts {
+		if err := put(start - previous); err != nil {
+			return err
+		}
+
+		previous = start
+	}
+
+	return nil
+}
+
+func decodeDatasetIndex(r *bufio.Reader) (*datasetIndex, error) {
+	header := make([]byte, len(datasetIndexHeader))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, datasetIndexHeader) {
+		return nil, fmt.Errorf("not a dataset index")
+	}
+
+	index := &datasetIndex{}
+
+	var err error
+	if index.size, err = binary.ReadVarint(r); err != nil {
+		return nil, err
+	}
+
+	if index.modTime, err = binary.ReadVarint(r); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.ReadFull(r, index.hash[:]); err != nil {
+		return nil, err
+	}
+
+	count, err := binary.ReadVarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// a file has at most one value per byte, plus the one after its last separator
+	if count < 0 || count > index.size+1 {
+		return nil, fmt.Errorf("invalid number of values %d", count)
+	}
+
+	index.starts = make([]int64, count)
+
+	previous := int64(0)
+	for i := range index.starts {
+		gap, err := binary.ReadVarint(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if gap < 0 {
+			return nil, fmt.Errorf("invalid value offset")
+		}
+
+		previous += gap
+		index.starts[i] = previous
+	}
+
+	return index, nil
+}
+
+// datasetReader reads the values of a file from it as they're needed, using its index to find them
+type datasetReader struct {
+	file      *os.File
+	index     *datasetIndex
+	separator int
+}
+
+func openDatasetReader(path string, separator string) (*datasetReader, error) {
+	if len(separator) == 0 {
+		return nil, fmt.Errorf("values can't be read from a file without a separator")
+	}
+
+	index, err := loadDatasetIndex(path, separator)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &datasetReader{file: file, index: index, separator: len(separator)}, nil
+}
+
+func (reader *datasetReader) len() int {
+	return reader.index.len()
+}
+
+// value reads the i-th value; it's safe to call from several goroutines
+func (reader *datasetReader) value(i int) (string, error) {
+	starts := reader.index.starts
+
+	start, end := starts[i], reader.index.size
+	if i+1 < len(starts) {
+		end = starts[i+1] - int64(reader.separator)
+	}
+
+	buf := make([]byte, end-start)
+	if n, err := reader.file.ReadAt(buf, start); n < len(buf) {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+func (reader *datasetReader) Close() error {
+	return reader.file.Close()
+}
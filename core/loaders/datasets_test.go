@@ -0,0 +1,246 @@
+package loaders
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+func TestDatasetsAreSplitBySeparators(t *testing.T) {
+	dir := t.TempDir()
+	defer ClearDatasets()
+
+	// a separator at the end of a file doesn't start another value
+	for i, c := range []struct {
+		content, separator string
+		expected           []string
+	}{
+		{"a\nb\nc\n", "\n", []string{"a", "b", "c"}},
+		{"a\n\nb\n\n", "\n", []string{"a", "", "b", ""}},
+		{"a, b,, c", ", ", []string{"a", "b,", "c"}},
+		{"", "\n", []string{}},
+		{"héllo", "", []string{"h", "é", "l", "l", "o"}},
+	} {
+		path := filepath.Join(dir, "data"+string(rune('a'+i)))
+		if err := ioutil.WriteFile(path, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		values, err := loadDataset(path, c.separator)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(values, c.expected) {
+			t.Errorf("Expected %q split by %q to be %q, got %q", c.content, c.separator, c.expected, values)
+		}
+	}
+}
+
+func TestDatasetsAreSharedUntilTheirFileChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "names.csv")
+	defer ClearDatasets()
+
+	if err := ioutil.WriteFile(path, []byte("ann\nbob"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := loadDataset(path, "\n")
+	second, _ := loadDataset(path, "\n")
+	if &first[0] != &second[0] {
+		t.Errorf("Expected loaders reading the same file to share its values")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("ann\nbob\ncy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, _ := loadDataset(path, "\n"); len(changed) != 3 {
+		t.Errorf("Expected a changed file to be read again, got %q", changed)
+	}
+}
+
+func TestDatasetIndexesAreKeptOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "names.csv")
+	indexDir := filepath.Join(dir, "cache")
+
+	SetDatasetIndexDir(indexDir)
+	defer SetDatasetIndexDir("")
+	defer ClearDatasets()
+
+	if err := ioutil.WriteFile(path, []byte("ann\nbob\ncy\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := loadDataset(path, "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := datasetKey{path: path, separator: "\n"}
+	indexPath := datasetIndexPath(indexDir, key)
+
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		t.Fatalf("Expected an index to be written: %s", err)
+	}
+
+	// a file that's only touched keeps its index, with the new modification time
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	ClearDatasets()
+	if values, _ := loadDataset(path, "\n"); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected the indexed values %q, got %q", expected, values)
+	}
+
+	file, _ := os.Open(indexPath)
+	index, err := decodeDatasetIndex(bufio.NewReader(file))
+	file.Close()
+
+	if err != nil || index.modTime != later.UnixNano() {
+		t.Errorf("Expected the index to be updated for the touched file, got %+v (%v)", index, err)
+	}
+
+	// a damaged index is ignored
+	if err := ioutil.WriteFile(indexPath, append(append([]byte{}, datasetIndexHeader...), 1, 2, 3), info.Mode()); err != nil {
+		t.Fatal(err)
+	}
+
+	ClearDatasets()
+	if values, _ := loadDataset(path, "\n"); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected a damaged index to be rebuilt, got %q", values)
+	}
+}
+
+func TestDatasetIndexesAreScannedABlockAtATime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "values")
+
+	for _, c := range []struct {
+		content, separator string
+		expected           []string
+	}{
+		{"ann\nbob\ncy\n", "\n", []string{"ann", "bob", "cy"}},
+		{"a, b,, c, ", ", ", []string{"a", "b,", "c"}},
+		{"a--b---c----d", "--", []string{"a", "b", "-c", "", "d"}},
+	} {
+		if err := ioutil.WriteFile(path, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		info, _ := os.Stat(path)
+
+		// one byte at a time, so separators are split between reads
+		index, err := scanDatasetIndex(iotest.OneByteReader(strings.NewReader(c.content)), info, c.separator)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if values := index.values(c.content, c.separator); !reflect.DeepEqual(values, c.expected) {
+			t.Errorf("Expected %q split by %q to be %q, got %q", c.content, c.separator, c.expected, values)
+		}
+	}
+}
+
+func TestCsvLoaderSeekModePicksTheSameValues(t *testing.T) {
+	defer ClearDatasets()
+
+	ctx := make(TypeLoaderFactoryContext)
+	AddDefaultLoaderFactories(&ctx)
+
+	newLoader := func(mode string) TypeLoader {
+		loader, err := ctx.NewLoader(conf.NewConfiguration(), &conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{
+			Name: "csvloader",
+			Args: map[string]interface{}{"src": "../../data/lastnames.csv", "mode": mode},
+		}})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return loader
+	}
+
+	memory, seek := newLoader("memory"), newLoader("seek")
+	defer seek.(io.Closer).Close()
+
+	config := conf.NewConfiguration()
+	for i := 0; i < 100; i++ {
+		expected, _ := memory.GenerateSingleValue(config, res.NewResultsRow(i, int64(i)))
+
+		value, err := seek.GenerateSingleValue(config, res.NewResultsRow(i, int64(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != expected {
+			t.Errorf("Expected row %d to get %v from the file, got %v", i, expected, value)
+		}
+	}
+
+	if _, err := ctx.NewLoader(config, &conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{
+		Name: "csvloader",
+		Args: map[string]interface{}{"src": "../../data/lastnames.csv", "mode": "mmap"},
+	}}); err == nil || !strings.Contains(err.Error(), "mode must be memory or seek") {
+		t.Errorf("Expected an unknown mode to be reported, got %v", err)
+	}
+}
+
+func TestCsvLoaderNeverPicksTheEmptyValueAfterATrailingNewline(t *testing.T) {
+	dir := t.TempDir()
+	defer ClearDatasets()
+
+	ctx := make(TypeLoaderFactoryContext)
+	AddDefaultLoaderFactories(&ctx)
+
+	names, empty := filepath.Join(dir, "names.csv"), filepath.Join(dir, "empty.csv")
+	if err := ioutil.WriteFile(names, []byte("ann\nbob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(empty, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := conf.NewConfiguration()
+	newLoader := func(src string, mode string) (TypeLoader, error) {
+		return ctx.NewLoader(config, &conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{
+			Name: "csvloader",
+			Args: map[string]interface{}{"src": src, "mode": mode},
+		}})
+	}
+
+	for _, mode := range []string{"memory", "seek"} {
+		loader, err := newLoader(names, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 100; i++ {
+			if value, err := loader.GenerateSingleValue(config, res.NewResultsRow(i, int64(i))); err != nil || value == "" {
+				t.Fatalf("Expected %s mode to pick a name, got %q (%v)", mode, value, err)
+			}
+		}
+
+		if closer, ok := loader.(io.Closer); ok {
+			closer.Close()
+		}
+
+		if _, err := newLoader(empty, mode); err == nil || !strings.Contains(err.Error(), "has no values") {
+			t.Errorf("Expected %s mode to reject a file without values, got %v", mode, err)
+		}
+	}
+}
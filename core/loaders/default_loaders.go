@@ -1,47 +1,150 @@
 package loaders
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"math/rand"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elauffenburger/oar/core/common"
 	conf "github.com/elauffenburger/oar/core/configuration"
 	res "github.com/elauffenburger/oar/core/results"
+	"github.com/elauffenburger/oar/core/schema"
 	"github.com/satori/go.uuid"
 )
 
 type FnTypeLoader struct {
 	typeLoader
 
+	// pointer to the loader's args struct; raw args are decoded into it before loadFn is called
+	args interface{}
+
 	loadFn                TypeLoaderLoadFn
 	generateSingleValueFn TypeLoaderGenerateSingleValueFn
+
+	// optional; for loaders with state for a single run, or resources to release
+	resetFn func(run *res.Run) error
+	closeFn func() error
 }
 
-func (loader *FnTypeLoader) Load(dto *conf.UseTypeDTO) {
-	loader.loadFn(dto)
+type noArgs struct{}
+
+func (loader *FnTypeLoader) ArgsSchema() *schema.Schema {
+	if loader.args == nil {
+		return nil
+	}
+
+	return ArgsSchemaFor(loader.args)
+}
+
+func (loader *FnTypeLoader) Load(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+	if loader.args != nil {
+		if err := DecodeArgs(dto.LoaderArgs.Name, dto.LoaderArgs.Args, loader.args); err != nil {
+			return err
+		}
+	}
+
+	if loader.loadFn == nil {
+		return nil
+	}
+
+	return loader.loadFn(config, dto)
 }
 
 func (loader *FnTypeLoader) GenerateSingleValue(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
 	return loader.generateSingleValueFn(config, set)
 }
 
+func (loader *FnTypeLoader) Reset(run *res.Run) error {
+	if loader.resetFn == nil {
+		return nil
+	}
+
+	return loader.resetFn(run)
+}
+
+func (loader *FnTypeLoader) Close() error {
+	if loader.closeFn == nil {
+		return nil
+	}
+
+	return loader.closeFn()
+}
+
 func addCsvLoaderFactory(ctx *TypeLoaderFactoryContext) {
+	type csvLoaderArgs struct {
+		Src       string `arg:"src,required" desc:"path to the file to pick values from; relative paths are relative to the config file"`
+		Separator string `arg:"separator" default:"\n" desc:"separator between values in the file"`
+		Mode      string `arg:"mode" default:"memory" desc:"memory loads the file's values, seek only keeps where each starts and reads them from the file as they're picked, for files too large to load"`
+	}
+
 	fn := func() TypeLoader {
-		loader := &FnTypeLoader{}
+		args := &csvLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			src := config.ResolvePath(args.Src)
+
+			var data interface{}
+			var err error
+
+			switch args.Mode {
+			case "memory":
+				data, err = loadDataset(src, args.Separator)
+			case "seek":
+				data, err = openDatasetReader(src, args.Separator)
+			default:
+				return fmt.Errorf("csvloader: mode must be memory or seek (got '%s')", args.Mode)
+			}
+
+			if err != nil {
+				if os.IsNotExist(err) {
+					return fmt.Errorf("csvloader: file '%s' does not exist", src)
+				}
 
-		loader.loadFn = func(dto *conf.UseTypeDTO) {
-			src := dto.LoaderArgs.Args["src"].(string)
-			sep := dto.LoaderArgs.Args["separator"].(string)
+				return fmt.Errorf("csvloader: failed to read file '%s': %s", src, err)
+			}
 
-			content, _ := common.ReadContentFromFileAndSplit(src, sep)
-			loader.LoaderData = content
+			if reader, ok := data.(*datasetReader); ok && reader.len() == 0 {
+				reader.Close()
+				return fmt.Errorf("csvloader: file '%s' has no values", src)
+			}
+
+			if values, ok := data.([]string); ok && len(values) == 0 {
+				return fmt.Errorf("csvloader: file '%s' has no values", src)
+			}
+
+			loader.LoaderData = data
+			return nil
 		}
 
+		// both modes pick a value's index the same way, so the same seed picks the same values
 		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			if reader, ok := loader.LoaderData.(*datasetReader); ok {
+				value, err := reader.value(set.Rand.Intn(reader.len()))
+				if err != nil {
+					return nil, fmt.Errorf("csvloader: failed to read file '%s': %s", reader.file.Name(), err)
+				}
+
+				return value, nil
+			}
+
 			content := loader.LoaderData.([]string)
 
-			return common.GetRandomValue(&content), nil
+			return common.GetRandomValue(set.Rand, &content), nil
+		}
+
+		loader.closeFn = func() error {
+			if reader, ok := loader.LoaderData.(*datasetReader); ok {
+				return reader.Close()
+			}
+
+			return nil
 		}
 
 		return loader
@@ -51,15 +154,118 @@ func addCsvLoaderFactory(ctx *TypeLoaderFactoryContext) {
 }
 
 func addNumberFactory(ctx *TypeLoaderFactoryContext) {
+	type numberLoaderArgs struct {
+		Min int64  `arg:"min" default:"0" desc:"smallest number to generate"`
+		Max *int64 `arg:"max" desc:"largest number to generate (default: the largest int64)"`
+
+		Decimals int   `arg:"decimals" default:"0" desc:"digits after the decimal point"`
+		Step     int64 `arg:"step" default:"1" desc:"only generate min plus a multiple of step"`
+
+		Weights []float64 `arg:"weights" desc:"relative weight of equal-width buckets between min and max (default: all numbers are equally likely)"`
+	}
+
 	fn := func() TypeLoader {
-		loader := &FnTypeLoader{}
+		args := &numberLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		// running totals of the bucket weights, like choice's
+		var totals []float64
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if args.Max == nil {
+				max := int64(math.MaxInt64)
+				args.Max = &max
+			}
+
+			if args.Min > *args.Max {
+				return fmt.Errorf("number: min (%d) is greater than max (%d)", args.Min, *args.Max)
+			}
+
+			if args.Decimals < 0 {
+				return fmt.Errorf("number: decimals can't be negative (got %d)", args.Decimals)
+			}
+
+			if args.Step < 1 {
+				return fmt.Errorf("number: step must be at least 1 (got %d)", args.Step)
+			}
+
+			if len(args.Weights) == 0 {
+				return nil
+			}
+
+			if args.Step > 1 {
+				return fmt.Errorf("number: weights can't be used with step")
+			}
 
-		loader.loadFn = func(dto *conf.UseTypeDTO) {
+			totals = make([]float64, len(args.Weights))
+			total := 0.0
+
+			for i, weight := range args.Weights {
+				if weight < 0 {
+					return fmt.Errorf("number: weights can't be negative (got %v)", weight)
+				}
+
+				total += weight
+				totals[i] = total
+			}
 
+			if total == 0 {
+				return fmt.Errorf("number: at least one weight must be greater than 0")
+			}
+
+			return nil
 		}
 
 		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
-			return rand.Int63(), nil
+			min, max := args.Min, *args.Max
+
+			if len(totals) != 0 {
+				r := set.Rand.Float64() * totals[len(totals)-1]
+				i := sort.Search(len(totals), func(i int) bool { return totals[i] > r })
+
+				// narrow the range to the bucket; whole numbers on a boundary belong to the bucket above it
+				width := (float64(max) - float64(min)) / float64(len(totals))
+				lo, hi := float64(min)+width*float64(i), float64(min)+width*float64(i+1)
+
+				if args.Decimals > 0 {
+					value := lo + set.Rand.Float64()*(hi-lo)
+					return strconv.FormatFloat(value, 'f', args.Decimals, 64), nil
+				}
+
+				min = int64(math.Ceil(lo))
+				if i != len(totals)-1 {
+					max = int64(math.Ceil(hi)) - 1
+				}
+
+				if max < min {
+					max = min
+				}
+			}
+
+			if args.Decimals > 0 {
+				value := float64(min) + set.Rand.Float64()*(float64(max)-float64(min))
+				return strconv.FormatFloat(value, 'f', args.Decimals, 64), nil
+			}
+
+			span := uint64(max) - uint64(min)
+
+			if args.Step > 1 {
+				steps := span / uint64(args.Step)
+				if steps >= math.MaxInt64 {
+					return min + int64(set.Rand.Uint64()%(steps+1)*uint64(args.Step)), nil
+				}
+
+				return min + set.Rand.Int63n(int64(steps)+1)*args.Step, nil
+			}
+
+			switch {
+			case span == math.MaxUint64:
+				return int64(set.Rand.Uint64()), nil
+			case span >= math.MaxInt64:
+				return min + int64(set.Rand.Uint64()%(span+1)), nil
+			}
+
+			return min + set.Rand.Int63n(int64(span)+1), nil
 		}
 
 		return loader
@@ -68,16 +274,89 @@ func addNumberFactory(ctx *TypeLoaderFactoryContext) {
 	ctx.AddLoaderFactory("number", fn)
 }
 
+// layouts accepted for datetime's min and max
+var dateTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// named layouts for datetime's format
+var dateTimeFormats = map[string]string{
+	"date":     "2006-01-02",
+	"time":     "15:04:05",
+	"datetime": "2006-01-02 15:04:05",
+	"rfc3339":  time.RFC3339,
+}
+
 func addDateTimeFactory(ctx *TypeLoaderFactoryContext) {
+	type dateTimeLoaderArgs struct {
+		Min    string `arg:"min" desc:"earliest time to generate, e.g. \"2000-01-01\" or \"2000-01-01T12:00:00Z\""`
+		Max    string `arg:"max" desc:"latest time to generate (default when min is set: 2038-01-19)"`
+		Format string `arg:"format" desc:"date, time, datetime, rfc3339, unix or a Go time layout (default: Go's time format)"`
+	}
+
+	parse := func(name string, value string) (time.Time, error) {
+		for _, layout := range dateTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, nil
+			}
+		}
+
+		return time.Time{}, fmt.Errorf("datetime: can't parse %s '%s'; expected a date like 2006-01-02 or an RFC 3339 time", name, value)
+	}
+
 	fn := func() TypeLoader {
-		loader := &FnTypeLoader{}
+		args := &dateTimeLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		var min, max time.Time
+		ranged := false
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if args.Min == "" && args.Max == "" {
+				return nil
+			}
 
-		loader.loadFn = func(dto *conf.UseTypeDTO) {
+			ranged = true
+			min, max = time.Unix(0, 0).UTC(), time.Unix(math.MaxInt32, 0).UTC()
+
+			var err error
+			if args.Min != "" {
+				if min, err = parse("min", args.Min); err != nil {
+					return err
+				}
+			}
+
+			if args.Max != "" {
+				if max, err = parse("max", args.Max); err != nil {
+					return err
+				}
+			}
+
+			if min.After(max) {
+				return fmt.Errorf("datetime: min (%s) is after max (%s)", args.Min, args.Max)
+			}
 
+			return nil
 		}
 
 		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
-			return time.Unix(rand.Int63(), rand.Int63()), nil
+			var t time.Time
+			if ranged {
+				t = time.Unix(min.Unix()+set.Rand.Int63n(max.Unix()-min.Unix()+1), 0).UTC()
+			} else {
+				t = time.Unix(set.Rand.Int63(), set.Rand.Int63())
+			}
+
+			switch args.Format {
+			case "":
+				return t, nil
+			case "unix":
+				return t.Unix(), nil
+			}
+
+			if layout, ok := dateTimeFormats[args.Format]; ok {
+				return t.Format(layout), nil
+			}
+
+			return t.Format(args.Format), nil
 		}
 
 		return loader
@@ -88,63 +367,408 @@ func addDateTimeFactory(ctx *TypeLoaderFactoryContext) {
 
 func addStrFormatFactory(ctx *TypeLoaderFactoryContext) {
 	type strLoaderArgs struct {
-		Format string
-		Args   []string
+		Format string   `arg:"format,required" desc:"fmt-style format string, e.g. \"%s.%s@mailinator.com\""`
+		Args   []string `arg:"args" default:"[]" desc:"names of the fields whose values fill in the format's verbs"`
+	}
+
+	fn := func() TypeLoader {
+		args := &strLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			values := make([]interface{}, len(args.Args))
+			for i, k := range args.Args {
+				value, err := set.Values.GetEntryWithName(k)
+				if err != nil {
+					return nil, fmt.Errorf("strformat: no value for field '%s'; fields can only use fields defined before them", k)
+				}
+
+				values[i] = value.Value
+			}
+
+			return fmt.Sprintf(args.Format, values...), nil
+		}
+
+		return loader
+	}
+
+	ctx.AddLoaderFactory("strformat", fn)
+}
+
+func addChoiceFactory(ctx *TypeLoaderFactoryContext) {
+	type choiceLoaderArgs struct {
+		Values  []interface{} `arg:"values,required" desc:"values to pick from; null picks a null"`
+		Weights []float64     `arg:"weights" desc:"relative weight of each value (default: all equal)"`
+	}
+
+	fn := func() TypeLoader {
+		args := &choiceLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		// running totals of the weights, searched with a random number in [0, total)
+		var totals []float64
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if len(args.Values) == 0 {
+				return fmt.Errorf("choice: values can't be empty")
+			}
+
+			if len(args.Weights) != 0 && len(args.Weights) != len(args.Values) {
+				return fmt.Errorf("choice: got %d weights for %d values", len(args.Weights), len(args.Values))
+			}
+
+			totals = make([]float64, len(args.Values))
+			total := 0.0
+
+			for i := range args.Values {
+				weight := 1.0
+				if len(args.Weights) != 0 {
+					weight = args.Weights[i]
+				}
+
+				if weight < 0 {
+					return fmt.Errorf("choice: weights can't be negative (got %v)", weight)
+				}
+
+				total += weight
+				totals[i] = total
+			}
+
+			if total == 0 {
+				return fmt.Errorf("choice: at least one weight must be greater than 0")
+			}
+
+			return nil
+		}
+
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			r := set.Rand.Float64() * totals[len(totals)-1]
+			i := sort.Search(len(totals), func(i int) bool { return totals[i] > r })
+
+			return args.Values[i], nil
+		}
+
+		return loader
+	}
+
+	ctx.AddLoaderFactory("choice", fn)
+}
+
+// named character sets for text's charset
+var textCharsets = map[string]string{
+	"alpha":        "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alphanumeric": "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789",
+	"lower":        "abcdefghijklmnopqrstuvwxyz",
+	"upper":        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"numeric":      "0123456789",
+	"hex":          "0123456789abcdef",
+}
+
+func addTextFactory(ctx *TypeLoaderFactoryContext) {
+	type textLoaderArgs struct {
+		MinLength int    `arg:"minlength" default:"1" desc:"shortest text to generate, not counting prefix and suffix"`
+		MaxLength int    `arg:"maxlength" default:"16" desc:"longest text to generate, not counting prefix and suffix"`
+		Charset   string `arg:"charset" default:"alpha" desc:"alpha, alphanumeric, lower, upper, numeric, hex or the characters to use"`
+		Prefix    string `arg:"prefix" desc:"text to put before each value"`
+		Suffix    string `arg:"suffix" desc:"text to put after each value"`
 	}
 
 	fn := func() TypeLoader {
-		loader := &FnTypeLoader{}
+		args := &textLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
 
-		loader.loadFn = func(dto *conf.UseTypeDTO) {
-			format := dto.LoaderArgs.Args["format"].(string)
-			argsRaw := dto.LoaderArgs.Args["args"].([]interface{})
+		var charset []rune
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if args.MinLength < 0 || args.MinLength > args.MaxLength {
+				return fmt.Errorf("text: expected 0 <= minlength <= maxlength, got minlength %d and maxlength %d", args.MinLength, args.MaxLength)
+			}
+
+			if named, ok := textCharsets[args.Charset]; ok {
+				charset = []rune(named)
+			} else {
+				charset = []rune(args.Charset)
+			}
 
-			args := make([]string, len(argsRaw))
-			for i, a := range argsRaw {
-				args[i] = fmt.Sprintf("%s", a)
+			if len(charset) == 0 {
+				return fmt.Errorf("text: charset can't be empty")
 			}
 
-			loader.LoaderData = interface{}(strLoaderArgs{Format: format, Args: args})
+			return nil
 		}
 
 		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
-			data := loader.LoaderData.(strLoaderArgs)
+			length := args.MinLength + set.Rand.Intn(args.MaxLength-args.MinLength+1)
 
-			args := make([]interface{}, len(data.Args))
-			for i, k := range data.Args {
-				value, err := set.Values.GetEntryWithName(k)
+			var builder strings.Builder
+			builder.WriteString(args.Prefix)
+			for i := 0; i < length; i++ {
+				builder.WriteRune(charset[set.Rand.Intn(len(charset))])
+			}
+			builder.WriteString(args.Suffix)
+
+			return builder.String(), nil
+		}
+
+		return loader
+	}
+
+	ctx.AddLoaderFactory("text", fn)
+}
+
+func addRegexFactory(ctx *TypeLoaderFactoryContext) {
+	type regexLoaderArgs struct {
+		Pattern   string `arg:"pattern,required" desc:"regular expression (Go syntax) that values match, e.g. \"[A-Z]{3}-[0-9]{4}\""`
+		MaxRepeat int    `arg:"maxrepeat" default:"8" desc:"most times *, + and {n,} repeat beyond their minimum"`
+	}
+
+	fn := func() TypeLoader {
+		args := &regexLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		var gen *regexGenerator
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if args.MaxRepeat < 0 {
+				return fmt.Errorf("regex: maxrepeat can't be negative (got %d)", args.MaxRepeat)
+			}
+
+			var err error
+			if gen, err = newRegexGenerator(args.Pattern, args.MaxRepeat); err != nil {
+				return fmt.Errorf("regex: invalid pattern '%s': %s", args.Pattern, err)
+			}
+
+			return nil
+		}
+
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			value, err := gen.generate(set.Rand)
+			if err != nil {
+				return nil, fmt.Errorf("regex: %s", err)
+			}
+
+			return value, nil
+		}
+
+		return loader
+	}
+
+	ctx.AddLoaderFactory("regex", fn)
+}
+
+// nestedValue generates a value for field with loader the way the engine does for top-level fields,
+// returning nil for nulls
+func nestedValue(config *conf.Configuration, field *conf.ConfigurationField, loader TypeLoader, set *res.ResultsRow) (*res.ResultsRowValue, error) {
+	val, err := loader.GenerateSingleValue(config, set)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &res.ResultsRowValue{ConfigurationField: *field}
+	if val == nil || field.NullRate > 0 && set.Rand.Float64() < field.NullRate {
+		entry.Null = true
+	} else {
+		entry.Value = fmt.Sprint(val)
+	}
+
+	return entry, nil
+}
+
+// nestedLoader creates the loader for a field of a nested object or the items of an array
+func nestedLoader(ctx *TypeLoaderFactoryContext, config *conf.Configuration, field *conf.ConfigurationField) (TypeLoader, error) {
+	t, err := config.ResolveFieldType(field)
+	if err != nil {
+		return nil, err
+	}
+
+	return ctx.NewLoader(config, t)
+}
+
+func addObjectFactory(ctx *TypeLoaderFactoryContext) {
+	type objectLoaderArgs struct {
+		Fields []interface{} `arg:"fields,required" desc:"fields of the object, written like a config's fields"`
+	}
+
+	fn := func() TypeLoader {
+		args := &objectLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		var fields conf.ConfigurationFields
+		var fieldLoaders []TypeLoader
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			raw, err := json.Marshal(args.Fields)
+			if err == nil {
+				err = json.Unmarshal(raw, &fields)
+			}
+
+			if err != nil {
+				return fmt.Errorf("object: invalid fields: %s", err)
+			}
+
+			fieldLoaders = make([]TypeLoader, len(fields))
+			for i, field := range fields {
+				if fieldLoaders[i], err = nestedLoader(ctx, config, field); err != nil {
+					return fmt.Errorf("object: field '%s': %s", field.Name, err)
+				}
+			}
+
+			return nil
+		}
+
+		loader.resetFn = func(run *res.Run) error {
+			return ResetTypeLoaders(fieldLoaders, run)
+		}
+
+		loader.closeFn = func() error {
+			return CloseTypeLoaders(fieldLoaders)
+		}
+
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			// nested fields can refer to each other, so they get a row of their own
+			nested := &res.ResultsRow{Index: set.Index, Rand: set.Rand, Run: set.Run}
+
+			var buf bytes.Buffer
+			buf.WriteString("{")
+
+			for i, field := range fields {
+				entry, err := nestedValue(config, field, fieldLoaders[i], nested)
 				if err != nil {
-					// todo do something about this
-					continue
+					return nil, fmt.Errorf("object: field '%s': %s", field.Name, err)
+				}
+
+				nested.Values = append(nested.Values, entry)
+
+				key, _ := json.Marshal(field.Name)
+				value, err := json.Marshal(entry.JSONValue())
+				if err != nil {
+					return nil, fmt.Errorf("object: field '%s': %s", field.Name, err)
+				}
+
+				if i > 0 {
+					buf.WriteString(",")
 				}
 
-				args[i] = value.Value
+				buf.Write(key)
+				buf.WriteString(":")
+				buf.Write(value)
 			}
 
-			return fmt.Sprintf(data.Format, args...), nil
+			buf.WriteString("}")
+			return buf.String(), nil
 		}
 
 		return loader
 	}
 
-	ctx.AddLoaderFactory("strformat", fn)
+	ctx.AddLoaderFactory("object", fn)
 }
 
-func addAutoIncrementFactory(ctx *TypeLoaderFactoryContext) {
+// times an array item is regenerated when it repeats an item of a unique array
+const maxUniqueItemAttempts = 100
+
+func addArrayFactory(ctx *TypeLoaderFactoryContext) {
+	type arrayLoaderArgs struct {
+		Type     string                 `arg:"type,required" desc:"name of the type of the array's items"`
+		Args     map[string]interface{} `arg:"args" desc:"loader args for the items that override the type's own"`
+		Kind     string                 `arg:"kind" default:"string" desc:"how items are written: string, integer, number, boolean or json"`
+		MinItems int                    `arg:"minitems" default:"0" desc:"fewest items in an array"`
+		MaxItems int                    `arg:"maxitems" default:"5" desc:"most items in an array"`
+		Unique   bool                   `arg:"unique" desc:"no item appears twice in an array"`
+	}
+
 	fn := func() TypeLoader {
-		loader := &FnTypeLoader{}
+		args := &arrayLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		var item *conf.ConfigurationField
+		var itemLoader TypeLoader
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if args.MinItems < 0 || args.MinItems > args.MaxItems {
+				return fmt.Errorf("array: expected 0 <= minitems <= maxitems, got minitems %d and maxitems %d", args.MinItems, args.MaxItems)
+			}
+
+			known := false
+			for _, kind := range conf.FieldKinds {
+				known = known || string(kind) == args.Kind
+			}
+
+			if !known {
+				return fmt.Errorf("array: unknown kind '%s'", args.Kind)
+			}
 
-		loader.loadFn = func(dto *conf.UseTypeDTO) {
-			loader.LoaderData = 0
+			item = &conf.ConfigurationField{Name: "item", Type: args.Type, Args: args.Args, Kind: conf.FieldKind(args.Kind)}
+
+			var err error
+			if itemLoader, err = nestedLoader(ctx, config, item); err != nil {
+				return fmt.Errorf("array: %s", err)
+			}
+
+			return nil
+		}
+
+		loader.resetFn = func(run *res.Run) error {
+			return ResetTypeLoaders([]TypeLoader{itemLoader}, run)
+		}
+
+		loader.closeFn = func() error {
+			return CloseTypeLoaders([]TypeLoader{itemLoader})
 		}
 
 		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
-			val := loader.LoaderData.(int)
+			n := args.MinItems + set.Rand.Intn(args.MaxItems-args.MinItems+1)
+
+			items := make([]interface{}, 0, n)
+			seen := make(map[string]bool)
+
+			for len(items) < n {
+				var value []byte
+
+				for attempt := 0; ; attempt++ {
+					entry, err := nestedValue(config, item, itemLoader, set)
+					if err != nil {
+						return nil, fmt.Errorf("array: %s", err)
+					}
+
+					if value, err = json.Marshal(entry.JSONValue()); err != nil {
+						return nil, fmt.Errorf("array: %s", err)
+					}
+
+					if !args.Unique || !seen[string(value)] {
+						break
+					}
+
+					if attempt == maxUniqueItemAttempts {
+						return nil, fmt.Errorf("array: failed to generate %d unique items; type '%s' may not have enough distinct values", n, args.Type)
+					}
+				}
 
-			val++
-			loader.LoaderData = val
+				seen[string(value)] = true
+				items = append(items, json.RawMessage(value))
+			}
+
+			raw, err := json.Marshal(items)
+			if err != nil {
+				return nil, err
+			}
 
-			return val, nil
+			return string(raw), nil
+		}
+
+		return loader
+	}
+
+	ctx.AddLoaderFactory("array", fn)
+}
+
+func addAutoIncrementFactory(ctx *TypeLoaderFactoryContext) {
+	fn := func() TypeLoader {
+		loader := &FnTypeLoader{args: &noArgs{}}
+
+		// rows are generated concurrently, so derive the value from the row's position rather than a counter
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			return set.Index + 1, nil
 		}
 
 		return loader
@@ -155,14 +779,17 @@ func addAutoIncrementFactory(ctx *TypeLoaderFactoryContext) {
 
 func addUUIDFactory(ctx *TypeLoaderFactoryContext) {
 	fn := func() TypeLoader {
-		loader := &FnTypeLoader{}
+		loader := &FnTypeLoader{args: &noArgs{}}
 
-		loader.loadFn = func(dto *conf.UseTypeDTO) {
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			// build a v4 uuid from the row's source of randomness so seeded runs are repeatable
+			var id uuid.UUID
+			set.Rand.Read(id[:])
 
-		}
+			id[6] = (id[6] & 0x0f) | 0x40
+			id[8] = (id[8] & 0x3f) | 0x80
 
-		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
-			return uuid.NewV4().String(), nil
+			return id.String(), nil
 		}
 
 		return loader
@@ -178,4 +805,11 @@ func AddDefaultLoaderFactories(ctx *TypeLoaderFactoryContext) {
 	addDateTimeFactory(ctx)
 	addAutoIncrementFactory(ctx)
 	addUUIDFactory(ctx)
+	addChoiceFactory(ctx)
+	addTextFactory(ctx)
+	addRegexFactory(ctx)
+	addObjectFactory(ctx)
+	addArrayFactory(ctx)
+	addExecFactory(ctx)
+	addScriptFactory(ctx)
 }
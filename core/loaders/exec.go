@@ -0,0 +1,397 @@
+package loaders
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+// The exec loader gets its values from another program, so loaders can be written in any language. The program
+// reads requests from stdin and writes responses to stdout, one json object per line:
+//
+//	-> {"params": {"greeting": "hello"}}
+//	<- {"ok": true}
+//	-> {"rows": [{"index": 0, "seed": 8717895732742165505, "values": {"name": "Ann"}}, ...]}
+//	<- {"values": ["hello Ann", ...]}
+//
+// The first request passes the type's params once, before any rows are requested. Each later request has a batch of
+// rows, with the values already generated for their earlier fields, and expects a value for each of them in order;
+// values can be any json, and null is a null. Either response can be {"error": "..."} instead. Rows can arrive in any
+// order when several workers generate them, so programs that should repeat their values for the same seed option
+// must derive them from each row's seed. Each worker waits for its row's value before generating its next row, so a
+// batch holds at most one row per worker (the workers option), however large the batch size. Anything the program
+// writes to stderr is passed through.
+
+type execRow struct {
+	Index  int                    `json:"index"`
+	Seed   int64                  `json:"seed"`
+	Values map[string]interface{} `json:"values"`
+}
+
+type execResponse struct {
+	OK     bool              `json:"ok"`
+	Values []json.RawMessage `json:"values"`
+	Error  string            `json:"error"`
+}
+
+type execRequest struct {
+	row   execRow
+	reply chan execReply
+}
+
+type execReply struct {
+	value interface{}
+	err   error
+}
+
+// execPlugin runs a program and hands it the rows requested by concurrent workers in batches
+type execPlugin struct {
+	name string
+	cmd  *exec.Cmd
+
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+
+	batchSize int
+	started   bool
+	requests  chan execRequest
+	closeOnce sync.Once
+	done      chan struct{}
+
+	// closed when serve returns, so Close doesn't read the program's output at the same time
+	stopped chan struct{}
+}
+
+func startExecPlugin(command string, args []string, env map[string]string, dir string, batchSize int) (*execPlugin, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+
+	if len(env) != 0 {
+		cmd.Env = os.Environ()
+		for name, value := range env {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("exec: failed to start '%s': %s", command, err)
+	}
+
+	plugin := &execPlugin{
+		name:      command,
+		cmd:       cmd,
+		stdin:     stdin,
+		stdout:    bufio.NewReaderSize(stdout, 64*1024),
+		batchSize: batchSize,
+		requests:  make(chan execRequest),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+
+	return plugin, nil
+}
+
+// exchange writes a request and reads the program's response to it
+func (plugin *execPlugin) exchange(request interface{}) (*execResponse, error) {
+	content, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := plugin.stdin.Write(append(content, '\n')); err != nil {
+		return nil, fmt.Errorf("exec: '%s' stopped reading requests: %s", plugin.name, err)
+	}
+
+	line, err := plugin.stdout.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		if err == io.EOF {
+			return nil, fmt.Errorf("exec: '%s' exited without responding", plugin.name)
+		}
+
+		return nil, fmt.Errorf("exec: failed to read from '%s': %s", plugin.name, err)
+	}
+
+	response := &execResponse{}
+	if err := json.Unmarshal(line, response); err != nil {
+		return nil, fmt.Errorf("exec: '%s' responded with invalid json '%s': %s", plugin.name, strings.TrimSpace(string(line)), err)
+	}
+
+	if response.Error != "" {
+		return nil, fmt.Errorf("exec: '%s': %s", plugin.name, response.Error)
+	}
+
+	return response, nil
+}
+
+func (plugin *execPlugin) init(params map[string]interface{}) error {
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	// a program that never answers would otherwise hang loading
+	responded := make(chan error, 1)
+
+	var response *execResponse
+	go func() {
+		var err error
+		response, err = plugin.exchange(map[string]interface{}{"params": params})
+		responded <- err
+	}()
+
+	select {
+	case err := <-responded:
+		if err != nil {
+			return err
+		}
+	case <-time.After(execParamsTimeout):
+		// reading stops once the program is gone
+		plugin.cmd.Process.Kill()
+		<-responded
+
+		return fmt.Errorf("exec: '%s' didn't respond to its params within %s, so it was killed", plugin.name, execParamsTimeout)
+	}
+
+	if !response.OK {
+		return fmt.Errorf("exec: '%s' didn't respond to its params with {\"ok\": true}", plugin.name)
+	}
+
+	plugin.started = true
+	go plugin.serve()
+
+	return nil
+}
+
+// serve sends requests in batches of whatever's waiting, up to the batch size, until the plugin is closed or fails;
+// workers wait for their values, so there's never more waiting than there are workers
+func (plugin *execPlugin) serve() {
+	defer close(plugin.stopped)
+
+	var failed error
+
+	for {
+		var first execRequest
+		select {
+		case first = <-plugin.requests:
+		case <-plugin.done:
+			return
+		}
+
+		batch := []execRequest{first}
+	collect:
+		for len(batch) < plugin.batchSize {
+			select {
+			case request := <-plugin.requests:
+				batch = append(batch, request)
+			default:
+				break collect
+			}
+		}
+
+		if failed == nil {
+			failed = plugin.send(batch)
+		}
+
+		// once the program has failed, every later request gets the same error
+		if failed != nil {
+			for _, request := range batch {
+				request.reply <- execReply{err: failed}
+			}
+		}
+	}
+}
+
+func (plugin *execPlugin) send(batch []execRequest) error {
+	rows := make([]execRow, len(batch))
+	for i, request := range batch {
+		rows[i] = request.row
+	}
+
+	response, err := plugin.exchange(map[string]interface{}{"rows": rows})
+	if err != nil {
+		return err
+	}
+
+	if len(response.Values) != len(batch) {
+		return fmt.Errorf("exec: '%s' responded with %d values for %d rows", plugin.name, len(response.Values), len(batch))
+	}
+
+	for i, request := range batch {
+		value, err := execValue(response.Values[i])
+		request.reply <- execReply{value: value, err: err}
+	}
+
+	return nil
+}
+
+// execValue returns strings as they are, nulls as nil, and any other json as it was written
+func execValue(raw json.RawMessage) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return v, nil
+	}
+
+	return strings.TrimSpace(string(raw)), nil
+}
+
+func (plugin *execPlugin) generate(set *res.ResultsRow) (interface{}, error) {
+	values := make(map[string]interface{}, len(set.Values))
+	for _, value := range set.Values {
+		values[value.Name] = value.JSONValue()
+	}
+
+	reply := make(chan execReply, 1)
+	request := execRequest{row: execRow{Index: set.Index, Seed: set.Rand.Int63(), Values: values}, reply: reply}
+
+	// rows of runs stopped early stop waiting for the program
+	var stopped <-chan struct{}
+	if set.Run != nil {
+		stopped = set.Run.Context.Done()
+	}
+
+	select {
+	case plugin.requests <- request:
+	case <-plugin.done:
+		return nil, fmt.Errorf("exec: '%s' was closed", plugin.name)
+	case <-stopped:
+		return nil, set.Run.Context.Err()
+	}
+
+	select {
+	case result := <-reply:
+		return result.value, result.err
+	case <-stopped:
+		return nil, set.Run.Context.Err()
+	}
+}
+
+// time a program gets to respond to its params, and to exit once its stdin is closed, before it's killed; vars so
+// tests can shorten them
+var (
+	execParamsTimeout = 10 * time.Second
+	execExitTimeout   = 5 * time.Second
+)
+
+// Close stops the program by closing its stdin, and waits for it to exit. A program stuck in the middle of a batch is
+// killed after the timeout, which also ends the wait for its response.
+func (plugin *execPlugin) Close() error {
+	var err error
+
+	plugin.closeOnce.Do(func() {
+		close(plugin.done)
+		plugin.stdin.Close()
+
+		exited := make(chan error, 1)
+		go func() {
+			// serve reads the program's last response, if it's waiting for one, before the rest is drained
+			if plugin.started {
+				<-plugin.stopped
+			}
+
+			// drain anything left so the program isn't blocked writing
+			io.Copy(io.Discard, plugin.stdout)
+			exited <- plugin.cmd.Wait()
+		}()
+
+		select {
+		case waitErr := <-exited:
+			if waitErr != nil {
+				err = fmt.Errorf("exec: '%s' exited with an error: %s", plugin.name, waitErr)
+			}
+		case <-time.After(execExitTimeout):
+			plugin.cmd.Process.Kill()
+			<-exited
+
+			err = fmt.Errorf("exec: '%s' didn't exit within %s of its input closing, so it was killed", plugin.name, execExitTimeout)
+		}
+	})
+
+	return err
+}
+
+func addExecFactory(ctx *TypeLoaderFactoryContext) {
+	type execLoaderArgs struct {
+		Command   string                 `arg:"command,required" desc:"program to run; paths with a directory are relative to the config file, others are looked up in PATH"`
+		Args      []string               `arg:"args" default:"[]" desc:"arguments to run the program with"`
+		Env       map[string]string      `arg:"env" desc:"environment variables to set for the program"`
+		Params    map[string]interface{} `arg:"params" desc:"settings sent to the program once, when it starts"`
+		BatchSize int                    `arg:"batchsize" default:"100" desc:"most rows requested from the program at once; a request holds at most one row per worker, so this only limits batches when it's below the workers option"`
+	}
+
+	fn := func() TypeLoader {
+		args := &execLoaderArgs{}
+		loader := &FnTypeLoader{args: args}
+
+		var plugin *execPlugin
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if args.BatchSize < 1 {
+				return fmt.Errorf("exec: batchsize must be at least 1 (got %d)", args.BatchSize)
+			}
+
+			command := args.Command
+			if strings.ContainsRune(command, '/') || strings.ContainsRune(command, os.PathSeparator) {
+				// absolute, since relative commands are run relative to the program's directory
+				abs, err := filepath.Abs(config.ResolvePath(command))
+				if err != nil {
+					return err
+				}
+
+				command = abs
+			}
+
+			started, err := startExecPlugin(command, args.Args, args.Env, config.Dir, args.BatchSize)
+			if err != nil {
+				return err
+			}
+
+			// the program is stopped by closeFn, which is also called when init fails
+			plugin = started
+			return plugin.init(args.Params)
+		}
+
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			return plugin.generate(set)
+		}
+
+		// stops the program
+		loader.closeFn = func() error {
+			if plugin == nil {
+				return nil
+			}
+
+			return plugin.Close()
+		}
+
+		return loader
+	}
+
+	ctx.AddLoaderFactory("exec", fn)
+}
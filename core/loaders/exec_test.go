@@ -0,0 +1,181 @@
+package loaders
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+// TestExecHelperProcess isn't a test; it's the program the exec loader runs in the other tests, by running the test
+// binary again
+func TestExecHelperProcess(t *testing.T) {
+	mode := os.Getenv("OAR_EXEC_HELPER")
+	if mode == "" {
+		return
+	}
+
+	defer os.Exit(0)
+
+	in := bufio.NewScanner(os.Stdin)
+	out := json.NewEncoder(os.Stdout)
+
+	var params map[string]interface{}
+	for in.Scan() {
+		var request struct {
+			Params map[string]interface{} `json:"params"`
+			Rows   []execRow              `json:"rows"`
+		}
+
+		json.Unmarshal(in.Bytes(), &request)
+
+		switch {
+		case mode == "silent":
+			time.Sleep(time.Hour)
+		case request.Params != nil && mode == "reject":
+			out.Encode(map[string]string{"error": "no greeting"})
+		case request.Params != nil:
+			params = request.Params
+			out.Encode(map[string]bool{"ok": true})
+		case mode == "crash":
+			os.Exit(3)
+		case mode == "hang":
+			time.Sleep(time.Hour)
+		default:
+			values := make([]interface{}, len(request.Rows))
+			for i, row := range request.Rows {
+				if name, ok := row.Values["name"].(string); ok {
+					values[i] = fmt.Sprintf("%s %s (%d of %d)", params["greeting"], name, i+1, len(request.Rows))
+				}
+			}
+
+			out.Encode(map[string]interface{}{"values": values})
+		}
+	}
+}
+
+func newExecHelper(t *testing.T, mode string) (TypeLoader, error) {
+	ctx := make(TypeLoaderFactoryContext)
+	AddDefaultLoaderFactories(&ctx)
+
+	loader, err := ctx.NewLoader(conf.NewConfiguration(), &conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "exec", Args: map[string]interface{}{
+		"command": os.Args[0],
+		"args":    []interface{}{"-test.run=TestExecHelperProcess"},
+		"env":     map[string]interface{}{"OAR_EXEC_HELPER": mode},
+		"params":  map[string]interface{}{"greeting": "hello"},
+	}}})
+
+	if loader != nil {
+		t.Cleanup(func() { loader.(io.Closer).Close() })
+	}
+
+	return loader, err
+}
+
+func TestExecLoaderRequestsValuesInBatches(t *testing.T) {
+	loader, err := newExecHelper(t, "greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := conf.NewConfiguration()
+
+	var wg sync.WaitGroup
+	values := make([]interface{}, 50)
+	errs := make([]error, 50)
+
+	for i := range values {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			row := res.NewResultsRow(i, int64(i))
+			row.Values = append(row.Values, &res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "name"}, Value: fmt.Sprint("user", i)})
+			if i == 0 {
+				row.Values[0].Null = true
+			}
+
+			values[i], errs[i] = loader.GenerateSingleValue(config, row)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, value := range values {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+
+		if i == 0 && value != nil || i > 0 && !strings.HasPrefix(fmt.Sprint(value), fmt.Sprintf("hello user%d (", i)) {
+			t.Errorf("Expected a greeting for user%d, or null for a null name, got %v", i, value)
+		}
+	}
+}
+
+func TestExecLoaderReportsProgramErrors(t *testing.T) {
+	if _, err := newExecHelper(t, "reject"); err == nil || !strings.Contains(err.Error(), "no greeting") {
+		t.Errorf("Expected the program's error to be reported, got %v", err)
+	}
+
+	loader, err := newExecHelper(t, "crash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := loader.GenerateSingleValue(conf.NewConfiguration(), res.NewResultsRow(i, 1)); err == nil || !strings.Contains(err.Error(), "exited without responding") {
+			t.Errorf("Expected a program that exits to be reported, got %v", err)
+		}
+	}
+
+	if _, err := newExecHelper(t, ""); err == nil {
+		t.Errorf("Expected a program that never responds to its params to be reported")
+	}
+}
+
+func TestExecLoaderKillsProgramsThatNeverRespond(t *testing.T) {
+	paramsTimeout, exitTimeout := execParamsTimeout, execExitTimeout
+	execParamsTimeout, execExitTimeout = 200*time.Millisecond, 200*time.Millisecond
+	defer func() { execParamsTimeout, execExitTimeout = paramsTimeout, exitTimeout }()
+
+	if _, err := newExecHelper(t, "silent"); err == nil || !strings.Contains(err.Error(), "didn't respond to its params") {
+		t.Errorf("Expected a program that doesn't answer its params to fail loading, got %v", err)
+	}
+
+	loader, err := newExecHelper(t, "hang")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the run stops waiting, but the program is still in the middle of the batch
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	row := res.NewResultsRow(0, 0)
+	row.Run = &res.Run{Context: ctx}
+	if _, err := loader.GenerateSingleValue(conf.NewConfiguration(), row); err != context.DeadlineExceeded {
+		t.Errorf("Expected the stopped run's error, got %v", err)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- loader.(io.Closer).Close() }()
+
+	select {
+	case err := <-closed:
+		if err == nil || !strings.Contains(err.Error(), "was killed") {
+			t.Errorf("Expected the program to be killed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Close to return once the program was killed")
+	}
+}
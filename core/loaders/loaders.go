@@ -1,19 +1,72 @@
 package loaders
 
 import (
+	"fmt"
+	"io"
+	"sort"
+
 	conf "github.com/elauffenburger/oar/core/configuration"
 	res "github.com/elauffenburger/oar/core/results"
+	"github.com/elauffenburger/oar/core/schema"
 )
 
 type TypeLoaderFactoryFn func() TypeLoader
 
-type TypeLoaderLoadFn func(dto *conf.UseTypeDTO)
+type TypeLoaderLoadFn func(config *conf.Configuration, dto *conf.UseTypeDTO) error
 type TypeLoaderGenerateSingleValueFn func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error)
 type TypeLoader interface {
-	Load(dto *conf.UseTypeDTO)
+	Load(config *conf.Configuration, dto *conf.UseTypeDTO) error
 	GenerateSingleValue(config *conf.Configuration, set *res.ResultsRow) (interface{}, error)
 }
 
+// TypeLoaderWithArgsSchema is implemented by loaders that can describe the args they accept
+type TypeLoaderWithArgsSchema interface {
+	ArgsSchema() *schema.Schema
+}
+
+// TypeLoaderWithOrder is implemented by loaders whose values depend on the rows before them, like scripts keeping
+// running totals; when any of a configuration's loaders generates in order, its rows are generated one at a time
+type TypeLoaderWithOrder interface {
+	GeneratesInOrder() bool
+}
+
+// A loader is loaded once, then reset before each run that generates rows with it, and closed once it's no longer
+// used. Loaders holding files, programs or connections implement io.Closer to release them; the engine closes every
+// loader it builds, even when loading or generating fails.
+
+// TypeLoaderWithReset is implemented by loaders with state for a single run, like counters or scripts' state, so runs
+// reusing the loader start over
+type TypeLoaderWithReset interface {
+	Reset(run *res.Run) error
+}
+
+// ResetTypeLoaders resets the loaders that keep state between rows for a new run
+func ResetTypeLoaders(loaders []TypeLoader, run *res.Run) error {
+	for _, loader := range loaders {
+		if resettable, ok := loader.(TypeLoaderWithReset); ok {
+			if err := resettable.Reset(run); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CloseTypeLoaders closes every loader that holds resources and returns the first error closing one
+func CloseTypeLoaders(loaders []TypeLoader) error {
+	var first error
+	for _, loader := range loaders {
+		if closer, ok := loader.(io.Closer); ok {
+			if err := closer.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
+
 type typeLoader struct {
 	LoaderData interface{} `json:"-"`
 }
@@ -23,3 +76,47 @@ type TypeLoaderFactoryContext map[string]TypeLoaderFactoryFn
 func (ctx *TypeLoaderFactoryContext) AddLoaderFactory(name string, factory TypeLoaderFactoryFn) {
 	(*ctx)[name] = factory
 }
+
+// ArgsSchema returns the schema for the args of the loader with the given name, or nil if it doesn't describe them
+func (ctx *TypeLoaderFactoryContext) ArgsSchema(name string) *schema.Schema {
+	factory, ok := (*ctx)[name]
+	if !ok {
+		return nil
+	}
+
+	if loader, ok := factory().(TypeLoaderWithArgsSchema); ok {
+		return loader.ArgsSchema()
+	}
+
+	return nil
+}
+
+// LoaderNames returns the names of all registered loaders in sorted order
+func (ctx *TypeLoaderFactoryContext) LoaderNames() []string {
+	names := make([]string, 0, len(*ctx))
+	for name := range *ctx {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// NewLoader creates a loader for t with the factory registered for its loader, and loads it
+func (ctx *TypeLoaderFactoryContext) NewLoader(config *conf.Configuration, t *conf.UseTypeDTO) (TypeLoader, error) {
+	loadername := t.LoaderArgs.Name
+
+	factory, ok := (*ctx)[loadername]
+	if !ok {
+		return nil, fmt.Errorf("Unknown loader '%s'", loadername)
+	}
+
+	loader := factory()
+	if err := loader.Load(config, t); err != nil {
+		// anything loaded before the failure is released
+		CloseTypeLoaders([]TypeLoader{loader})
+		return nil, err
+	}
+
+	return loader, nil
+}
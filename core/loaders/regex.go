@@ -0,0 +1,252 @@
+package loaders
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// regexGenerator generates strings that match a regular expression
+type regexGenerator struct {
+	re *syntax.Regexp
+
+	// generated values are checked against the pattern, since word boundaries and line anchors aren't followed
+	compiled *regexp.Regexp
+
+	// most times an unbounded repeat (*, + or {n,}) repeats beyond its minimum
+	maxRepeat int
+}
+
+func newRegexGenerator(pattern string, maxRepeat int) (*regexGenerator, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	re = re.Simplify()
+	if err := checkGeneratable(re, true, true); err != nil {
+		return nil, err
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return &regexGenerator{re: re, compiled: compiled, maxRepeat: maxRepeat}, nil
+}
+
+// checkGeneratable returns an error if re has parts no text can match, like empty classes or a ^ after other text
+func checkGeneratable(re *syntax.Regexp, atStart bool, atEnd bool) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return fmt.Errorf("it can't match anything")
+
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return fmt.Errorf("the class '%s' can't match any character", re)
+		}
+
+	case syntax.OpBeginText:
+		if !atStart {
+			return fmt.Errorf("^ can only be at its start")
+		}
+
+	case syntax.OpEndText:
+		if !atEnd {
+			return fmt.Errorf("$ can only be at its end")
+		}
+
+	case syntax.OpConcat:
+		for i, sub := range re.Sub {
+			// a sub is at the start if everything before it may be empty, and at the end if everything after it may be
+			subStart, subEnd := atStart, atEnd
+			for _, before := range re.Sub[:i] {
+				subStart = subStart && mayBeEmpty(before)
+			}
+
+			for _, after := range re.Sub[i+1:] {
+				subEnd = subEnd && mayBeEmpty(after)
+			}
+
+			if err := checkGeneratable(sub, subStart, subEnd); err != nil {
+				return err
+			}
+		}
+
+	default:
+		for _, sub := range re.Sub {
+			if err := checkGeneratable(sub, atStart, atEnd); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func mayBeEmpty(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune) == 0
+
+	case syntax.OpCharClass, syntax.OpAnyCharNotNL, syntax.OpAnyChar, syntax.OpNoMatch:
+		return false
+
+	case syntax.OpCapture, syntax.OpPlus:
+		return mayBeEmpty(re.Sub[0])
+
+	case syntax.OpRepeat:
+		return re.Min == 0 || mayBeEmpty(re.Sub[0])
+
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !mayBeEmpty(sub) {
+				return false
+			}
+		}
+
+		return true
+
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if mayBeEmpty(sub) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// stars, quests, anchors, word boundaries and empty matches
+	return true
+}
+
+// most values generated for a pattern before giving up on one that matches it
+const maxRegexAttempts = 100
+
+func (gen *regexGenerator) generate(rnd *rand.Rand) (string, error) {
+	for attempt := 0; attempt < maxRegexAttempts; attempt++ {
+		var builder strings.Builder
+		if err := gen.write(&builder, gen.re, rnd); err != nil {
+			return "", err
+		}
+
+		if value := builder.String(); gen.compiled.MatchString(value) {
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("no value matching '%s' after %d attempts", gen.compiled, maxRegexAttempts)
+}
+
+func (gen *regexGenerator) write(builder *strings.Builder, re *syntax.Regexp, rnd *rand.Rand) error {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			// case insensitive literals may be written in either case
+			if re.Flags&syntax.FoldCase != 0 && rnd.Intn(2) == 0 {
+				r = unicode.SimpleFold(r)
+			}
+
+			builder.WriteRune(r)
+		}
+
+	case syntax.OpCharClass:
+		r, err := pickFromClass(re.Rune, rnd)
+		if err != nil {
+			return err
+		}
+
+		builder.WriteRune(r)
+
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		builder.WriteRune(rune(' ' + rnd.Intn('~'-' '+1)))
+
+	case syntax.OpCapture:
+		return gen.write(builder, re.Sub[0], rnd)
+
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := gen.write(builder, sub, rnd); err != nil {
+				return err
+			}
+		}
+
+	case syntax.OpAlternate:
+		return gen.write(builder, re.Sub[rnd.Intn(len(re.Sub))], rnd)
+
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, -1
+		case syntax.OpPlus:
+			min, max = 1, -1
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+
+		if max < 0 {
+			max = min + gen.maxRepeat
+		}
+
+		for n := min + rnd.Intn(max-min+1); n > 0; n-- {
+			if err := gen.write(builder, re.Sub[0], rnd); err != nil {
+				return err
+			}
+		}
+	}
+
+	// anchors, word boundaries and empty matches don't produce any text
+	return nil
+}
+
+// pickFromClass picks a rune from a class's ranges, preferring printable ascii so negated classes like
+// [^,] don't produce control characters or obscure unicode
+func pickFromClass(ranges []rune, rnd *rand.Rand) (rune, error) {
+	ascii := make([]rune, 0, len(ranges))
+	for i := 0; i < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if lo < ' ' {
+			lo = ' '
+		}
+
+		if hi > '~' {
+			hi = '~'
+		}
+
+		if lo <= hi {
+			ascii = append(ascii, lo, hi)
+		}
+	}
+
+	if len(ascii) != 0 {
+		ranges = ascii
+	}
+
+	total := 0
+	for i := 0; i < len(ranges); i += 2 {
+		total += int(ranges[i+1]-ranges[i]) + 1
+	}
+
+	if total <= 0 {
+		return 0, fmt.Errorf("couldn't pick from the class %v", ranges)
+	}
+
+	n := rnd.Intn(total)
+	for i := 0; i < len(ranges); i += 2 {
+		size := int(ranges[i+1]-ranges[i]) + 1
+		if n < size {
+			return ranges[i] + rune(n), nil
+		}
+
+		n -= size
+	}
+
+	return 0, fmt.Errorf("couldn't pick from the class %v", ranges)
+}
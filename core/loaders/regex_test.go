@@ -0,0 +1,55 @@
+package loaders
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRegexGeneratorMatchesItsPattern(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for _, pattern := range []string{`^[A-Z]{3}-\d{4}$`, `(?i)abc|x+y?`, `[^,]+,\w*`, `^$`, `a?^b`, `\bfoo\b`} {
+		gen, err := newRegexGenerator(pattern, 8)
+		if err != nil {
+			t.Fatalf("Error loading '%s': %s", pattern, err)
+		}
+
+		compiled := regexp.MustCompile(pattern)
+		for i := 0; i < 50; i++ {
+			value, err := gen.generate(rnd)
+			if err != nil {
+				t.Fatalf("Error generating a value for '%s': %s", pattern, err)
+			}
+
+			if !compiled.MatchString(value) {
+				t.Errorf("Expected '%s' to match '%s'", value, pattern)
+			}
+		}
+	}
+}
+
+func TestRegexGeneratorRejectsPatternsThatCantMatch(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		`[^\x00-\x{10FFFF}]`: "can't match any character",
+		`ab|c[^\D\d]`:        "can't match any character",
+		`a^b`:                "^ can only be at its start",
+		`a$b`:                "$ can only be at its end",
+		`(x|y^)z`:            "^ can only be at its start",
+	} {
+		if _, err := newRegexGenerator(pattern, 8); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected '%s' to be rejected with \"%s\", got %v", pattern, expected, err)
+		}
+	}
+
+	// word boundaries between word characters are only caught by checking what's generated
+	gen, err := newRegexGenerator(`a\bb`, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gen.generate(rand.New(rand.NewSource(1))); err == nil || !strings.Contains(err.Error(), "no value matching") {
+		t.Errorf("Expected a pattern no generated value matches to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,533 @@
+package loaders
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	res "github.com/elauffenburger/oar/core/results"
+	starjson "go.starlark.net/lib/json"
+	starmath "go.starlark.net/lib/math"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/syntax"
+)
+
+// The script loader runs a Starlark (a dialect of Python) script that defines a generate function:
+//
+//	names = dataset("data/firstnames.csv")
+//
+//	def generate(row, state):
+//	    state["total"] = state.get("total", 0) + row["amount"]
+//	    return "%s: %d" % (rand.choice(names), state["total"])
+//
+// generate gets the values already generated for the row's earlier fields, and optionally a state dict kept between
+// rows; scripts that take state see every row in order, one at a time. Besides Starlark's builtins, scripts can use
+// rand (random, randint, uniform and choice, seeded per row), dataset (the lines of a file, like csvloader's), params
+// (the type's params), json and math. They can't read anything else or run longer than maxsteps per row; dataset only
+// reads files under the config's directory or the type's datadir.
+
+// file name of scripts given inline with source, as it appears in errors
+const inlineScriptName = "source"
+
+type scriptLoader struct {
+	*FnTypeLoader
+
+	generate *starlark.Function
+	stateful bool
+
+	// held while stateful scripts run, since state isn't safe to share
+	mu    sync.Mutex
+	state *starlark.Dict
+}
+
+// GeneratesInOrder is true for scripts that keep state between rows
+func (loader *scriptLoader) GeneratesInOrder() bool {
+	return loader.stateful
+}
+
+func addScriptFactory(ctx *TypeLoaderFactoryContext) {
+	type scriptLoaderArgs struct {
+		Source   string                 `arg:"source" desc:"Starlark script defining generate(row) or generate(row, state)"`
+		File     string                 `arg:"file" desc:"file to read the script from instead of source; relative paths are relative to the config file"`
+		Params   map[string]interface{} `arg:"params" desc:"values the script can read from params"`
+		MaxSteps int                    `arg:"maxsteps" default:"1000000" desc:"most steps the script can run for each row"`
+		DataDir  string                 `arg:"datadir" desc:"directory besides the config file's that dataset can read files from; relative paths are relative to the config file"`
+	}
+
+	fn := func() TypeLoader {
+		args := &scriptLoaderArgs{}
+		loader := &scriptLoader{FnTypeLoader: &FnTypeLoader{args: args}}
+
+		// datasets the script has read, shared by every row
+		datasets := &scriptDatasets{lists: make(map[string]*starlark.List)}
+		var params starlark.Value
+
+		loader.loadFn = func(config *conf.Configuration, dto *conf.UseTypeDTO) error {
+			if (args.Source == "") == (args.File == "") {
+				return fmt.Errorf("script: expected either source or file")
+			}
+
+			if args.MaxSteps < 1 {
+				return fmt.Errorf("script: maxsteps must be at least 1 (got %d)", args.MaxSteps)
+			}
+
+			filename, src := inlineScriptName, args.Source
+			if args.File != "" {
+				filename = config.ResolvePath(args.File)
+
+				content, err := os.ReadFile(filename)
+				if err != nil {
+					return fmt.Errorf("script: failed to read '%s': %s", filename, err)
+				}
+
+				src = string(content)
+			}
+
+			datasets.roots = []string{config.ResolvePath(".")}
+			if args.DataDir != "" {
+				datasets.roots = append(datasets.roots, config.ResolvePath(args.DataDir))
+			}
+
+			var err error
+			if params, err = toStarlark(args.Params); err != nil {
+				return fmt.Errorf("script: invalid params: %s", err)
+			}
+
+			params.Freeze()
+
+			// run the script's top level once, so it's compiled and its globals, like datasets, are set up
+			thread := &starlark.Thread{Name: "load"}
+			thread.SetMaxExecutionSteps(uint64(args.MaxSteps))
+
+			globals, err := starlark.ExecFileOptions(scriptFileOptions, thread, filename, src, scriptPredeclared(datasets, params))
+			if err != nil {
+				return fmt.Errorf("script: %s", scriptError(err))
+			}
+
+			generate, ok := globals["generate"].(*starlark.Function)
+			if !ok {
+				return fmt.Errorf("script: %s doesn't define a generate function", filename)
+			}
+
+			switch generate.NumParams() {
+			case 1:
+			case 2:
+				loader.stateful = true
+				loader.state = starlark.NewDict(0)
+			default:
+				return fmt.Errorf("script: %s: generate should take (row) or (row, state), but takes %d parameters", generate.Position(), generate.NumParams())
+			}
+
+			loader.generate = generate
+			return nil
+		}
+
+		// each run starts with empty state
+		loader.resetFn = func(run *res.Run) error {
+			if loader.stateful {
+				loader.mu.Lock()
+				loader.state = starlark.NewDict(0)
+				loader.mu.Unlock()
+			}
+
+			return nil
+		}
+
+		loader.generateSingleValueFn = func(config *conf.Configuration, set *res.ResultsRow) (interface{}, error) {
+			row := starlark.NewDict(len(set.Values))
+			for _, value := range set.Values {
+				v, err := toStarlark(value.JSONValue())
+				if err != nil {
+					return nil, fmt.Errorf("script: field '%s': %s", value.Name, err)
+				}
+
+				row.SetKey(starlark.String(value.Name), v)
+			}
+
+			thread := &starlark.Thread{Name: fmt.Sprintf("row %d", set.Index)}
+			thread.SetMaxExecutionSteps(uint64(args.MaxSteps))
+
+			// the function's globals were fixed when it was loaded, so rand is passed through the thread
+			thread.SetLocal(scriptRandKey, set)
+
+			callArgs := starlark.Tuple{row}
+			if loader.stateful {
+				loader.mu.Lock()
+				defer loader.mu.Unlock()
+
+				callArgs = append(callArgs, loader.state)
+			}
+
+			result, err := starlark.Call(thread, loader.generate, callArgs, nil)
+			if err != nil {
+				return nil, fmt.Errorf("script: %s", scriptError(err))
+			}
+
+			return fromStarlark(result)
+		}
+
+		return loader
+	}
+
+	ctx.AddLoaderFactory("script", fn)
+}
+
+var scriptFileOptions = &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true, Recursion: true}
+
+// thread local holding the row whose randomness rand draws from
+const scriptRandKey = "oar.row"
+
+func scriptPredeclared(datasets *scriptDatasets, params starlark.Value) starlark.StringDict {
+	return starlark.StringDict{
+		"rand":    scriptRandModule,
+		"dataset": starlark.NewBuiltin("dataset", datasets.load),
+		"params":  params,
+		"json":    starjson.Module,
+		"math":    starmath.Module,
+	}
+}
+
+// scriptDatasets reads the files scripts ask for once and shares them, frozen, between rows
+type scriptDatasets struct {
+	// the directories files can be read from: the config's, and the datadir if there is one
+	roots []string
+
+	mu    sync.Mutex
+	lists map[string]*starlark.List
+}
+
+func (datasets *scriptDatasets) load(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	path, separator := "", "\n"
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "path", &path, "separator?", &separator); err != nil {
+		return nil, err
+	}
+
+	datasets.mu.Lock()
+	defer datasets.mu.Unlock()
+
+	key := path + "\x00" + separator
+	if list, ok := datasets.lists[key]; ok {
+		return list, nil
+	}
+
+	resolved, err := datasets.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := loadDataset(resolved, separator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s': %s", path, err)
+	}
+
+	values := make([]starlark.Value, 0, len(lines))
+	for _, line := range lines {
+		values = append(values, starlark.String(line))
+	}
+
+	list := starlark.NewList(values)
+	list.Freeze()
+
+	datasets.lists[key] = list
+	return list, nil
+}
+
+// resolve finds a relative path in the first of the roots that has it. Paths can't be absolute or leave their root,
+// even through a symlink, so scripts can't read files anywhere else.
+func (datasets *scriptDatasets) resolve(path string) (string, error) {
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" {
+		return "", fmt.Errorf("can't read '%s'; dataset paths must be relative", path)
+	}
+
+	var missing error
+	for _, root := range datasets.roots {
+		resolved := filepath.Join(root, path)
+		if !isWithin(root, resolved) {
+			continue
+		}
+
+		real, err := filepath.EvalSymlinks(resolved)
+		if err != nil {
+			if missing == nil {
+				missing = err
+			}
+
+			continue
+		}
+
+		if realRoot, err := filepath.EvalSymlinks(root); err == nil && isWithin(realRoot, real) {
+			return resolved, nil
+		}
+	}
+
+	if missing != nil {
+		return "", fmt.Errorf("failed to read '%s': %s", path, missing)
+	}
+
+	return "", fmt.Errorf("can't read '%s'; datasets must be in the config's directory or the datadir", path)
+}
+
+// isWithin is true if path is dir or is under it
+func isWithin(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+var scriptRandModule = &starlarkstruct.Module{
+	Name: "rand",
+	Members: starlark.StringDict{
+		"random":  starlark.NewBuiltin("rand.random", scriptRandom),
+		"randint": starlark.NewBuiltin("rand.randint", scriptRandint),
+		"uniform": starlark.NewBuiltin("rand.uniform", scriptUniform),
+		"choice":  starlark.NewBuiltin("rand.choice", scriptChoice),
+	},
+}
+
+func scriptRow(thread *starlark.Thread, fn *starlark.Builtin) (*res.ResultsRow, error) {
+	row, ok := thread.Local(scriptRandKey).(*res.ResultsRow)
+	if !ok {
+		return nil, fmt.Errorf("%s can only be called while generating a row", fn.Name())
+	}
+
+	return row, nil
+}
+
+// random returns a float in [0, 1)
+func scriptRandom(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs); err != nil {
+		return nil, err
+	}
+
+	row, err := scriptRow(thread, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Float(row.Rand.Float64()), nil
+}
+
+// randint returns an int from a to b, inclusive
+func scriptRandint(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var a, b int64
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "a", &a, "b", &b); err != nil {
+		return nil, err
+	}
+
+	if a > b || b-a+1 <= 0 {
+		return nil, fmt.Errorf("%s: expected a <= b with fewer than 2^63 numbers between them, got %d and %d", fn.Name(), a, b)
+	}
+
+	row, err := scriptRow(thread, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.MakeInt64(a + row.Rand.Int63n(b-a+1)), nil
+}
+
+// uniform returns a float from a to b
+func scriptUniform(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var a, b float64
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "a", &a, "b", &b); err != nil {
+		return nil, err
+	}
+
+	row, err := scriptRow(thread, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Float(a + (b-a)*row.Rand.Float64()), nil
+}
+
+// choice returns a random item of a list, tuple or string
+func scriptChoice(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var seq starlark.Indexable
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "seq", &seq); err != nil {
+		return nil, err
+	}
+
+	if seq.Len() == 0 {
+		return nil, fmt.Errorf("%s: can't choose from an empty sequence", fn.Name())
+	}
+
+	row, err := scriptRow(thread, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return seq.Index(row.Rand.Intn(seq.Len())), nil
+}
+
+// scriptError describes an error with the script's position, like "source:4:12: in generate: ..."
+func scriptError(err error) string {
+	var evalErr *starlark.EvalError
+	if !errors.As(err, &evalErr) {
+		// syntax and resolve errors already start with their position
+		return err.Error()
+	}
+
+	for i := 0; i < len(evalErr.CallStack); i++ {
+		frame := evalErr.CallStack.At(i)
+		if frame.Pos.Filename() != "<builtin>" {
+			return fmt.Sprintf("%s: in %s: %s", frame.Pos, frame.Name, evalErr.Msg)
+		}
+	}
+
+	return evalErr.Msg
+}
+
+// toStarlark converts values decoded from json, like rows' values, to Starlark values
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case string:
+		return starlark.String(v), nil
+	case bool:
+		return starlark.Bool(v), nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(n), nil
+		}
+
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		return starlark.Float(f), nil
+	case float64:
+		return starlark.Float(v), nil
+	case json.RawMessage:
+		decoder := json.NewDecoder(strings.NewReader(string(v)))
+		decoder.UseNumber()
+
+		var decoded interface{}
+		if err := decoder.Decode(&decoded); err != nil {
+			return nil, err
+		}
+
+		return toStarlark(decoded)
+	case []interface{}:
+		items := make([]starlark.Value, len(v))
+		for i, item := range v {
+			converted, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+
+			items[i] = converted
+		}
+
+		return starlark.NewList(items), nil
+	case map[string]interface{}:
+		dict := starlark.NewDict(len(v))
+		for key, item := range v {
+			converted, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+
+			dict.SetKey(starlark.String(key), converted)
+		}
+
+		return dict, nil
+	}
+
+	// numbers from configurations built in code, like params of ints
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return starlark.MakeInt64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return starlark.MakeUint64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return starlark.Float(v.Float()), nil
+	}
+
+	return nil, fmt.Errorf("can't pass %v (%T) to scripts", value, value)
+}
+
+// fromStarlark converts what generate returns to a value: strings, numbers and bools as they are, None as null, and
+// lists and dicts as json
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		return v.String(), nil
+	case starlark.Float:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	}
+
+	converted, err := toJSONValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("script: generate returned %s, which can't be written as json: %s", value.Type(), err)
+	}
+
+	content, err := json.Marshal(converted)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(content), nil
+}
+
+func toJSONValue(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.Int:
+		return json.Number(v.String()), nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Indexable:
+		// lists and tuples
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			item, err := toJSONValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+
+			items[i] = item
+		}
+
+		return items, nil
+	case *starlark.Dict:
+		obj := make(map[string]interface{}, v.Len())
+		for _, pair := range v.Items() {
+			key, ok := pair[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict keys must be strings, got %s", pair[0].Type())
+			}
+
+			item, err := toJSONValue(pair[1])
+			if err != nil {
+				return nil, err
+			}
+
+			obj[string(key)] = item
+		}
+
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("%s values can't be written as json", value.Type())
+}
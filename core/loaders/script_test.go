@@ -0,0 +1,145 @@
+package loaders
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+func newScriptLoader(args map[string]interface{}) (TypeLoader, error) {
+	ctx := make(TypeLoaderFactoryContext)
+	AddDefaultLoaderFactories(&ctx)
+
+	return ctx.NewLoader(conf.NewConfiguration(), &conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "script", Args: args}})
+}
+
+func scriptRowWithAmount(index int, amount int) *res.ResultsRow {
+	row := res.NewResultsRow(index, int64(index))
+	row.Values = append(row.Values, &res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "amount", Kind: conf.NumberKind}, Value: strconv.Itoa(amount)})
+
+	return row
+}
+
+func TestScriptLoaderGeneratesValues(t *testing.T) {
+	loader, err := newScriptLoader(map[string]interface{}{
+		"source": strings.Join([]string{
+			`states = dataset("states.csv")`,
+			`def generate(row):`,
+			`    return {"state": rand.choice(states), "double": row["amount"] * params["factor"], "n": rand.randint(1, 6)}`,
+		}, "\n"),
+		"params":  map[string]interface{}{"factor": 2},
+		"datadir": "../../data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ordered := loader.(TypeLoaderWithOrder); ordered.GeneratesInOrder() {
+		t.Errorf("Expected a script without state to generate in any order")
+	}
+
+	config := conf.NewConfiguration()
+	first, err := loader.GenerateSingleValue(config, scriptRowWithAmount(0, 21))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(first.(string), `"double":42`) || !strings.Contains(first.(string), `"state":"`) {
+		t.Errorf("Expected the script's dict as json, got %v", first)
+	}
+
+	again, _ := loader.GenerateSingleValue(config, scriptRowWithAmount(0, 21))
+	if again != first {
+		t.Errorf("Expected the same row to get the same value, got %v and %v", first, again)
+	}
+}
+
+func TestScriptLoaderKeepsState(t *testing.T) {
+	loader, err := newScriptLoader(map[string]interface{}{
+		"source": "def generate(row, state):\n    state['total'] = state.get('total', 0) + row['amount']\n    return state['total']",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loader.(TypeLoaderWithOrder).GeneratesInOrder() {
+		t.Errorf("Expected a script with state to generate in order")
+	}
+
+	config := conf.NewConfiguration()
+	for i, expected := range []string{"1", "3", "6"} {
+		value, err := loader.GenerateSingleValue(config, scriptRowWithAmount(i, i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != expected {
+			t.Errorf("Expected a running total of %s in row %d, got %v", expected, i, value)
+		}
+	}
+	if err := loader.(TypeLoaderWithReset).Reset(&res.Run{Table: "t"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if value, _ := loader.GenerateSingleValue(config, scriptRowWithAmount(0, 5)); value != "5" {
+		t.Errorf("Expected a new run to start with empty state, got %v", value)
+	}
+}
+
+func TestScriptLoaderReportsMistakes(t *testing.T) {
+	cases := []struct {
+		args     map[string]interface{}
+		expected string
+		loadErr  bool
+	}{
+		{map[string]interface{}{"source": "x = 1"}, "doesn't define a generate function", true},
+		{map[string]interface{}{"source": "def generate(row, state, extra):\n    return 1"}, "takes 3 parameters", true},
+		{map[string]interface{}{"source": "def generate(row)\n    return 1"}, "source:2:1:", true},
+		{map[string]interface{}{"source": "x = 1", "file": "script.star"}, "either source or file", true},
+		{map[string]interface{}{"source": "def generate(row):\n    x = 1\n    return row['missing']"}, "source:3:", false},
+		{map[string]interface{}{"source": "def generate(row):\n    while True:\n        pass", "maxsteps": 1000}, "too many steps", false},
+		{map[string]interface{}{"source": "def generate(row):\n    return {1: 2}"}, "can't be written as json", false},
+	}
+
+	for _, c := range cases {
+		loader, err := newScriptLoader(c.args)
+		if !c.loadErr && err == nil {
+			_, err = loader.GenerateSingleValue(conf.NewConfiguration(), scriptRowWithAmount(0, 1))
+		}
+
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("Expected an error containing '%s' for %v, got %v", c.expected, c.args["source"], err)
+		}
+	}
+}
+
+func TestScriptDatasetsStayInTheirDirectories(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := ioutil.WriteFile(outside, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a link from the data directory to a file outside it
+	dataDir := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dataDir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{outside, "../../../../../../../../etc/passwd", "~/.profile", "$HOME/.profile", "link.txt"} {
+		_, err := newScriptLoader(map[string]interface{}{
+			"source":  fmt.Sprintf("names = dataset(%q)\ndef generate(row):\n    return names[0]", path),
+			"datadir": dataDir,
+		})
+
+		if err == nil || !strings.Contains(err.Error(), "can't read") && !strings.Contains(err.Error(), "failed to read") {
+			t.Errorf("Expected dataset to refuse '%s', got %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/loaders"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+// Masker replaces the values of a configuration's fields in existing rows with generated ones
+type Masker struct {
+	config *conf.Configuration
+	types  map[string]loaders.TypeLoader
+	key    []byte
+
+	// every masked row is part of the same run
+	run *res.Run
+
+	// for unique fields, the fake value each real value got and the real value each fake one replaced, both keyed by
+	// a hash of the real value; mapped once a mapping is used, which fakes are then kept in
+	uniques map[string]*maskedValues
+	mapped  bool
+}
+
+type maskedValues struct {
+	fakes map[string]string
+	reals map[string]string
+}
+
+// MaskMapping is the fake value each real value of each unique field got, keyed by field name and then by a keyed
+// hash of the real value, so it can be kept without keeping the real values
+type MaskMapping map[string]map[string]string
+
+func NewMasker(config *conf.Configuration, key []byte) (*Masker, error) {
+	return NewMaskerWithTypeLoaderContext(config, NewTypeLoaderFactoryContext(), key)
+}
+
+func NewMaskerWithTypeLoaderContext(config *conf.Configuration, loaderFactoryContext *loaders.TypeLoaderFactoryContext, key []byte) (*Masker, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("Expected a key to mask values with")
+	}
+
+	types, err := BuildTypeLoadersForConfig(config, loaderFactoryContext)
+	if err != nil {
+		return nil, err
+	}
+
+	run := res.NewRun(context.Background(), config, 0)
+	if err := loaders.ResetTypeLoaders(typeLoaderList(types), run); err != nil {
+		CloseTypeLoaders(types)
+		return nil, err
+	}
+
+	uniques := make(map[string]*maskedValues)
+	for _, field := range config.Fields {
+		if field.Unique {
+			uniques[field.Name] = &maskedValues{fakes: make(map[string]string), reals: make(map[string]string)}
+		}
+	}
+
+	return &Masker{config: config, types: types, key: key, run: run, uniques: uniques}, nil
+}
+
+// UseMapping gives the real values of unique fields the fakes they got in mapping, and records the fakes new values
+// get in it, so a mapping kept between runs masks each value the same way whatever was masked before it. Without one,
+// a value whose fake one was already given to another value can't be masked. It's called before masking any rows.
+func (masker *Masker) UseMapping(mapping MaskMapping) error {
+	for name, masked := range masker.uniques {
+		fakes, ok := mapping[name]
+		if !ok {
+			fakes = make(map[string]string)
+			mapping[name] = fakes
+		}
+
+		reals := make(map[string]string, len(fakes))
+		for hash, fake := range fakes {
+			if _, taken := reals[fake]; taken {
+				return fmt.Errorf("Mapping gives '%s' to more than one value of field '%s'", fake, name)
+			}
+
+			reals[fake] = hash
+		}
+
+		masked.fakes, masked.reals = fakes, reals
+	}
+
+	masker.mapped = true
+	return nil
+}
+
+// Close releases what the masker's loaders hold, like files or programs
+func (masker *Masker) Close() error {
+	return CloseTypeLoaders(masker.types)
+}
+
+// Fields returns the names of the fields the masker replaces
+func (masker *Masker) Fields() []string {
+	names := make([]string, len(masker.config.Fields))
+	for i, field := range masker.config.Fields {
+		names[i] = field.Name
+	}
+
+	return names
+}
+
+// MaskRow replaces the row's values for the configuration's fields, in the configuration's order. Each value is
+// generated with randomness seeded by a keyed hash of the value it replaces, so with the same key and type the
+// same value is always replaced the same way, whatever row, table or file it's in. Null and empty values are kept.
+//
+// Two values of a unique field never get the same fake value. With a mapping, a value whose fake one was already given
+// to another value is generated again with the next of a series of seeds, and the mapping keeps the fake it got for
+// later rows and runs; without one, it's an error.
+func (masker *Masker) MaskRow(row *res.ResultsRow) error {
+	for _, field := range masker.config.Fields {
+		original, err := row.Values.GetEntryWithName(field.Name)
+		if err != nil || original.Null || original.Value == "" {
+			continue
+		}
+
+		entry, err := masker.maskValue(field, original.Value, row)
+		if err == errNoLoaderForType {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to mask field '%s' in row %d: %s", field.Name, row.Index, err)
+		}
+
+		if entry.Kind == "" {
+			entry.Kind = original.Kind
+		}
+
+		*original = *entry
+	}
+
+	return nil
+}
+
+func (masker *Masker) maskValue(field *conf.ConfigurationField, value string, row *res.ResultsRow) (*res.ResultsRowValue, error) {
+	masked := masker.uniques[field.Name]
+
+	var hash string
+	if masked != nil {
+		hash = masker.hash(value)
+		if fake, ok := masked.fakes[hash]; ok {
+			return &res.ResultsRowValue{ConfigurationField: *field, Value: fake}, nil
+		}
+	}
+
+	row.Run = masker.run
+
+	for attempt := 0; attempt < maxUniqueAttempts; attempt++ {
+		row.Rand = res.NewRand(masker.seed(value, attempt))
+
+		entry, err := GenerateValueForField(masker.config, *field, row, masker.types)
+		if err != nil || masked == nil {
+			return entry, err
+		}
+
+		// nulls, like those from a nullrate, can repeat
+		if entry.IsNull() || entry.Value == "" {
+			return entry, nil
+		}
+
+		if real, taken := masked.reals[entry.Value]; !taken || real == hash {
+			masked.fakes[hash] = entry.Value
+			masked.reals[entry.Value] = hash
+
+			return entry, nil
+		}
+
+		// which of the two got its fake first would decide what the other gets, so without a mapping to remember it
+		// the same value could get a different fake in another file
+		if !masker.mapped {
+			return nil, fmt.Errorf("its fake value '%s' was already given to another value; use a mapping to mask unique fields whose types have few distinct values", entry.Value)
+		}
+	}
+
+	return nil, fmt.Errorf("no unique value after %d attempts; its type may not have enough distinct values", maxUniqueAttempts)
+}
+
+// hash identifies value in mappings without revealing it
+func (masker *Masker) hash(value string) string {
+	mac := hmac.New(sha256.New, masker.key)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seed derives the seed for masking value from the key; later attempts at a unique value get seeds of their own
+func (masker *Masker) seed(value string, attempt int) int64 {
+	mac := hmac.New(sha256.New, masker.key)
+	mac.Write([]byte(value))
+
+	if attempt > 0 {
+		mac.Write([]byte("\x00" + strconv.Itoa(attempt)))
+	}
+
+	return int64(binary.BigEndian.Uint64(mac.Sum(nil)))
+}
+
+// NewResultsRowFromValues returns a row holding existing values, like those read by the input package: strings,
+// bools, json.Numbers, nil, or anything else json can encode
+func NewResultsRowFromValues(index int, names []string, values []interface{}) *res.ResultsRow {
+	row := res.NewResultsRow(index, int64(index))
+
+	for i, name := range names {
+		entry := &res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: name}}
+
+		switch v := values[i].(type) {
+		case nil:
+			entry.Null = true
+		case string:
+			entry.Value = v
+		case bool:
+			entry.Value, entry.Kind = strconv.FormatBool(v), conf.BooleanKind
+		case json.Number:
+			entry.Value, entry.Kind = v.String(), conf.NumberKind
+		default:
+			content, _ := json.Marshal(v)
+			entry.Value, entry.Kind = string(content), conf.JSONKind
+		}
+
+		row.Values = append(row.Values, entry)
+	}
+
+	return row
+}
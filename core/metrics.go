@@ -0,0 +1,162 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+)
+
+// Metrics count the rows of the runs they're passed to with WithMetrics and time each of their loaders, to show what
+// a run's time goes to. They can be read while a run is going, e.g. to report progress, but should only be passed to
+// one run at a time.
+type Metrics struct {
+	rows    int64
+	retries int64
+
+	mu      sync.Mutex
+	started time.Time
+	elapsed time.Duration
+	types   map[string]*typeMetrics
+}
+
+type typeMetrics struct {
+	loader string
+
+	// updated atomically, since workers generate values at the same time
+	values int64
+	nulls  int64
+	nanos  int64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{types: make(map[string]*typeMetrics)}
+}
+
+type metricsKey struct{}
+
+// WithMetrics returns a context that has runs generating with it record their metrics in metrics
+func WithMetrics(ctx context.Context, metrics *Metrics) context.Context {
+	return context.WithValue(ctx, metricsKey{}, metrics)
+}
+
+func metricsFrom(ctx context.Context) *Metrics {
+	metrics, _ := ctx.Value(metricsKey{}).(*Metrics)
+	return metrics
+}
+
+// Rows returns the number of rows generated so far
+func (metrics *Metrics) Rows() int64 {
+	return atomic.LoadInt64(&metrics.rows)
+}
+
+// Elapsed returns the time runs have taken so far
+func (metrics *Metrics) Elapsed() time.Duration {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	if metrics.started.IsZero() {
+		return metrics.elapsed
+	}
+
+	return metrics.elapsed + time.Since(metrics.started)
+}
+
+// start adds the config's types before a run, so they're only read while it's going
+func (metrics *Metrics) start(config *conf.Configuration) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	metrics.started = time.Now()
+
+	for _, field := range config.Fields {
+		if _, ok := metrics.types[field.Type]; ok {
+			continue
+		}
+
+		t, ok := config.Types[field.Type]
+		if !ok {
+			continue
+		}
+
+		metrics.types[field.Type] = &typeMetrics{loader: t.LoaderArgs.Name}
+	}
+}
+
+func (metrics *Metrics) stop() {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	metrics.elapsed += time.Since(metrics.started)
+	metrics.started = time.Time{}
+}
+
+func (metrics *Metrics) value(field *conf.ConfigurationField, took time.Duration, null bool) {
+	t, ok := metrics.types[field.Type]
+	if !ok {
+		return
+	}
+
+	atomic.AddInt64(&t.values, 1)
+	atomic.AddInt64(&t.nanos, int64(took))
+	if null {
+		atomic.AddInt64(&t.nulls, 1)
+	}
+}
+
+// MetricsSummary is a copy of metrics at some point
+type MetricsSummary struct {
+	Rows int64 `json:"rows"`
+
+	// rows generated again because they repeated a value of a unique field
+	UniqueRetries int64 `json:"uniqueRetries"`
+
+	Elapsed time.Duration `json:"elapsed"`
+
+	// slowest first
+	Types []TypeMetrics `json:"types"`
+}
+
+type TypeMetrics struct {
+	Type   string `json:"type"`
+	Loader string `json:"loader"`
+	Values int64  `json:"values"`
+	Nulls  int64  `json:"nulls"`
+
+	// time spent generating the type's values, summed over every worker
+	Time time.Duration `json:"time"`
+}
+
+func (metrics *Metrics) Summary() MetricsSummary {
+	summary := MetricsSummary{
+		Rows:          metrics.Rows(),
+		UniqueRetries: atomic.LoadInt64(&metrics.retries),
+		Elapsed:       metrics.Elapsed(),
+		Types:         make([]TypeMetrics, 0),
+	}
+
+	metrics.mu.Lock()
+	for name, t := range metrics.types {
+		summary.Types = append(summary.Types, TypeMetrics{
+			Type:   name,
+			Loader: t.loader,
+			Values: atomic.LoadInt64(&t.values),
+			Nulls:  atomic.LoadInt64(&t.nulls),
+			Time:   time.Duration(atomic.LoadInt64(&t.nanos)),
+		})
+	}
+	metrics.mu.Unlock()
+
+	sort.Slice(summary.Types, func(i, j int) bool {
+		if summary.Types[i].Time != summary.Types[j].Time {
+			return summary.Types[i].Time > summary.Types[j].Time
+		}
+
+		return summary.Types[i].Type < summary.Types[j].Type
+	})
+
+	return summary
+}
@@ -0,0 +1,249 @@
+package mock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// query parameters that aren't filters, named like json-server's so existing clients keep working
+const (
+	pageParam  = "_page"
+	limitParam = "_limit"
+	sortParam  = "_sort"
+	orderParam = "_order"
+	queryParam = "q"
+)
+
+// default page size when only _page is given
+const defaultLimit = 10
+
+// suffixes of filter parameters, like age_gte=18; a parameter without one must match exactly
+var filterOperators = []string{"_gte", "_lte", "_ne", "_like"}
+
+type filter struct {
+	field    string
+	operator string
+	values   []string
+}
+
+// list writes the records matching the query's filters, sorted and paged, with the number of matches in X-Total-Count
+func (res *resource) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filters, search := parseFilters(query)
+
+	page, err := intParam(query, pageParam, 1)
+	if err != nil || page < 1 {
+		writeError(w, http.StatusBadRequest, "%s must be a whole number greater than 0", pageParam)
+		return
+	}
+
+	limit, err := intParam(query, limitParam, -1)
+	if err != nil || limit < -1 {
+		writeError(w, http.StatusBadRequest, "%s must be a whole number", limitParam)
+		return
+	}
+
+	if limit == -1 && query.Get(pageParam) != "" {
+		limit = defaultLimit
+	}
+
+	res.mu.RLock()
+	matches := make([]Record, 0)
+	for _, record := range res.records {
+		if matchesAll(record, filters) && (search == "" || matchesSearch(record, search)) {
+			matches = append(matches, record)
+		}
+	}
+	res.mu.RUnlock()
+
+	if fields := query.Get(sortParam); fields != "" {
+		sortRecords(matches, strings.Split(fields, ","), strings.Split(query.Get(orderParam), ","))
+	}
+
+	total := len(matches)
+	if limit >= 0 {
+		start := (page - 1) * limit
+		if start > total {
+			start = total
+		}
+
+		end := start + limit
+		if end > total {
+			end = total
+		}
+
+		matches = matches[start:end]
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count")
+	writeJSON(w, http.StatusOK, matches)
+}
+
+func intParam(query url.Values, name string, def int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+func parseFilters(query url.Values) ([]filter, string) {
+	filters := make([]filter, 0)
+
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch name {
+		case pageParam, limitParam, sortParam, orderParam, queryParam:
+			continue
+		}
+
+		f := filter{field: name, values: query[name]}
+		for _, operator := range filterOperators {
+			if strings.HasSuffix(name, operator) && len(name) > len(operator) {
+				f.field, f.operator = strings.TrimSuffix(name, operator), operator
+				break
+			}
+		}
+
+		filters = append(filters, f)
+	}
+
+	return filters, strings.ToLower(query.Get(queryParam))
+}
+
+func matchesAll(record Record, filters []filter) bool {
+	for _, f := range filters {
+		if !f.matches(record) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matches reports whether the record's value satisfies the filter; several values for an exact match are
+// alternatives, and for the other operators they must all hold
+func (f filter) matches(record Record) bool {
+	value := record[f.field]
+	text := valueString(value)
+
+	switch f.operator {
+	case "":
+		for _, want := range f.values {
+			if text == want {
+				return true
+			}
+		}
+
+		return false
+
+	case "_ne":
+		for _, want := range f.values {
+			if text == want {
+				return false
+			}
+		}
+
+	case "_like":
+		for _, want := range f.values {
+			if !strings.Contains(strings.ToLower(text), strings.ToLower(want)) {
+				return false
+			}
+		}
+
+	case "_gte", "_lte":
+		for _, want := range f.values {
+			c := compareWith(value, want)
+			if value == nil || f.operator == "_gte" && c < 0 || f.operator == "_lte" && c > 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// matchesSearch reports whether any of the record's values contains the (lowercased) search
+func matchesSearch(record Record, search string) bool {
+	for _, value := range record {
+		if value != nil && strings.Contains(strings.ToLower(valueString(value)), search) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareWith compares a value to a query parameter, as numbers when both are numbers and as strings otherwise
+func compareWith(value interface{}, param string) int {
+	if n, ok := value.(json.Number); ok {
+		if a, err := n.Float64(); err == nil {
+			if b, err := strconv.ParseFloat(param, 64); err == nil {
+				return compareFloats(a, b)
+			}
+		}
+	}
+
+	return strings.Compare(valueString(value), param)
+}
+
+func compareFloats(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+// compareValues orders two values of a field; nulls and missing values go last
+func compareValues(a interface{}, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	if n, ok := b.(json.Number); ok {
+		return compareWith(a, n.String())
+	}
+
+	return strings.Compare(valueString(a), valueString(b))
+}
+
+// sortRecords sorts by each field in turn, in the matching order ("asc" unless it's "desc")
+func sortRecords(records []Record, fields []string, orders []string) {
+	sort.SliceStable(records, func(i, j int) bool {
+		for k, field := range fields {
+			c := compareValues(records[i][field], records[j][field])
+			if c == 0 {
+				continue
+			}
+
+			if k < len(orders) && strings.EqualFold(orders[k], "desc") && records[i][field] != nil && records[j][field] != nil {
+				c = -c
+			}
+
+			return c < 0
+		}
+
+		return false
+	})
+}
@@ -0,0 +1,370 @@
+// Package mock serves a REST API over datasets generated once, up front, which requests can then page through,
+// filter, sort and change.
+package mock
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/output"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Record is one item of a resource, as it's written in json
+type Record map[string]interface{}
+
+type resource struct {
+	name    string
+	idField string
+
+	// whether new ids count up from the largest id, or are random uuids
+	sequential bool
+
+	mu      sync.RWMutex
+	records []Record
+}
+
+type Server struct {
+	resources map[string]*resource
+}
+
+// New generates each configuration's rows and returns a server with a resource for each at /<name>
+func New(configs map[string]*conf.Configuration) (*Server, error) {
+	server := &Server{resources: make(map[string]*resource)}
+
+	for name, config := range configs {
+		if strings.ContainsAny(name, "/?#") || name == "" {
+			return nil, fmt.Errorf("Can't serve '%s'; names can't be empty or contain '/', '?' or '#'", name)
+		}
+
+		r, err := newResource(name, config)
+		if err != nil {
+			return nil, err
+		}
+
+		server.resources[name] = r
+	}
+
+	return server, nil
+}
+
+func newResource(name string, config *conf.Configuration) (*resource, error) {
+	idField, sequential, err := findIDField(config)
+	if err != nil {
+		return nil, fmt.Errorf("Can't serve '%s': %s", name, err)
+	}
+
+	results, err := core.GenerateResults(config)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate '%s': %s", name, err)
+	}
+
+	r := &resource{name: name, idField: idField, sequential: sequential, records: make([]Record, 0, len(results.Rows))}
+	for _, row := range results.Rows {
+		// round trip through json so generated records hold the same kinds of values as ones that are posted
+		content, err := json.Marshal(output.ToJsonObject(row))
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := decodeRecord(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+
+		r.records = append(r.records, record)
+	}
+
+	return r, nil
+}
+
+// findIDField returns the field that identifies records: the first with an autoincrement or uuid type, or else one
+// named id
+func findIDField(config *conf.Configuration) (string, bool, error) {
+	for _, field := range config.Fields {
+		t, err := config.ResolveFieldType(field)
+		if err != nil {
+			continue
+		}
+
+		switch t.LoaderArgs.Name {
+		case "autoincrement":
+			return field.Name, true, nil
+		case "uuid":
+			return field.Name, false, nil
+		}
+	}
+
+	for _, field := range config.Fields {
+		if strings.EqualFold(field.Name, "id") {
+			return field.Name, false, nil
+		}
+	}
+
+	return "", false, fmt.Errorf("no field identifies its records; give one an autoincrement or uuid type, or name it id")
+}
+
+func decodeRecord(r io.Reader) (Record, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+
+	var record Record
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+
+	if record == nil {
+		return nil, fmt.Errorf("expected an object")
+	}
+
+	return record, nil
+}
+
+// Names returns the names of the resources in sorted order
+func (server *Server) Names() []string {
+	names := make([]string, 0, len(server.resources))
+	for name := range server.resources {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		server.serveIndex(w, r)
+		return
+	}
+
+	name, id := path, ""
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		name, id = path[:i], path[i+1:]
+	}
+
+	res, ok := server.resources[name]
+	if !ok || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "No resource at '/%s'; try one of: /%s", path, strings.Join(server.Names(), ", /"))
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		res.list(w, r)
+	case id == "" && r.Method == http.MethodPost:
+		res.create(w, r)
+	case id != "" && r.Method == http.MethodGet:
+		res.get(w, id)
+	case id != "" && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		res.update(w, r, id, r.Method == http.MethodPatch)
+	case id != "" && r.Method == http.MethodDelete:
+		res.delete(w, id)
+	case id == "":
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET or POST")
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET, PUT, PATCH or DELETE")
+	}
+}
+
+func (server *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeError(w, http.StatusMethodNotAllowed, "Expected GET")
+		return
+	}
+
+	type resourceInfo struct {
+		Path  string `json:"path"`
+		ID    string `json:"id"`
+		Count int    `json:"count"`
+	}
+
+	index := make([]resourceInfo, 0, len(server.resources))
+	for _, name := range server.Names() {
+		res := server.resources[name]
+
+		res.mu.RLock()
+		index = append(index, resourceInfo{Path: "/" + name, ID: res.idField, Count: len(res.records)})
+		res.mu.RUnlock()
+	}
+
+	writeJSON(w, http.StatusOK, index)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+// idString returns an id as it's written in a url
+func idString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+
+	return valueString(value)
+}
+
+// valueString returns a value as it's compared with query parameters
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	content, _ := json.Marshal(value)
+	return string(content)
+}
+
+// find returns the index of the record with the id, or -1; callers hold the lock
+func (res *resource) find(id string) int {
+	for i, record := range res.records {
+		if idString(record[res.idField]) == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (res *resource) get(w http.ResponseWriter, id string) {
+	res.mu.RLock()
+	defer res.mu.RUnlock()
+
+	i := res.find(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "No %s with %s '%s'", res.name, res.idField, id)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res.records[i])
+}
+
+func (res *resource) create(w http.ResponseWriter, r *http.Request) {
+	record, err := decodeRecord(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Expected a json object: %s", err)
+		return
+	}
+
+	res.mu.Lock()
+	defer res.mu.Unlock()
+
+	if record[res.idField] == nil {
+		record[res.idField] = res.nextID()
+	}
+
+	id := idString(record[res.idField])
+	if res.find(id) >= 0 {
+		writeError(w, http.StatusConflict, "A %s with %s '%s' already exists", res.name, res.idField, id)
+		return
+	}
+
+	res.records = append(res.records, record)
+
+	w.Header().Set("Location", "/"+res.name+"/"+id)
+	writeJSON(w, http.StatusCreated, record)
+}
+
+// nextID returns an id for a new record; callers hold the lock
+func (res *resource) nextID() interface{} {
+	if !res.sequential {
+		var id uuid.UUID
+		rand.Read(id[:])
+
+		id[6] = (id[6] & 0x0f) | 0x40
+		id[8] = (id[8] & 0x3f) | 0x80
+
+		return id.String()
+	}
+
+	max := int64(0)
+	for _, record := range res.records {
+		if n, err := strconv.ParseInt(idString(record[res.idField]), 10, 64); err == nil && n > max {
+			max = n
+		}
+	}
+
+	return json.Number(strconv.FormatInt(max+1, 10))
+}
+
+// update replaces the record with the id, or with patch, only the values in the request; its id can't change
+func (res *resource) update(w http.ResponseWriter, r *http.Request, id string, patch bool) {
+	changes, err := decodeRecord(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Expected a json object: %s", err)
+		return
+	}
+
+	res.mu.Lock()
+	defer res.mu.Unlock()
+
+	i := res.find(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "No %s with %s '%s'", res.name, res.idField, id)
+		return
+	}
+
+	if value, ok := changes[res.idField]; ok && idString(value) != id {
+		writeError(w, http.StatusBadRequest, "Can't change the %s of a %s", res.idField, res.name)
+		return
+	}
+
+	record := changes
+	if patch {
+		record = make(Record, len(res.records[i]))
+		for name, value := range res.records[i] {
+			record[name] = value
+		}
+
+		for name, value := range changes {
+			record[name] = value
+		}
+	}
+
+	record[res.idField] = res.records[i][res.idField]
+	res.records[i] = record
+
+	writeJSON(w, http.StatusOK, record)
+}
+
+func (res *resource) delete(w http.ResponseWriter, id string) {
+	res.mu.Lock()
+	defer res.mu.Unlock()
+
+	i := res.find(id)
+	if i < 0 {
+		writeError(w, http.StatusNotFound, "No %s with %s '%s'", res.name, res.idField, id)
+		return
+	}
+
+	res.records = append(res.records[:i], res.records[i+1:]...)
+	w.WriteHeader(http.StatusNoContent)
+}
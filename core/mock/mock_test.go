@@ -0,0 +1,141 @@
+package mock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	config, err := core.LoadConfigurationFromJson(`{
+		"rows": 30, "options": {"seed": 1},
+		"fields": [
+			{"name": "id", "type": "id", "kind": "integer"},
+			{"name": "status", "type": "status"},
+			{"name": "age", "type": "age", "kind": "integer"}
+		],
+		"types": {
+			"id": {"loader": {"name": "autoincrement"}},
+			"status": {"loader": {"name": "choice", "args": {"values": ["active", "banned"]}}},
+			"age": {"loader": {"name": "number", "args": {"min": 18, "max": 90}}}
+		}
+	}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := New(map[string]*conf.Configuration{"users": config})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func do(t *testing.T, method string, url string, body string, into interface{}) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if into != nil {
+		if err := json.Unmarshal(content, into); err != nil {
+			t.Fatalf("Failed to decode %s %s: %s: %s", method, url, err, content)
+		}
+	}
+
+	return resp
+}
+
+func TestListFiltersSortsAndPages(t *testing.T) {
+	ts := newTestServer(t)
+
+	var page []map[string]interface{}
+	resp := do(t, http.MethodGet, ts.URL+"/users?status=active&age_gte=30&_sort=age,id&_order=desc,asc&_page=2&_limit=3", "", &page)
+
+	var all []map[string]interface{}
+	do(t, http.MethodGet, ts.URL+"/users?status=active&age_gte=30", "", &all)
+
+	if total := resp.Header.Get("X-Total-Count"); total != strconv.Itoa(len(all)) {
+		t.Errorf("Expected X-Total-Count of %d, got '%s'", len(all), total)
+	}
+
+	if len(all) < 6 || len(page) != 3 {
+		t.Fatalf("Expected a second page of 3 of at least 6 matches, got %d of %d", len(page), len(all))
+	}
+
+	for i, record := range page {
+		if record["status"] != "active" || record["age"].(float64) < 30 {
+			t.Errorf("Expected active users of 30 or more, got %v", record)
+		}
+
+		if i > 0 && record["age"].(float64) > page[i-1]["age"].(float64) {
+			t.Errorf("Expected ages in descending order, got %v after %v", record["age"], page[i-1]["age"])
+		}
+	}
+}
+
+func TestCreateUpdateAndDelete(t *testing.T) {
+	ts := newTestServer(t)
+
+	var created map[string]interface{}
+	resp := do(t, http.MethodPost, ts.URL+"/users", `{"status": "new", "age": 20}`, &created)
+	if resp.StatusCode != http.StatusCreated || created["id"] != 31.0 || resp.Header.Get("Location") != "/users/31" {
+		t.Fatalf("Expected user 31 to be created, got %d %v", resp.StatusCode, created)
+	}
+
+	if resp := do(t, http.MethodPost, ts.URL+"/users", `{"id": 31}`, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a conflict for an existing id, got %d", resp.StatusCode)
+	}
+
+	var patched map[string]interface{}
+	do(t, http.MethodPatch, ts.URL+"/users/31", `{"age": 21}`, &patched)
+	if patched["age"] != 21.0 || patched["status"] != "new" {
+		t.Errorf("Expected only the age to change, got %v", patched)
+	}
+
+	var replaced map[string]interface{}
+	do(t, http.MethodPut, ts.URL+"/users/31", `{"age": 22}`, &replaced)
+	if replaced["age"] != 22.0 || replaced["id"] != 31.0 || replaced["status"] != nil {
+		t.Errorf("Expected the user to be replaced, keeping its id, got %v", replaced)
+	}
+
+	var fetched map[string]interface{}
+	if resp := do(t, http.MethodGet, ts.URL+"/users/31", "", &fetched); resp.StatusCode != http.StatusOK || fetched["age"] != 22.0 {
+		t.Errorf("Expected to get the replaced user, got %d %v", resp.StatusCode, fetched)
+	}
+
+	if resp := do(t, http.MethodDelete, ts.URL+"/users/31", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected the user to be deleted, got %d", resp.StatusCode)
+	}
+
+	if resp := do(t, http.MethodGet, ts.URL+"/users/31", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a deleted user to be gone, got %d", resp.StatusCode)
+	}
+
+	if resp := do(t, http.MethodPost, ts.URL+"/users", `[1, 2]`, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a bad request for a body that isn't an object, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,271 @@
+package oar
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+)
+
+type tag struct {
+	name     string
+	typeName string
+	unique   bool
+	nullRate float64
+	args     map[string]interface{}
+}
+
+// parseTag parses tags like `type=number,min=1,max=10,unique`; commas inside brackets, braces and quotes don't
+// separate pairs, so args can be json lists and objects
+func parseTag(raw string) (*tag, error) {
+	t := &tag{}
+
+	for _, part := range splitTag(raw) {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(part), "=")
+		if key == "" {
+			continue
+		}
+
+		switch {
+		case key == "unique" && !hasValue:
+			t.unique = true
+		case !hasValue:
+			return nil, fmt.Errorf("expected key=value or unique, got '%s'", key)
+		case key == "name":
+			t.name = value
+		case key == "type":
+			t.typeName = value
+		case key == "nullrate":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("nullrate must be a number, got '%s'", value)
+			}
+
+			t.nullRate = n
+		default:
+			if t.args == nil {
+				t.args = make(map[string]interface{})
+			}
+
+			t.args[key] = tagArg(value)
+		}
+	}
+
+	return t, nil
+}
+
+func splitTag(raw string) []string {
+	parts := make([]string, 0)
+
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(raw); i++ {
+		switch c := raw[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, raw[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, raw[start:])
+}
+
+// tagArg decodes an arg's value as json, like args in configuration files, or keeps it as a string
+func tagArg(value string) interface{} {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil || decoder.More() {
+		return value
+	}
+
+	return decoded
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// defaultType returns a type for fields without one, named after their Go type
+func defaultType(t reflect.Type) (string, conf.UseTypeDTO, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "string", loaderType("text", nil), nil
+	case reflect.Bool:
+		return "bool", loaderType("choice", map[string]interface{}{"values": []interface{}{true, false}}), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return t.Kind().String(), loaderType("number", map[string]interface{}{"max": int64(math.MaxInt64 >> (64 - t.Bits()))}), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// number's max is an int64, so the largest uint64s are left out
+		bits := t.Bits()
+		if bits == 64 {
+			bits = 63
+		}
+
+		return t.Kind().String(), loaderType("number", map[string]interface{}{"max": int64(math.MaxInt64 >> (63 - bits))}), nil
+	case reflect.Float32, reflect.Float64:
+		return t.Kind().String(), loaderType("number", map[string]interface{}{"max": 1000, "decimals": 2}), nil
+	}
+
+	if t == timeType {
+		return "time", loaderType("datetime", map[string]interface{}{"format": "rfc3339"}), nil
+	}
+
+	return "", conf.UseTypeDTO{}, fmt.Errorf("No default type for '%s'; tag it with a type, or with `oar:\"-\"` to leave it out", t)
+}
+
+// kindOf returns how values of t are written in json output
+func kindOf(t reflect.Type) conf.FieldKind {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return conf.IntegerKind
+	case reflect.Float32, reflect.Float64:
+		return conf.NumberKind
+	case reflect.Bool:
+		return conf.BooleanKind
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		if t != timeType && !reflect.PointerTo(t).Implements(textUnmarshalerType) {
+			return conf.JSONKind
+		}
+	}
+
+	return ""
+}
+
+// layouts generated times are parsed with: datetime's named formats, its default and unix seconds
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", "15:04:05", "2006-01-02 15:04:05.999999999 -0700 MST"}
+
+// assign sets target to a generated value, converted to target's type; null values leave it at its zero value
+func assign(target reflect.Value, value string, null bool) error {
+	if null {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	if target.Kind() == reflect.Ptr {
+		elem := reflect.New(target.Type().Elem())
+		if err := assign(elem.Elem(), value, false); err != nil {
+			return err
+		}
+
+		target.Set(elem)
+		return nil
+	}
+
+	if target.Type() == timeType {
+		t, err := parseTime(value)
+		if err != nil {
+			return err
+		}
+
+		target.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if unmarshaler, ok := target.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return unmarshaler.UnmarshalText([]byte(value))
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(value)
+		return nil
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got '%s'", value)
+		}
+
+		target.SetBool(b)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || target.OverflowInt(n) {
+			return fmt.Errorf("'%s' isn't a whole number that fits in %s", value, target.Type())
+		}
+
+		target.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || target.OverflowUint(n) {
+			return fmt.Errorf("'%s' isn't a whole number that fits in %s", value, target.Type())
+		}
+
+		target.SetUint(n)
+		return nil
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, target.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("'%s' isn't a number", value)
+		}
+
+		target.SetFloat(n)
+		return nil
+
+	case reflect.Interface:
+		// json values are decoded, and anything else kept as a string
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			decoded = value
+		}
+
+		if decoded != nil {
+			target.Set(reflect.ValueOf(decoded))
+		}
+
+		return nil
+
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		if err := json.Unmarshal([]byte(value), target.Addr().Interface()); err != nil {
+			return fmt.Errorf("Failed to decode '%s' into %s: %s", value, target.Type(), err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("Can't assign values to fields of type %s", target.Type())
+}
+
+func parseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("Can't parse '%s' as a time", value)
+}
@@ -0,0 +1,263 @@
+// Package oar fills Go structs with generated values. It derives a configuration from the struct's fields and their
+// oar tags, generates rows with the same loaders as configuration files, and assigns each value to its field as the
+// field's own type:
+//
+//	type User struct {
+//		ID      int       `oar:"type=autoincrement"`
+//		Email   string    `oar:"type=email,unique"`
+//		Age     int       `oar:"type=number,min=18,max=90"`
+//		Status  string    `oar:"type=choice,values=[\"active\",\"banned\"]"`
+//		Bio     *string   `oar:"nullrate=0.2"`
+//		Created time.Time `oar:"name=created_at"`
+//		Notes   string    `oar:"-"`
+//	}
+//
+//	users, err := oar.Generate[User](100, oar.WithSeed(1))
+//
+// A tag's type is a type passed with WithTypes, one of the built-in types (email, phone, firstname, lastname, city,
+// state, zipcode, company and address) or the name of a loader. Its other key=value pairs are args for that loader,
+// written as json or, for strings, as they are. Fields without a type get one that fits their Go type.
+package oar
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/loaders"
+)
+
+type options struct {
+	seed    *int64
+	dataDir string
+	types   map[string]conf.UseTypeDTO
+	loaders *loaders.TypeLoaderFactoryContext
+}
+
+type Option func(*options)
+
+// WithSeed makes the generated values the same every time
+func WithSeed(seed int64) Option {
+	return func(o *options) {
+		o.seed = &seed
+	}
+}
+
+// WithDataDir sets the directory of the data/ files the built-in types pick from (default: data)
+func WithDataDir(dir string) Option {
+	return func(o *options) {
+		o.dataDir = dir
+	}
+}
+
+// WithTypes adds types that tags can name, like the types of a configuration file; they take precedence over the
+// built-in types and loaders of the same name
+func WithTypes(types map[string]conf.UseTypeDTO) Option {
+	return func(o *options) {
+		for name, t := range types {
+			o.types[name] = t
+		}
+	}
+}
+
+// WithLoaders generates values with the loaders registered in ctx instead of the default ones
+func WithLoaders(ctx *loaders.TypeLoaderFactoryContext) Option {
+	return func(o *options) {
+		o.loaders = ctx
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{dataDir: "data", types: make(map[string]conf.UseTypeDTO)}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.loaders == nil {
+		o.loaders = core.NewTypeLoaderFactoryContext()
+	}
+
+	return o
+}
+
+// Generate returns n values of T, a struct type, with their fields filled in
+func Generate[T any](n int, opts ...Option) ([]T, error) {
+	o := newOptions(opts)
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	config, plans, err := configurationFor(t, n, o)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := core.GenerateResultsWithTypeLoaderContext(config, o.loaders)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*fieldPlan, len(plans))
+	for _, plan := range plans {
+		byName[plan.name] = plan
+	}
+
+	values := make([]T, n)
+	for i, row := range results.Rows {
+		target := reflect.ValueOf(&values[i]).Elem()
+
+		for _, entry := range row.Values {
+			plan, ok := byName[entry.Name]
+			if !ok {
+				continue
+			}
+
+			if err := assign(target.FieldByIndex(plan.index), entry.Value, entry.Null); err != nil {
+				return nil, fmt.Errorf("Failed to assign field '%s' in row %d: %s", plan.goName, row.Index, err)
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// Configuration returns the configuration Generate derives from T's fields, e.g. to save it as a file
+func Configuration[T any](n int, opts ...Option) (*conf.Configuration, error) {
+	config, _, err := configurationFor(reflect.TypeOf((*T)(nil)).Elem(), n, newOptions(opts))
+	return config, err
+}
+
+// fieldPlan is where the values of a configuration field go in the struct
+type fieldPlan struct {
+	name   string
+	goName string
+	index  []int
+}
+
+func configurationFor(t reflect.Type, n int, o *options) (*conf.Configuration, []*fieldPlan, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("Expected a struct type, got '%s'", t)
+	}
+
+	if n < 0 {
+		return nil, nil, fmt.Errorf("Number of rows can't be negative (got %d)", n)
+	}
+
+	config := conf.NewConfiguration()
+	config.Name = t.Name()
+	config.OutputType = conf.JSON
+	config.NumRows = n
+	config.Types = make(map[string]conf.UseTypeDTO)
+
+	// every type passed is added, since types can name others in their args, like array's type
+	for name, t := range o.types {
+		config.Types[name] = t
+	}
+
+	if o.seed != nil {
+		config.Options[conf.SeedOption] = fmt.Sprint(*o.seed)
+	}
+
+	plans := make([]*fieldPlan, 0)
+	if err := addFields(config, t, nil, o, &plans); err != nil {
+		return nil, nil, err
+	}
+
+	return config, plans, nil
+}
+
+func addFields(config *conf.Configuration, t reflect.Type, index []int, o *options, plans *[]*fieldPlan) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		raw, tagged := sf.Tag.Lookup("oar")
+		if raw == "-" {
+			continue
+		}
+
+		// fields of embedded structs are filled in as if they were the outer struct's
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct && !tagged {
+			if err := addFields(config, sf.Type, fieldIndex, o, plans); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag, err := parseTag(raw)
+		if err != nil {
+			return fmt.Errorf("Field '%s' has an invalid oar tag: %s", sf.Name, err)
+		}
+
+		name := sf.Name
+		if tag.name != "" {
+			name = tag.name
+		}
+
+		for _, plan := range *plans {
+			if plan.name == name {
+				return fmt.Errorf("Fields '%s' and '%s' are both named '%s'", plan.goName, sf.Name, name)
+			}
+		}
+
+		typeName, err := addType(config, sf.Type, tag.typeName, o)
+		if err != nil {
+			return fmt.Errorf("Field '%s': %s", sf.Name, err)
+		}
+
+		if tag.nullRate < 0 || tag.nullRate > 1 {
+			return fmt.Errorf("Field '%s' has a nullrate of %v; expected a value between 0 and 1", sf.Name, tag.nullRate)
+		}
+
+		config.Fields = append(config.Fields, &conf.ConfigurationField{
+			Name:     name,
+			Type:     typeName,
+			Args:     tag.args,
+			Unique:   tag.unique,
+			NullRate: tag.nullRate,
+			Kind:     kindOf(sf.Type),
+		})
+
+		*plans = append(*plans, &fieldPlan{name: name, goName: sf.Name, index: fieldIndex})
+	}
+
+	return nil
+}
+
+// addType adds the type the tag names, or the default type for t, to the configuration and returns its name
+func addType(config *conf.Configuration, t reflect.Type, name string, o *options) (string, error) {
+	if name == "" {
+		name, dto, err := defaultType(t)
+		if err != nil {
+			return "", err
+		}
+
+		config.Types[name] = dto
+		return name, nil
+	}
+
+	// including types passed with WithTypes
+	if _, ok := config.Types[name]; ok {
+		return name, nil
+	}
+
+	if t, ok := core.BuiltinTypes()[name]; ok {
+		config.Types[name] = t.UseType(o.dataDir)
+		return name, nil
+	}
+
+	if _, ok := (*o.loaders)[name]; ok {
+		config.Types[name] = loaderType(name, nil)
+		return name, nil
+	}
+
+	return "", fmt.Errorf("Unknown type '%s'; expected a type passed with WithTypes, a built-in type or one of the loaders: %v", name, o.loaders.LoaderNames())
+}
+
+func loaderType(name string, args map[string]interface{}) conf.UseTypeDTO {
+	return conf.UseTypeDTO{LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: name, Args: args}}
+}
@@ -0,0 +1,158 @@
+package oar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+)
+
+var testTypes = map[string]conf.UseTypeDTO{
+	"word": {LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "text", Args: map[string]interface{}{"charset": "lower"}}},
+	"tag":  {Extends: "word", LoaderArgs: conf.UseTypeLoaderArgsDTO{Args: map[string]interface{}{"prefix": "#"}}},
+	"tags": {LoaderArgs: conf.UseTypeLoaderArgsDTO{Name: "array", Args: map[string]interface{}{"type": "tag", "minitems": 1}}},
+}
+
+type address struct {
+	City  string `oar:"type=city"`
+	State string `oar:"type=state"`
+}
+
+type user struct {
+	address
+
+	ID      int     `oar:"type=autoincrement"`
+	Email   string  `oar:"type=email,unique"`
+	Age     int8    `oar:"type=number,min=18,max=90"`
+	Status  string  `oar:"type=choice,values=[\"active\", \"banned\"]"`
+	Score   float64 `oar:"type=number,max=10,decimals=1"`
+	Bio     *string `oar:"nullrate=0.5"`
+	Admin   bool
+	Tags    []string  `oar:"type=tags,maxitems=3"`
+	Created time.Time `oar:"type=datetime,name=created_at,min=2020-01-01,max=2021-01-01,format=date"`
+	Notes   string    `oar:"-"`
+
+	internal string
+}
+
+func TestGenerateFillsStructs(t *testing.T) {
+	users, err := Generate[user](200, WithSeed(7), WithDataDir("../../data"), WithTypes(testTypes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(users) != 200 {
+		t.Fatalf("Expected 200 users, got %d", len(users))
+	}
+
+	emails := make(map[string]bool)
+	nulls, places := 0, 0
+	for i, u := range users {
+		if u.ID != i+1 || u.Age < 18 || u.Age > 90 || u.Score < 0 || u.Score > 10 {
+			t.Errorf("Expected the user's numbers to fit their tags, got %+v", u)
+		}
+
+		if u.Status != "active" && u.Status != "banned" || len(u.State) > 2 {
+			t.Errorf("Expected the user's text to fit their tags, got %+v", u)
+		}
+
+		if !strings.HasSuffix(u.Email, "@example.com") || emails[u.Email] {
+			t.Errorf("Expected a unique email, got '%s'", u.Email)
+		}
+
+		if len(u.Tags) < 1 || len(u.Tags) > 3 || !strings.HasPrefix(u.Tags[0], "#") || u.Created.Year() != 2020 || u.Notes != "" {
+			t.Errorf("Expected tags, a time in 2020 and no notes, got %+v", u)
+		}
+
+		emails[u.Email] = true
+		if u.City != "" && u.State != "" {
+			places++
+		}
+
+		if u.Bio == nil {
+			nulls++
+		}
+	}
+
+	if places < 150 {
+		t.Errorf("Expected the embedded address to be filled in, got %d cities and states", places)
+	}
+
+	if nulls < 50 || nulls > 150 {
+		t.Errorf("Expected about half of the bios to be nil, got %d", nulls)
+	}
+
+	again, err := Generate[user](200, WithSeed(7), WithDataDir("../../data"), WithTypes(testTypes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(users, again) {
+		t.Errorf("Expected the same seed to generate the same users")
+	}
+}
+
+func TestConfigurationFromTags(t *testing.T) {
+	config, err := Configuration[user](10, WithDataDir("data"), WithTypes(testTypes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(config.Fields))
+	for i, field := range config.Fields {
+		names[i] = field.Name
+	}
+
+	expected := "City State ID Email Age Status Score Bio Admin Tags created_at"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("Expected fields '%s', got '%s'", expected, strings.Join(names, " "))
+	}
+
+	if email := config.Fields[3]; !email.Unique || email.Type != "email" || config.Types["email"].LoaderArgs.Name != "text" {
+		t.Errorf("Expected a unique field of the built-in email type, got %+v", email)
+	}
+
+	if age := config.Fields[4]; age.Kind != "integer" || age.Args["max"].(interface{ String() string }).String() != "90" {
+		t.Errorf("Expected an integer field with the tag's args, got %+v", age)
+	}
+}
+
+func TestGenerateRejectsBadStructs(t *testing.T) {
+	type unknownType struct {
+		Name string `oar:"type=nope"`
+	}
+
+	type noDefault struct {
+		Channel chan int
+	}
+
+	type badTag struct {
+		Name string `oar:"type=text,required"`
+	}
+
+	type overflows struct {
+		Small int8 `oar:"type=number,min=1000,max=2000"`
+	}
+
+	if _, err := Generate[unknownType](1); err == nil || !strings.Contains(err.Error(), "Unknown type 'nope'") {
+		t.Errorf("Expected an unknown type to be reported, got %v", err)
+	}
+
+	if _, err := Generate[noDefault](1); err == nil || !strings.Contains(err.Error(), "No default type") {
+		t.Errorf("Expected a field without a default type to be reported, got %v", err)
+	}
+
+	if _, err := Generate[badTag](1); err == nil || !strings.Contains(err.Error(), "invalid oar tag") {
+		t.Errorf("Expected a bad tag to be reported, got %v", err)
+	}
+
+	if _, err := Generate[overflows](1); err == nil || !strings.Contains(err.Error(), "fits in int8") {
+		t.Errorf("Expected a value too large for its field to be reported, got %v", err)
+	}
+
+	if _, err := Generate[int](1); err == nil {
+		t.Errorf("Expected a type that isn't a struct to be rejected")
+	}
+}
@@ -1,40 +1,195 @@
 package output
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 
 	"io"
 
+	conf "github.com/elauffenburger/oar/core/configuration"
 	res "github.com/elauffenburger/oar/core/results"
 )
 
 type OutputFormatter interface {
 	Format(results *res.Results) string
 	FormatToStream(results *res.Results, stream io.Writer)
+	NewEncoder(stream io.Writer) RowEncoder
+}
+
+// RowEncoder writes rows to a stream one at a time as they're generated; Close finishes the output
+// (e.g. closes a json array) but doesn't close the stream
+type RowEncoder interface {
+	Encode(row *res.ResultsRow) error
+	Close() error
+}
+
+func formatWithEncoder(formatter OutputFormatter, results *res.Results, stream io.Writer) error {
+	encoder := formatter.NewEncoder(stream)
+
+	for _, row := range results.Rows {
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
+
+// FormatToStreamWithContext writes results to stream like the formatter's FormatToStream until ctx is done, when it
+// returns ctx.Err(). Output stopped early is finished, so it's valid with the rows written so far, or with
+// DiscardPartialOutput, held back so nothing is written.
+func FormatToStreamWithContext(ctx context.Context, formatter OutputFormatter, results *res.Results, stream io.Writer, partial conf.PartialOutput) error {
+	var held bytes.Buffer
+
+	out := stream
+	if partial == conf.DiscardPartialOutput {
+		out = &held
+	}
+
+	encoder := formatter.NewEncoder(out)
+	for _, row := range results.Rows {
+		if err := ctx.Err(); err != nil {
+			if partial != conf.DiscardPartialOutput {
+				encoder.Close()
+			}
+
+			return err
+		}
+
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	if partial == conf.DiscardPartialOutput {
+		_, err := held.WriteTo(stream)
+		return err
+	}
+
+	return nil
+}
+
+func formatToString(formatter OutputFormatter, results *res.Results) string {
+	var buf bytes.Buffer
+
+	if err := formatWithEncoder(formatter, results, &buf); err != nil {
+		panic(fmt.Sprintf("Error formatting results: '%s'", err))
+	}
+
+	return buf.String()
 }
 
 type JsonOutputFormatter struct {
+	Pretty bool
 }
 
 func (formatter *JsonOutputFormatter) Format(results *res.Results) string {
-	jsonArray := formatter.ToJsonArray(results)
-	marshalledbytes, err := json.Marshal(&jsonArray)
+	return formatToString(formatter, results)
+}
+
+func (formatter *JsonOutputFormatter) FormatToStream(results *res.Results, stream io.Writer) {
+	formatWithEncoder(formatter, results, stream)
+}
+
+func (formatter *JsonOutputFormatter) NewEncoder(stream io.Writer) RowEncoder {
+	return &jsonRowEncoder{stream: stream, pretty: formatter.Pretty}
+}
+
+type jsonRowEncoder struct {
+	stream io.Writer
+	pretty bool
+	count  int
+}
+
+func (encoder *jsonRowEncoder) Encode(row *res.ResultsRow) error {
+	object := ToJsonObject(row)
+
+	var marshalledbytes []byte
+	var err error
+	if encoder.pretty {
+		marshalledbytes, err = json.MarshalIndent(object, "  ", "  ")
+	} else {
+		marshalledbytes, err = json.Marshal(object)
+	}
+
 	if err != nil {
-		panic(fmt.Sprintf("Error marshalling results: '%s", err))
+		return fmt.Errorf("Error marshalling results: '%s'", err)
+	}
+
+	prefix := ","
+	if encoder.count == 0 {
+		prefix = "["
+	}
+
+	if encoder.pretty {
+		prefix += "\n  "
 	}
 
-	return string(marshalledbytes)
+	encoder.count++
+
+	if _, err := io.WriteString(encoder.stream, prefix); err != nil {
+		return err
+	}
+
+	_, err = encoder.stream.Write(marshalledbytes)
+	return err
 }
 
-func (formatter *JsonOutputFormatter) FormatToStream(results *res.Results, stream io.Writer) {
-	bytes := []byte(formatter.Format(results))
+func (encoder *jsonRowEncoder) Close() error {
+	suffix := "]"
+
+	switch {
+	case encoder.count == 0:
+		suffix = "[]"
+	case encoder.pretty:
+		suffix = "\n]"
+	}
+
+	_, err := io.WriteString(encoder.stream, suffix)
+	return err
+}
+
+// NdjsonOutputFormatter writes each row as a json object on its own line
+type NdjsonOutputFormatter struct{}
+
+func (formatter *NdjsonOutputFormatter) Format(results *res.Results) string {
+	return formatToString(formatter, results)
+}
 
-	stream.Write(bytes)
+func (formatter *NdjsonOutputFormatter) FormatToStream(results *res.Results, stream io.Writer) {
+	formatWithEncoder(formatter, results, stream)
 }
 
-type JsonObject map[string]string
+func (formatter *NdjsonOutputFormatter) NewEncoder(stream io.Writer) RowEncoder {
+	return &ndjsonRowEncoder{stream: stream}
+}
+
+type ndjsonRowEncoder struct {
+	stream io.Writer
+}
+
+func (encoder *ndjsonRowEncoder) Encode(row *res.ResultsRow) error {
+	marshalledbytes, err := json.Marshal(ToJsonObject(row))
+	if err != nil {
+		return fmt.Errorf("Error marshalling results: '%s'", err)
+	}
+
+	_, err = encoder.stream.Write(append(marshalledbytes, '\n'))
+	return err
+}
+
+func (encoder *ndjsonRowEncoder) Close() error {
+	return nil
+}
+
+type JsonObject map[string]interface{}
 type JsonArray []*JsonObject
 
 func (obj JsonObject) Keys() []string {
@@ -50,16 +205,21 @@ func (obj JsonObject) Keys() []string {
 	return keys
 }
 
+func ToJsonObject(set *res.ResultsRow) JsonObject {
+	object := make(JsonObject)
+
+	for _, entry := range set.Values {
+		object[entry.Name] = entry.JSONValue()
+	}
+
+	return object
+}
+
 func (formatter *JsonOutputFormatter) ToJsonArray(results *res.Results) JsonArray {
 	result := make(JsonArray, results.NumRows())
 
 	for i, set := range results.Rows {
-		object := make(JsonObject)
-
-		for _, entry := range set.Values {
-			object[entry.Name] = entry.Value
-		}
-
+		object := ToJsonObject(set)
 		result[i] = &object
 	}
 
@@ -70,86 +230,136 @@ const maxLinesPerSqlStmt = 1000
 
 type SqlOutputFormatter struct {
 	TableName string
+
+	// max number of rows per insert statement
+	BatchSize int
 }
 
 func (formatter *SqlOutputFormatter) Format(results *res.Results) string {
-	out := ""
+	return formatToString(formatter, results)
+}
+
+func (formatter *SqlOutputFormatter) FormatToStream(results *res.Results, stream io.Writer) {
+	formatWithEncoder(formatter, results, stream)
+}
+
+func (formatter *SqlOutputFormatter) NewEncoder(stream io.Writer) RowEncoder {
+	batchSize := formatter.BatchSize
+	if batchSize < 1 {
+		batchSize = maxLinesPerSqlStmt
+	}
+
+	return &sqlRowEncoder{formatter: formatter, stream: stream, batchSize: batchSize}
+}
 
-	formatter.formatInternal(results, func(str *string) {
-		out += *str
-	})
+// ColumnNames returns the names of the columns rows shaped like row are inserted into
+func (formatter *SqlOutputFormatter) ColumnNames(row *res.ResultsRow) []string {
+	names := make([]string, len(row.Values))
+	for i, val := range row.Values {
+		names[i] = val.Name
+	}
 
-	return out
+	return names
 }
 
-func (formatter *SqlOutputFormatter) formatInternal(results *res.Results, writeFn func(str *string)) {
-	if len(results.Rows) == 0 {
-		return
+// ColumnValues returns the values of row in column order, with nil for nulls
+func (formatter *SqlOutputFormatter) ColumnValues(row *res.ResultsRow) []interface{} {
+	values := make([]interface{}, len(row.Values))
+	for i, val := range row.Values {
+		if !val.Null {
+			values[i] = val.Value
+		}
 	}
 
+	return values
+}
+
+// InsertHeader returns the "insert into table (...) values" statement for rows shaped like row
+func (formatter *SqlOutputFormatter) InsertHeader(row *res.ResultsRow) string {
 	// generate initial "insert into dbo.foobar(...) values" stmt
 	insertHeaderStr := fmt.Sprintf("insert into %s (", formatter.TableName)
-	{
-		row := results.Rows[0]
-		for i, val := range row.Values {
-			insertHeaderStr += fmt.Sprintf("[%s]", val.Name)
 
-			if i != len(row.Values)-1 {
-				insertHeaderStr += ","
-			}
+	columns := formatter.ColumnNames(row)
+	for i, name := range columns {
+		insertHeaderStr += fmt.Sprintf("[%s]", name)
+
+		if i != len(columns)-1 {
+			insertHeaderStr += ","
 		}
 	}
 
 	insertHeaderStr += ") values \n"
-	writeFn(&insertHeaderStr)
-
-	// generate subsequent "(...)" stmts and start new "insert..." stmts as necessary
-	n := len(results.Rows)
-	for i, row := range results.Rows {
+	return insertHeaderStr
+}
 
-		// Generate (...) stmt for this row
-		rowstr := "("
-		for i, val := range row.Values {
+// FormatRowValues returns the "(...)" tuple of values for row
+func (formatter *SqlOutputFormatter) FormatRowValues(row *res.ResultsRow) string {
+	rowstr := "("
+	for i, val := range row.Values {
+		if val.Null {
+			rowstr += "NULL"
+		} else {
 			// escape 's in values
 			value := strings.Replace(val.Value, "'", "''", -1)
 
 			rowstr += fmt.Sprintf("'%s'", value)
+		}
 
-			if i != len(row.Values)-1 {
-				rowstr += ","
-			}
+		if i != len(row.Values)-1 {
+			rowstr += ","
 		}
-		rowstr += ")"
+	}
+	rowstr += ")"
 
-		// if we're writing the max allowed insert statement (1000), end the current stmt
-		if (i+1)%maxLinesPerSqlStmt == 0 {
-			rowstr += ";\n"
+	return rowstr
+}
 
-			// if we're not writing the last line, start a new insert stmt
-			if i != n-1 {
-				rowstr += insertHeaderStr
-			}
-		} else {
-			// otherwise...
+type sqlRowEncoder struct {
+	formatter *SqlOutputFormatter
+	stream    io.Writer
+	batchSize int
 
-			// if we're not writing the last line, add a comma separator
-			if i != n-1 {
-				rowstr += ",\n"
-			}
-		}
+	header string
+
+	// number of rows in the insert statement that's currently open
+	rowsInStmt int
+}
+
+func (encoder *sqlRowEncoder) Encode(row *res.ResultsRow) error {
+	if len(encoder.header) == 0 {
+		encoder.header = encoder.formatter.InsertHeader(row)
+	}
 
-		writeFn(&rowstr)
+	// start a new "insert..." stmt or separate this row from the last one
+	prefix := ",\n"
+	if encoder.rowsInStmt == 0 {
+		prefix = encoder.header
 	}
+
+	rowstr := prefix + encoder.formatter.FormatRowValues(row)
+	encoder.rowsInStmt++
+
+	// if we're writing the max allowed insert statement, end the current stmt
+	if encoder.rowsInStmt == encoder.batchSize {
+		rowstr += ";\n"
+		encoder.rowsInStmt = 0
+	}
+
+	_, err := io.WriteString(encoder.stream, rowstr)
+	return err
 }
 
-func (formatter *SqlOutputFormatter) FormatToStream(results *res.Results, stream io.Writer) {
-	formatter.formatInternal(results, func(str *string) {
-		bytes := []byte(*str)
+func (encoder *sqlRowEncoder) Close() error {
+	if encoder.rowsInStmt == 0 {
+		return nil
+	}
+
+	encoder.rowsInStmt = 0
 
-		stream.Write(bytes)
-	})
+	_, err := io.WriteString(encoder.stream, ";\n")
+	return err
 }
 
 func NewSqlOutputFormatter(tablename string) *SqlOutputFormatter {
-	return &SqlOutputFormatter{TableName: tablename}
+	return &SqlOutputFormatter{TableName: tablename, BatchSize: maxLinesPerSqlStmt}
 }
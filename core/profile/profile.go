@@ -0,0 +1,446 @@
+// Package profile summarizes the values in a dataset's columns: their types, how often they're null, how many
+// distinct values they have and how those values are distributed.
+package profile
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// most distinct values a column keeps counts of; past it, Distinct is a lower bound
+const maxTrackedValues = 10000
+
+// most distinct characters a column keeps
+const maxTrackedChars = 128
+
+// most numbers a column keeps to estimate their distribution
+const maxSampledNumbers = 10000
+
+type Profile struct {
+	Rows    int
+	Columns []*Column
+
+	// whether strings were written as strings (like in json), so "42" is text rather than a number
+	TypedStrings bool
+
+	byName map[string]*Column
+}
+
+func New() *Profile {
+	return &Profile{Columns: make([]*Column, 0), byName: make(map[string]*Column)}
+}
+
+// Column returns the column with the given name, adding it if it hasn't been seen yet
+func (p *Profile) Column(name string) *Column {
+	if column, ok := p.byName[name]; ok {
+		return column
+	}
+
+	column := newColumn(name)
+	column.Nulls = p.Rows
+
+	p.Columns = append(p.Columns, column)
+	p.byName[name] = column
+
+	return column
+}
+
+// AddRow adds a row's values; columns the row doesn't have count as null
+func (p *Profile) AddRow(names []string, values []interface{}) {
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		p.Column(name).add(values[i], p.TypedStrings)
+		seen[name] = true
+	}
+
+	for _, column := range p.Columns {
+		if !seen[column.Name] {
+			column.Nulls++
+		}
+	}
+
+	p.Rows++
+}
+
+type Kind string
+
+const (
+	StringKind  Kind = "string"
+	IntegerKind Kind = "integer"
+	NumberKind  Kind = "number"
+	BooleanKind Kind = "boolean"
+	TimeKind    Kind = "time"
+	JSONKind    Kind = "json"
+)
+
+type Column struct {
+	Name string
+
+	// values that were present, and that were null or missing
+	Count int
+	Nulls int
+
+	// for numbers
+	Min, Max, Sum float64
+	Decimals      int
+
+	// for times
+	MinTime, MaxTime time.Time
+
+	// in characters
+	MinLength, MaxLength int
+	Lengths              map[int]int
+
+	// values that look like a well-known format, like "email" or "uuid"
+	Formats map[string]int
+
+	// for emails, in characters before the "@"
+	MinLocalLength, MaxLocalLength int
+
+	chars map[rune]bool
+
+	values    map[string]int
+	saturated bool
+
+	// how many values could be each kind
+	integers, numbers, booleans, jsons, texts int
+	layouts                                   []string
+
+	sample []float64
+	rand   *rand.Rand
+
+	shapes *shapes
+}
+
+func newColumn(name string) *Column {
+	return &Column{
+		Name:    name,
+		Lengths: make(map[int]int),
+		Formats: make(map[string]int),
+		chars:   make(map[rune]bool),
+		values:  make(map[string]int),
+		layouts: append([]string{}, timeLayouts...),
+		rand:    rand.New(rand.NewSource(1)),
+		shapes:  newShapes(),
+	}
+}
+
+// layouts times are recognized in, most specific first
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", "15:04:05", "01/02/2006"}
+
+var formatPatterns = map[string]*regexp.Regexp{
+	"uuid":  regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`),
+	"email": regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`),
+}
+
+// add adds a value: nil, a string, a bool, a json.Number, a float64, or anything else json can encode
+func (column *Column) add(value interface{}, typedStrings bool) {
+	var text string
+
+	switch v := value.(type) {
+	case nil:
+		column.Nulls++
+		return
+
+	case string:
+		// csv and friends can't tell an empty value from a missing one
+		if v == "" && !typedStrings {
+			column.Nulls++
+			return
+		}
+
+		text = v
+		if typedStrings {
+			column.texts++
+		} else {
+			column.addText(v)
+		}
+
+	case bool:
+		text = strconv.FormatBool(v)
+		column.booleans++
+
+	case json.Number:
+		text = v.String()
+		column.addNumber(text)
+
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+		column.addNumber(text)
+
+	default:
+		content, _ := json.Marshal(v)
+		text = string(content)
+		column.jsons++
+	}
+
+	column.Count++
+	column.addTime(text)
+	column.addValue(text)
+}
+
+// addText works out which kinds an untyped value could be
+func (column *Column) addText(text string) {
+	switch strings.ToLower(text) {
+	case "true", "false":
+		column.booleans++
+		return
+	}
+
+	if !column.addNumber(text) {
+		column.texts++
+	}
+}
+
+func (column *Column) addNumber(text string) bool {
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return false
+	}
+
+	if column.integers+column.numbers == 0 {
+		column.Min, column.Max = n, n
+	}
+
+	column.Min, column.Max = math.Min(column.Min, n), math.Max(column.Max, n)
+	column.Sum += n
+	column.numbers++
+
+	if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+		column.integers++
+	} else if dot := strings.IndexByte(text, '.'); dot >= 0 && !strings.ContainsAny(text, "eE") {
+		if decimals := len(text) - dot - 1; decimals > column.Decimals {
+			column.Decimals = decimals
+		}
+	}
+
+	// reservoir sampling keeps every number equally likely to be in the sample
+	if len(column.sample) < maxSampledNumbers {
+		column.sample = append(column.sample, n)
+	} else if i := column.rand.Intn(column.numbers); i < maxSampledNumbers {
+		column.sample[i] = n
+	}
+
+	return true
+}
+
+// addTime drops the layouts the value doesn't match, and widens the range of times
+func (column *Column) addTime(text string) {
+	if len(column.layouts) == 0 {
+		return
+	}
+
+	layouts := column.layouts[:0]
+	var parsed time.Time
+
+	for _, layout := range column.layouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			if len(layouts) == 0 {
+				parsed = t
+			}
+
+			layouts = append(layouts, layout)
+		}
+	}
+
+	column.layouts = layouts
+	if len(layouts) == 0 {
+		return
+	}
+
+	if column.Count == 1 || parsed.Before(column.MinTime) {
+		column.MinTime = parsed
+	}
+
+	if parsed.After(column.MaxTime) {
+		column.MaxTime = parsed
+	}
+}
+
+func (column *Column) addValue(text string) {
+	length := utf8.RuneCountInString(text)
+	if column.Count == 1 || length < column.MinLength {
+		column.MinLength = length
+	}
+
+	if length > column.MaxLength {
+		column.MaxLength = length
+	}
+
+	column.Lengths[length]++
+
+	for format, pattern := range formatPatterns {
+		if !pattern.MatchString(text) {
+			continue
+		}
+
+		column.Formats[format]++
+		if format == "email" {
+			column.addLocalLength(utf8.RuneCountInString(text[:strings.IndexByte(text, '@')]))
+		}
+	}
+
+	column.shapes.add(text)
+
+	for _, r := range text {
+		if len(column.chars) == maxTrackedChars {
+			break
+		}
+
+		column.chars[r] = true
+	}
+
+	if _, ok := column.values[text]; ok || len(column.values) < maxTrackedValues {
+		column.values[text]++
+	} else {
+		column.saturated = true
+	}
+}
+
+func (column *Column) addLocalLength(length int) {
+	if column.Formats["email"] == 1 || length < column.MinLocalLength {
+		column.MinLocalLength = length
+	}
+
+	if length > column.MaxLocalLength {
+		column.MaxLocalLength = length
+	}
+}
+
+// Kind returns the most specific kind every value fits
+func (column *Column) Kind() Kind {
+	switch {
+	case column.Count == 0:
+		return StringKind
+	case column.integers == column.Count:
+		return IntegerKind
+	case column.numbers == column.Count:
+		return NumberKind
+	case column.booleans == column.Count:
+		return BooleanKind
+	case column.jsons == column.Count:
+		return JSONKind
+	case len(column.layouts) != 0:
+		return TimeKind
+	}
+
+	return StringKind
+}
+
+// TimeLayout returns the layout every value of a time column matched
+func (column *Column) TimeLayout() string {
+	if len(column.layouts) == 0 {
+		return ""
+	}
+
+	return column.layouts[0]
+}
+
+// NullRate returns the fraction of rows the column was null or missing in
+func (column *Column) NullRate() float64 {
+	if column.Count+column.Nulls == 0 {
+		return 0
+	}
+
+	return float64(column.Nulls) / float64(column.Count+column.Nulls)
+}
+
+// Mean returns the mean of a numeric column's values
+func (column *Column) Mean() float64 {
+	if column.numbers == 0 {
+		return 0
+	}
+
+	return column.Sum / float64(column.numbers)
+}
+
+// Distinct returns the number of distinct values, and whether that's exact; columns with very many distinct values
+// stop counting new ones
+func (column *Column) Distinct() (int, bool) {
+	return len(column.values), !column.saturated
+}
+
+// Unique reports whether no value was seen twice
+func (column *Column) Unique() bool {
+	return !column.saturated && len(column.values) == column.Count
+}
+
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Top returns the n most frequent values, most frequent first
+func (column *Column) Top(n int) []ValueCount {
+	counts := make([]ValueCount, 0, len(column.values))
+	for value, count := range column.values {
+		counts = append(counts, ValueCount{Value: value, Count: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+
+		return counts[i].Value < counts[j].Value
+	})
+
+	if n >= 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+
+	return counts
+}
+
+// Histogram splits the range between Min and Max into equal-width buckets and returns roughly how many values fall
+// in each, estimated from a sample of the values
+func (column *Column) Histogram(buckets int) []int {
+	counts := make([]int, buckets)
+	if len(column.sample) == 0 || buckets == 0 {
+		return counts
+	}
+
+	width := (column.Max - column.Min) / float64(buckets)
+	for _, n := range column.sample {
+		i := buckets - 1
+		if width > 0 {
+			i = int((n - column.Min) / width)
+		}
+
+		if i >= buckets {
+			i = buckets - 1
+		}
+
+		counts[i]++
+	}
+
+	return counts
+}
+
+// Pattern returns a regular expression matching nearly all of the column's values by their shape, like
+// `[A-Z]{3}-[0-9]{4}` for "ABC-1234", or false if they don't have a few common shapes
+func (column *Column) Pattern() (string, bool) {
+	return column.shapes.pattern(column.Count)
+}
+
+// Chars returns the distinct characters in the column's values, in order, unless there were very many
+func (column *Column) Chars() (string, bool) {
+	if len(column.chars) == maxTrackedChars {
+		return "", false
+	}
+
+	chars := make([]rune, 0, len(column.chars))
+	for r := range column.chars {
+		chars = append(chars, r)
+	}
+
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+	return string(chars), true
+}
@@ -0,0 +1,144 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+func TestReadCSV(t *testing.T) {
+	p, err := ReadCSV(strings.NewReader("id,code,price,status,joined\n" +
+		"1,AB-12,1.5,active,2020-01-02\n" +
+		"2,CD-345,2.25,,2021-03-04\n" +
+		"3,EF-67,10,active,2019-12-31\n" +
+		"4,GH-89,7,banned,2020-06-30\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Rows != 4 || len(p.Columns) != 5 {
+		t.Fatalf("Expected 4 rows of 5 columns, got %d rows of %d", p.Rows, len(p.Columns))
+	}
+
+	expected := []Kind{IntegerKind, StringKind, NumberKind, StringKind, TimeKind}
+	for i, column := range p.Columns {
+		if kind := column.Kind(); kind != expected[i] {
+			t.Errorf("Expected %s to be %s, got %s", column.Name, expected[i], kind)
+		}
+	}
+
+	if pattern, ok := p.Columns[1].Pattern(); !ok || pattern != "[A-Z]{2}-[0-9]{2,3}" {
+		t.Errorf("Expected codes to have the pattern [A-Z]{2}-[0-9]{2,3}, got '%s'", pattern)
+	}
+
+	price := p.Columns[2]
+	if price.Min != 1.5 || price.Max != 10 || price.Decimals != 2 || price.Mean() != 5.1875 {
+		t.Errorf("Expected prices from 1.5 to 10 with 2 decimals and a mean of 5.1875, got %+v", price)
+	}
+
+	status := p.Columns[3]
+	if status.NullRate() != 0.25 {
+		t.Errorf("Expected a quarter of statuses to be null, got %v", status.NullRate())
+	}
+
+	if top := status.Top(1); top[0].Value != "active" || top[0].Count != 2 {
+		t.Errorf("Expected active to be the most frequent status, got %v", top)
+	}
+
+	if joined := p.Columns[4]; joined.TimeLayout() != "2006-01-02" || joined.MinTime.Year() != 2019 || joined.MaxTime.Year() != 2021 {
+		t.Errorf("Expected dates from 2019 to 2021, got %s from %s to %s", joined.TimeLayout(), joined.MinTime, joined.MaxTime)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	for _, content := range []string{
+		`[{"id": 1, "ok": true, "tags": ["a"]}, {"id": 2, "ok": false, "name": "42"}]`,
+		"{\"id\": 1, \"ok\": true, \"tags\": [\"a\"]}\n{\"id\": 2, \"ok\": false, \"name\": \"42\"}\n",
+	} {
+		p, err := ReadJSON(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		kinds := make([]string, len(p.Columns))
+		for i, column := range p.Columns {
+			kinds[i] = column.Name + ":" + string(column.Kind())
+		}
+
+		// json strings stay strings, and columns missing from a row are null in it
+		if actual := strings.Join(kinds, " "); actual != "id:integer ok:boolean tags:json name:string" {
+			t.Errorf("Expected 'id:integer ok:boolean tags:json name:string', got '%s'", actual)
+		}
+
+		if tags, name := p.Columns[2], p.Columns[3]; tags.Nulls != 1 || name.Nulls != 1 {
+			t.Errorf("Expected one null tags and name, got %d and %d", tags.Nulls, name.Nulls)
+		}
+	}
+}
+
+func TestRecorderReportsFields(t *testing.T) {
+	config := conf.NewConfiguration()
+	config.Name = "people"
+	config.Fields = conf.ConfigurationFields{
+		{Name: "id", Unique: true},
+		{Name: "age", Kind: conf.IntegerKind},
+		{Name: "name"},
+	}
+
+	recorder := NewRecorder(config)
+	for i, values := range [][]string{{"1", "30", "ann"}, {"2", "", "bob"}, {"2", "40", "bob"}, {"3", "50", "christopher"}} {
+		row := res.NewResultsRow(i, int64(i))
+		for j, field := range config.Fields {
+			row.Values = append(row.Values, &res.ResultsRowValue{ConfigurationField: *field, Value: values[j], Null: values[j] == ""})
+		}
+
+		recorder.Add(row)
+	}
+
+	report := recorder.Report(1)
+	if report.Rows != 4 || len(report.Fields) != 3 {
+		t.Fatalf("Expected 4 rows of 3 fields, got %d rows of %d", report.Rows, len(report.Fields))
+	}
+
+	id, age, name := report.Fields[0], report.Fields[1], report.Fields[2]
+	if !id.Unique || id.Duplicates != 1 || id.Distinct != 3 || !id.DistinctExact {
+		t.Errorf("Expected 3 distinct ids with 1 duplicate, got %+v", id)
+	}
+
+	if age.Nulls != 1 || age.Count != 3 || *age.Min != 30 || *age.Max != 50 || *age.Mean != 40 {
+		t.Errorf("Expected ages from 30 to 50 with a mean of 40 and 1 null, got %+v", age)
+	}
+
+	if name.Min != nil || len(name.Top) != 1 || name.Top[0].Value != "bob" || name.Top[0].Count != 2 {
+		t.Errorf("Expected bob to be the top name and names to have no min, got %+v", name)
+	}
+
+	expected := []LengthBucket{{Min: 3, Max: 3, Count: 3}, {Min: 11, Max: 11, Count: 1}}
+	if len(name.Lengths) != len(expected) || name.Lengths[0] != expected[0] || name.Lengths[1] != expected[1] {
+		t.Errorf("Expected name lengths %v, got %v", expected, name.Lengths)
+	}
+
+	var b bytes.Buffer
+	if err := report.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Report
+	if err := json.Unmarshal(b.Bytes(), &decoded); err != nil || decoded.Fields[1].Nulls != 1 {
+		t.Errorf("Expected the report to round trip through json, got %v: %s", err, b.String())
+	}
+
+	b.Reset()
+	if err := report.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(b.String(), "| age | integer | 3 | 1 | 3 | 30 | 50 | 40 | - |") {
+		t.Errorf("Expected a table row for ages, got %s", b.String())
+	}
+}
@@ -0,0 +1,34 @@
+package profile
+
+import (
+	"io"
+
+	"github.com/elauffenburger/oar/core/input"
+)
+
+// ReadCSV profiles csv with a header row
+func ReadCSV(r io.Reader) (*Profile, error) {
+	p := New()
+	if err := input.ReadCSV(r, p.addRowFn); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// ReadJSON profiles a json array of objects, or objects one per line (ndjson)
+func ReadJSON(r io.Reader) (*Profile, error) {
+	p := New()
+	p.TypedStrings = true
+
+	if err := input.ReadJSON(r, p.addRowFn); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *Profile) addRowFn(names []string, values []interface{}) error {
+	p.AddRow(names, values)
+	return nil
+}
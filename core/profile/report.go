@@ -0,0 +1,253 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+// most length buckets in a report's histograms; lengths are grouped when there are more
+const maxLengthBuckets = 10
+
+// Recorder profiles a configuration's rows as they're generated, to report what each field ended up holding
+type Recorder struct {
+	config  *conf.Configuration
+	profile *Profile
+
+	// values seen by fields that should be unique, and how many repeated one
+	seen       map[string]map[string]bool
+	duplicates map[string]int
+}
+
+func NewRecorder(config *conf.Configuration) *Recorder {
+	recorder := &Recorder{
+		config:     config,
+		profile:    New(),
+		seen:       make(map[string]map[string]bool),
+		duplicates: make(map[string]int),
+	}
+
+	for _, field := range config.Fields {
+		recorder.profile.Column(field.Name)
+		if field.Unique {
+			recorder.seen[field.Name] = make(map[string]bool)
+		}
+	}
+
+	return recorder
+}
+
+// Add profiles a generated row
+func (recorder *Recorder) Add(row *res.ResultsRow) {
+	p := recorder.profile
+
+	for _, value := range row.Values {
+		column := p.Column(value.Name)
+		if value.IsNull() {
+			column.Nulls++
+			continue
+		}
+
+		switch value.Kind {
+		case conf.BooleanKind, conf.JSONKind, conf.IntegerKind, conf.NumberKind:
+			column.add(value.JSONValue(), true)
+		default:
+			// strings may still be numbers or times, but an empty one isn't a null
+			column.add(value.Value, value.Value == "")
+		}
+
+		if seen, ok := recorder.seen[value.Name]; ok {
+			if seen[value.Value] {
+				recorder.duplicates[value.Name]++
+			}
+
+			seen[value.Value] = true
+		}
+	}
+
+	p.Rows++
+}
+
+// Report summarizes each field of a configuration's generated rows
+type Report struct {
+	Name   string        `json:"name"`
+	Rows   int           `json:"rows"`
+	Fields []FieldReport `json:"fields"`
+}
+
+type FieldReport struct {
+	Name  string `json:"name"`
+	Kind  Kind   `json:"kind"`
+	Count int    `json:"count"`
+	Nulls int    `json:"nulls"`
+
+	// Distinct is a lower bound unless DistinctExact
+	Distinct      int  `json:"distinct"`
+	DistinctExact bool `json:"distinctExact"`
+
+	// for numbers
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+	Mean *float64 `json:"mean,omitempty"`
+
+	Top     []ValueCount   `json:"top"`
+	Lengths []LengthBucket `json:"lengths"`
+
+	// for fields that should be unique, the values that repeated an earlier one
+	Unique     bool `json:"unique"`
+	Duplicates int  `json:"duplicates"`
+}
+
+// LengthBucket is the number of values with lengths from Min to Max characters
+type LengthBucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+// Report returns the report on the rows added so far, with up to top of each field's most frequent values
+func (recorder *Recorder) Report(top int) *Report {
+	report := &Report{Name: recorder.config.Name, Rows: recorder.profile.Rows, Fields: make([]FieldReport, 0)}
+
+	unique := make(map[string]bool)
+	for _, field := range recorder.config.Fields {
+		unique[field.Name] = field.Unique
+	}
+
+	for _, column := range recorder.profile.Columns {
+		distinct, exact := column.Distinct()
+		field := FieldReport{
+			Name:          column.Name,
+			Kind:          column.Kind(),
+			Count:         column.Count,
+			Nulls:         column.Nulls,
+			Distinct:      distinct,
+			DistinctExact: exact,
+			Top:           column.Top(top),
+			Lengths:       lengthBuckets(column),
+			Unique:        unique[column.Name],
+			Duplicates:    recorder.duplicates[column.Name],
+		}
+
+		if field.Kind == IntegerKind || field.Kind == NumberKind {
+			min, max, mean := column.Min, column.Max, column.Mean()
+			field.Min, field.Max, field.Mean = &min, &max, &mean
+		}
+
+		report.Fields = append(report.Fields, field)
+	}
+
+	return report
+}
+
+// lengthBuckets counts values by length, grouping lengths into equal ranges when there are too many to list
+func lengthBuckets(column *Column) []LengthBucket {
+	buckets := make([]LengthBucket, 0)
+	if column.Count == 0 {
+		return buckets
+	}
+
+	width := 1
+	if span := column.MaxLength - column.MinLength + 1; span > maxLengthBuckets {
+		width = (span + maxLengthBuckets - 1) / maxLengthBuckets
+	}
+
+	lengths := make([]int, 0, len(column.Lengths))
+	for length := range column.Lengths {
+		lengths = append(lengths, length)
+	}
+
+	sort.Ints(lengths)
+
+	for _, length := range lengths {
+		min := column.MinLength + (length-column.MinLength)/width*width
+		if n := len(buckets); n == 0 || buckets[n-1].Min != min {
+			buckets = append(buckets, LengthBucket{Min: min, Max: min + width - 1})
+		}
+
+		buckets[len(buckets)-1].Count += column.Lengths[length]
+	}
+
+	return buckets
+}
+
+func (report *Report) WriteJSON(w io.Writer) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(content, '\n'))
+	return err
+}
+
+// WriteMarkdown writes a table of the fields, then each field's top values and lengths
+func (report *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Profile of %s\n\n%d rows.\n\n", markdownText(report.Name), report.Rows)
+	b.WriteString("| Field | Kind | Values | Nulls | Distinct | Min | Max | Mean | Duplicates |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- | --- | --- | --- |\n")
+
+	for _, field := range report.Fields {
+		distinct := strconv.Itoa(field.Distinct)
+		if !field.DistinctExact {
+			distinct = "≥ " + distinct
+		}
+
+		duplicates := "-"
+		if field.Unique {
+			duplicates = strconv.Itoa(field.Duplicates)
+		}
+
+		fmt.Fprintf(&b, "| %s | %s | %d | %d | %s | %s | %s | %s | %s |\n", markdownText(field.Name), field.Kind, field.Count, field.Nulls, distinct,
+			markdownNumber(field.Min), markdownNumber(field.Max), markdownNumber(field.Mean), duplicates)
+	}
+
+	for _, field := range report.Fields {
+		fmt.Fprintf(&b, "\n## %s\n", markdownText(field.Name))
+
+		if len(field.Top) != 0 {
+			b.WriteString("\n| Value | Count |\n| --- | --- |\n")
+			for _, value := range field.Top {
+				fmt.Fprintf(&b, "| %s | %d |\n", markdownText(value.Value), value.Count)
+			}
+		}
+
+		if len(field.Lengths) != 0 {
+			b.WriteString("\n| Length | Count |\n| --- | --- |\n")
+			for _, bucket := range field.Lengths {
+				length := strconv.Itoa(bucket.Min)
+				if bucket.Max != bucket.Min {
+					length += "-" + strconv.Itoa(bucket.Max)
+				}
+
+				fmt.Fprintf(&b, "| %s | %d |\n", length, bucket.Count)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownText escapes text for a table cell or heading
+func markdownText(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ", "\r", " ", "`", "\\`").Replace(text)
+}
+
+// markdownNumber writes numbers, like means, to at most 4 decimal places
+func markdownNumber(n *float64) string {
+	if n == nil {
+		return "-"
+	}
+
+	return strconv.FormatFloat(math.Round(*n*1e4)/1e4, 'f', -1, 64)
+}
@@ -0,0 +1,167 @@
+package profile
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// most distinct shapes a column keeps; values with too many shapes have no pattern
+const maxShapes = 200
+
+// at most this many shapes may make up a pattern, and they must cover this fraction of the values
+const (
+	maxPatternShapes   = 4
+	minPatternCoverage = 0.95
+)
+
+// a run of characters of the same class, like the "ABC" in "ABC-1234"; other characters are literals
+type shapeToken struct {
+	class    rune
+	min, max int
+}
+
+// a shape is a sequence of tokens; values with the same sequence but different run lengths share a shape
+type shape struct {
+	tokens []shapeToken
+	count  int
+}
+
+type shapes struct {
+	byKey    map[string]*shape
+	overflow bool
+}
+
+func newShapes() *shapes {
+	return &shapes{byKey: make(map[string]*shape)}
+}
+
+// classOf returns 'd', 'l' or 'u' for ascii digits and letters, or the character itself
+func classOf(r rune) rune {
+	switch {
+	case r >= '0' && r <= '9':
+		return 'd'
+	case r >= 'a' && r <= 'z':
+		return 'l'
+	case r >= 'A' && r <= 'Z':
+		return 'u'
+	}
+
+	return r
+}
+
+var tokenClasses = map[rune]string{'d': "[0-9]", 'l': "[a-z]", 'u': "[A-Z]"}
+
+func (s *shapes) add(value string) {
+	if s.overflow {
+		return
+	}
+
+	tokens := make([]shapeToken, 0)
+	for _, r := range value {
+		class := classOf(r)
+
+		if n := len(tokens); n != 0 && tokens[n-1].class == class {
+			tokens[n-1].min++
+			tokens[n-1].max++
+			continue
+		}
+
+		tokens = append(tokens, shapeToken{class: class, min: 1, max: 1})
+	}
+
+	var key strings.Builder
+	for _, token := range tokens {
+		key.WriteRune(token.class)
+	}
+
+	existing, ok := s.byKey[key.String()]
+	if !ok {
+		if len(s.byKey) == maxShapes {
+			s.overflow = true
+			s.byKey = nil
+			return
+		}
+
+		s.byKey[key.String()] = &shape{tokens: tokens, count: 1}
+		return
+	}
+
+	existing.count++
+	for i, token := range tokens {
+		if token.min < existing.tokens[i].min {
+			existing.tokens[i].min = token.min
+		}
+
+		if token.max > existing.tokens[i].max {
+			existing.tokens[i].max = token.max
+		}
+	}
+}
+
+func (s *shapes) pattern(count int) (string, bool) {
+	if s.overflow || count == 0 {
+		return "", false
+	}
+
+	sorted := make([]*shape, 0, len(s.byKey))
+	for _, shape := range s.byKey {
+		sorted = append(sorted, shape)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+
+		return sorted[i].regex() < sorted[j].regex()
+	})
+
+	covered := 0
+	alternatives := make([]string, 0)
+
+	for _, shape := range sorted {
+		if len(alternatives) == maxPatternShapes {
+			break
+		}
+
+		covered += shape.count
+		alternatives = append(alternatives, shape.regex())
+
+		if float64(covered) >= minPatternCoverage*float64(count) {
+			if len(alternatives) == 1 {
+				return alternatives[0], true
+			}
+
+			return "(" + strings.Join(alternatives, "|") + ")", true
+		}
+	}
+
+	return "", false
+}
+
+func (shape *shape) regex() string {
+	var builder strings.Builder
+
+	for _, token := range shape.tokens {
+		if class, ok := tokenClasses[token.class]; ok {
+			builder.WriteString(class)
+		} else if unicode.IsSpace(token.class) && token.class != ' ' {
+			builder.WriteString(fmt.Sprintf(`\x{%x}`, token.class))
+		} else {
+			builder.WriteString(regexp.QuoteMeta(string(token.class)))
+		}
+
+		switch {
+		case token.min == 1 && token.max == 1:
+		case token.min == token.max:
+			builder.WriteString(fmt.Sprintf("{%d}", token.min))
+		default:
+			builder.WriteString(fmt.Sprintf("{%d,%d}", token.min, token.max))
+		}
+	}
+
+	return builder.String()
+}
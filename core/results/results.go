@@ -1,8 +1,13 @@
 package results
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"math/rand"
+	"strconv"
 
+	"github.com/elauffenburger/oar/core/common"
 	conf "github.com/elauffenburger/oar/core/configuration"
 )
 
@@ -14,11 +19,102 @@ type Results struct {
 type ResultRowValueList []*ResultsRowValue
 type ResultsRow struct {
 	Values ResultRowValueList
+
+	// position of the row in the results and the source of randomness for its values
+	Index int
+	Rand  *rand.Rand
+
+	// the run generating the row
+	Run *Run
+}
+
+// Run describes a run generating a configuration's rows to the loaders generating them
+type Run struct {
+	// done when the run is stopped early, so loaders waiting on something can give up
+	Context context.Context
+
+	// name of the configuration, which is the table rows are inserted into by sql output
+	Table   string
+	Seed    int64
+	NumRows int
+}
+
+// NewRun returns a run of the configuration with the given seed
+func NewRun(ctx context.Context, config *conf.Configuration, seed int64) *Run {
+	return &Run{Context: ctx, Table: config.Name, Seed: seed, NumRows: config.NumRows}
 }
 
 type ResultsRowValue struct {
 	conf.ConfigurationField
 	Value string
+	Null  bool
+
+	// whether the value was generated as a null, which is still true when nulls are written as empty values
+	generatedNull bool
+}
+
+// SetNull makes the value a null, written as a null or as an empty value according to nulls
+func (value *ResultsRowValue) SetNull(nulls conf.NullHandling) {
+	value.Value, value.Null, value.generatedNull = "", nulls == conf.NullsAsNull, true
+}
+
+// IsNull is true if the value is a null, however it's written
+func (value *ResultsRowValue) IsNull() bool {
+	return value.Null || value.generatedNull
+}
+
+// JSONValue returns the value as it's written in json output, according to its field's kind
+func (value *ResultsRowValue) JSONValue() interface{} {
+	if value.Null {
+		return nil
+	}
+
+	// like nulls written as empty values, which are empty whatever their kind
+	if value.Value == "" {
+		return ""
+	}
+
+	switch value.Kind {
+	case conf.IntegerKind, conf.NumberKind:
+		return json.Number(value.Value)
+	case conf.BooleanKind:
+		if b, err := strconv.ParseBool(value.Value); err == nil {
+			return b
+		}
+	case conf.JSONKind:
+		return json.RawMessage(value.Value)
+	}
+
+	return value.Value
+}
+
+func NewResultsRow(index int, seed int64) *ResultsRow {
+	return &ResultsRow{Index: index, Rand: NewRand(seed)}
+}
+
+// NewRand returns a source of randomness that's cheap to seed, for rows and the values masked in them; math/rand's
+// own source takes longer to seed than most rows take to generate
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(&rowSource{seed: seed})
+}
+
+// rowSource is a splitmix64 generator, which is what RowSeed is when it's given consecutive indexes
+type rowSource struct {
+	seed int64
+	n    int
+}
+
+func (source *rowSource) Seed(seed int64) {
+	source.seed, source.n = seed, 0
+}
+
+func (source *rowSource) Uint64() uint64 {
+	source.n++
+	return uint64(common.RowSeed(source.seed, source.n-1))
+}
+
+func (source *rowSource) Int63() int64 {
+	return int64(source.Uint64() >> 1)
 }
 
 func (entries *ResultRowValueList) GetEntryWithName(name string) (*ResultsRowValue, error) {
@@ -0,0 +1,102 @@
+package core
+
+import (
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/loaders"
+	"github.com/elauffenburger/oar/core/schema"
+)
+
+func GetConfigurationSchema() *schema.Schema {
+	return GetConfigurationSchemaWithTypeLoaderContext(NewTypeLoaderFactoryContext())
+}
+
+// GetConfigurationSchemaWithTypeLoaderContext returns a JSON Schema for configuration files that includes
+// the args of every loader registered in the context
+func GetConfigurationSchemaWithTypeLoaderContext(loaderFactoryContext *loaders.TypeLoaderFactoryContext) *schema.Schema {
+	options := make(map[string]*schema.Schema)
+	for _, name := range conf.OptionNames() {
+		options[name] = &schema.Schema{Type: schema.Types{"string", "number", "boolean"}, Description: conf.OptionDescription(name)}
+	}
+
+	nullRateMin, nullRateMax := 0.0, 1.0
+
+	kinds := make([]interface{}, len(conf.FieldKinds))
+	for i, kind := range conf.FieldKinds {
+		kinds[i] = string(kind)
+	}
+
+	field := schema.Object(map[string]*schema.Schema{
+		"name":     schema.Of("string", "name of the field in the output"),
+		"type":     schema.Of("string", "name of a type in the types block"),
+		"args":     schema.Of("object", "loader args for this field that override the type's own"),
+		"unique":   schema.Of("boolean", "no two rows get the same non-null value for this field"),
+		"nullrate": {Type: schema.Types{"number"}, Description: "probability (0 to 1) that the field is null in a row", Minimum: &nullRateMin, Maximum: &nullRateMax},
+		"kind":     {Type: schema.Types{"string"}, Description: "how the value is written in json output (default: string)", Enum: kinds},
+	}, "name", "type")
+
+	// one branch per loader, discriminated by the loader's name
+	loaderNames := loaderFactoryContext.LoaderNames()
+	loaderBranches := make([]*schema.Schema, len(loaderNames))
+
+	for i, name := range loaderNames {
+		args := loaderFactoryContext.ArgsSchema(name)
+		if args == nil {
+			args = schema.Of("object", "")
+		}
+
+		loaderBranches[i] = &schema.Schema{
+			Type: schema.Types{"object"},
+			Properties: map[string]*schema.Schema{
+				"name": {Const: name},
+				"args": args,
+			},
+			Required:             []string{"name"},
+			AdditionalProperties: schema.Bool(false),
+		}
+	}
+
+	// types that extend another type may leave out the loader's name and only override args
+	loaderBranches = append(loaderBranches, schema.Object(map[string]*schema.Schema{
+		"args": schema.Of("object", "args that override the extended type's args"),
+	}))
+
+	loaderNameEnum := make([]interface{}, len(loaderNames))
+	for i, name := range loaderNames {
+		loaderNameEnum[i] = name
+	}
+
+	loader := &schema.Schema{
+		Type:        schema.Types{"object"},
+		Description: "the loader that generates values for this type",
+		Properties: map[string]*schema.Schema{
+			"name": {Type: schema.Types{"string"}, Enum: loaderNameEnum},
+		},
+		OneOf: loaderBranches,
+	}
+
+	t := schema.Object(map[string]*schema.Schema{
+		"extends": schema.Of("string", "name of a type to inherit the loader and args of"),
+		"loader":  loader,
+	})
+	t.AnyOf = []*schema.Schema{{Required: []string{"loader"}}, {Required: []string{"extends"}}}
+
+	return &schema.Schema{
+		Schema: schema.Draft7,
+		Title:  "oar configuration",
+		Type:   schema.Types{"object"},
+		Properties: map[string]*schema.Schema{
+			"$schema": schema.Of("string", "path or url of this schema, for editors"),
+			"name":    schema.Of("string", "name of the generated data set; used as the table name for sql output"),
+			"output":  {Type: schema.Types{"string"}, Enum: []interface{}{string(conf.JSON), string(conf.SQL), string(conf.NDJSON)}},
+			"rows":    {Type: schema.Types{"integer"}, Description: "number of rows to generate"},
+			"fields":  schema.ArrayOf(field, "fields to generate for each row, in order"),
+			"options": schema.Object(options),
+			"types": {
+				Type:                 schema.Types{"object"},
+				Description:          "types available to fields, by name",
+				AdditionalProperties: t,
+			},
+		},
+		AdditionalProperties: schema.Bool(false),
+	}
+}
@@ -0,0 +1,163 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Document is a JSON Schema or OpenAPI document whose local $refs (like "#/definitions/User") can be resolved
+type Document struct {
+	// the document's root as a schema; for OpenAPI documents it has no type of its own
+	Root *Schema
+
+	raw   interface{}
+	cache map[string]*Schema
+}
+
+// places schemas are kept by name, in the order they're looked up
+var namedSchemaPointers = []string{"/components/schemas/", "/definitions/", "/$defs/"}
+
+func ParseDocument(content []byte) (*Document, error) {
+	var raw interface{}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, err
+	}
+
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("expected the document to be an object")
+	}
+
+	root := &Schema{}
+	if err := json.Unmarshal(content, root); err != nil {
+		return nil, err
+	}
+
+	return &Document{Root: root, raw: raw, cache: make(map[string]*Schema)}, nil
+}
+
+// IsOpenAPI reports whether the document is an OpenAPI (or Swagger) document rather than a schema
+func (doc *Document) IsOpenAPI() bool {
+	object := doc.raw.(map[string]interface{})
+	_, openapi := object["openapi"]
+	_, swagger := object["swagger"]
+
+	return openapi || swagger
+}
+
+// Names returns the names of the schemas in the document's components, definitions or $defs
+func (doc *Document) Names() []string {
+	names := make([]string, 0)
+
+	for _, pointer := range namedSchemaPointers {
+		if object, ok := doc.pointer(strings.TrimSuffix(pointer, "/")).(map[string]interface{}); ok {
+			for name := range object {
+				names = append(names, name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Named returns the schema with the given name from the document's components, definitions or $defs
+func (doc *Document) Named(name string) (*Schema, error) {
+	for _, pointer := range namedSchemaPointers {
+		if doc.pointer(pointer+escapePointer(name)) != nil {
+			return doc.Resolve("#" + pointer + escapePointer(name))
+		}
+	}
+
+	return nil, fmt.Errorf("no schema named '%s'; the document has: %s", name, strings.Join(doc.Names(), ", "))
+}
+
+// Resolve returns the schema a local $ref points to
+func (doc *Document) Resolve(ref string) (*Schema, error) {
+	if schema, ok := doc.cache[ref]; ok {
+		return schema, nil
+	}
+
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("can't resolve '%s'; only refs within the document (starting with #) are supported", ref)
+	}
+
+	pointer, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid ref '%s': %s", ref, err)
+	}
+
+	value := doc.pointer(pointer)
+	if value == nil {
+		return nil, fmt.Errorf("ref '%s' doesn't point to anything in the document", ref)
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{}
+	if err := json.Unmarshal(content, schema); err != nil {
+		return nil, fmt.Errorf("ref '%s' isn't a valid schema: %s", ref, err)
+	}
+
+	doc.cache[ref] = schema
+	return schema, nil
+}
+
+// Deref follows schema's $refs until it reaches a schema without one
+func (doc *Document) Deref(schema *Schema) (*Schema, error) {
+	seen := make(map[string]bool)
+
+	for schema.Ref != "" {
+		if seen[schema.Ref] {
+			return nil, fmt.Errorf("ref '%s' refers to itself", schema.Ref)
+		}
+		seen[schema.Ref] = true
+
+		resolved, err := doc.Resolve(schema.Ref)
+		if err != nil {
+			return nil, err
+		}
+
+		schema = resolved
+	}
+
+	return schema, nil
+}
+
+// pointer returns the value at a JSON pointer like "/definitions/User", or nil
+func (doc *Document) pointer(pointer string) interface{} {
+	value := doc.raw
+	if pointer == "" {
+		return value
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[token]
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+
+	return value
+}
+
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
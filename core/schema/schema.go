@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"encoding/json"
+)
+
+const Draft7 = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a (subset of a) JSON Schema document
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	ID          string `json:"$id,omitempty"`
+	Ref         string `json:"$ref,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type  Types         `json:"type,omitempty"`
+	Enum  []interface{} `json:"enum,omitempty"`
+	Const interface{}   `json:"const,omitempty"`
+
+	Default interface{} `json:"default,omitempty"`
+
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+
+	// numbers since draft 6; booleans that make minimum and maximum exclusive in draft 4 and OpenAPI 3.0
+	ExclusiveMinimum interface{} `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum interface{} `json:"exclusiveMaximum,omitempty"`
+
+	MultipleOf *float64 `json:"multipleOf,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+	Format    string `json:"format,omitempty"`
+
+	MinItems    *int `json:"minItems,omitempty"`
+	MaxItems    *int `json:"maxItems,omitempty"`
+	UniqueItems bool `json:"uniqueItems,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	Items *Schema `json:"items,omitempty"`
+
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	AllOf []*Schema `json:"allOf,omitempty"`
+
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+
+	// OpenAPI 3.0's way of allowing null
+	Nullable bool `json:"nullable,omitempty"`
+
+	// set for the boolean schemas "true" (anything is valid) and "false" (nothing is valid)
+	Bool *bool `json:"-"`
+}
+
+// Types is the "type" keyword, which is either a single type name or a list of them
+type Types []string
+
+func (types Types) MarshalJSON() ([]byte, error) {
+	if len(types) == 1 {
+		return json.Marshal(types[0])
+	}
+
+	return json.Marshal([]string(types))
+}
+
+func (types *Types) UnmarshalJSON(bytes []byte) error {
+	var single string
+	if err := json.Unmarshal(bytes, &single); err == nil {
+		*types = Types{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(bytes, &list); err != nil {
+		return err
+	}
+
+	*types = Types(list)
+	return nil
+}
+
+type schemaAlias Schema
+
+func (schema *Schema) MarshalJSON() ([]byte, error) {
+	if schema.Bool != nil {
+		return json.Marshal(*schema.Bool)
+	}
+
+	return json.Marshal((*schemaAlias)(schema))
+}
+
+func (schema *Schema) UnmarshalJSON(bytes []byte) error {
+	var b bool
+	if err := json.Unmarshal(bytes, &b); err == nil {
+		*schema = Schema{Bool: &b}
+		return nil
+	}
+
+	return json.Unmarshal(bytes, (*schemaAlias)(schema))
+}
+
+// Bool returns the boolean schema "true" or "false"
+func Bool(value bool) *Schema {
+	return &Schema{Bool: &value}
+}
+
+func Of(typename string, description string) *Schema {
+	return &Schema{Type: Types{typename}, Description: description}
+}
+
+// Object returns an object schema with the given properties that doesn't allow any others
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	return &Schema{
+		Type:                 Types{"object"},
+		Properties:           properties,
+		Required:             required,
+		AdditionalProperties: Bool(false),
+	}
+}
+
+func ArrayOf(items *Schema, description string) *Schema {
+	return &Schema{Type: Types{"array"}, Items: items, Description: description}
+}
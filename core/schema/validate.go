@@ -0,0 +1,358 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Validate checks value, as decoded by encoding/json, against schema and returns a description of each problem
+// prefixed with the JSON pointer of the value it's about. Formats other than email, uuid, date-time, date, time,
+// uri, hostname, ipv4 and ipv6 aren't checked.
+func (doc *Document) Validate(schema *Schema, value interface{}) []string {
+	v := &validator{doc: doc, problems: make([]string, 0)}
+	v.validate(schema, normalize(value), "")
+
+	return v.problems
+}
+
+type validator struct {
+	doc      *Document
+	problems []string
+}
+
+func (v *validator) problemf(path string, format string, args ...interface{}) {
+	if path == "" {
+		path = "/"
+	}
+
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+// normalize turns json.Numbers into float64s so values compare the same however they were decoded
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalize(item)
+		}
+
+		return items
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[key] = normalize(item)
+		}
+
+		return object
+	}
+
+	return value
+}
+
+func (v *validator) validate(schema *Schema, value interface{}, path string) {
+	if schema == nil {
+		return
+	}
+
+	if schema.Bool != nil {
+		if !*schema.Bool {
+			v.problemf(path, "no value is allowed here")
+		}
+
+		return
+	}
+
+	if schema.Ref != "" {
+		resolved, err := v.doc.Deref(schema)
+		if err != nil {
+			v.problemf(path, "%s", err)
+			return
+		}
+
+		v.validate(resolved, value, path)
+		return
+	}
+
+	if value == nil && schema.Nullable {
+		return
+	}
+
+	if len(schema.Type) != 0 && !hasType(schema.Type, value) {
+		v.problemf(path, "expected %s, got %s", strings.Join(schema.Type, " or "), describe(value))
+		return
+	}
+
+	if len(schema.Enum) != 0 {
+		found := false
+		for _, allowed := range schema.Enum {
+			found = found || reflect.DeepEqual(normalize(allowed), value)
+		}
+
+		if !found {
+			v.problemf(path, "%s isn't one of the allowed values", describe(value))
+		}
+	}
+
+	if schema.Const != nil && !reflect.DeepEqual(normalize(schema.Const), value) {
+		v.problemf(path, "expected %s, got %s", describe(normalize(schema.Const)), describe(value))
+	}
+
+	switch val := value.(type) {
+	case string:
+		v.validateString(schema, val, path)
+	case float64:
+		v.validateNumber(schema, val, path)
+	case map[string]interface{}:
+		v.validateObject(schema, val, path)
+	case []interface{}:
+		v.validateArray(schema, val, path)
+	}
+
+	for _, sub := range schema.AllOf {
+		v.validate(sub, value, path)
+	}
+
+	if len(schema.AnyOf) != 0 && v.matching(schema.AnyOf, value) == 0 {
+		v.problemf(path, "%s doesn't match any of the allowed schemas", describe(value))
+	}
+
+	if len(schema.OneOf) != 0 {
+		if n := v.matching(schema.OneOf, value); n != 1 {
+			v.problemf(path, "%s matches %d of the schemas in oneOf; expected exactly 1", describe(value), n)
+		}
+	}
+}
+
+// matching returns how many of schemas value is valid against
+func (v *validator) matching(schemas []*Schema, value interface{}) int {
+	n := 0
+	for _, schema := range schemas {
+		sub := &validator{doc: v.doc}
+		sub.validate(schema, value, "")
+
+		if len(sub.problems) == 0 {
+			n++
+		}
+	}
+
+	return n
+}
+
+func hasType(types Types, value interface{}) bool {
+	for _, t := range types {
+		switch val := value.(type) {
+		case nil:
+			if t == "null" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case float64:
+			if t == "number" || t == "integer" && val == math.Trunc(val) {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func describe(value interface{}) string {
+	switch val := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("'%s'", val)
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	}
+
+	return fmt.Sprint(value)
+}
+
+var (
+	uuidPattern     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	emailPattern    = regexp.MustCompile(`^[^@\s]+@[^@\s]+$`)
+	hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+	timePattern     = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?([zZ]|[+-]\d{2}:\d{2})$`)
+)
+
+// checkFormat reports whether value is valid for the format; unknown formats are always valid
+func checkFormat(format string, value string) bool {
+	switch format {
+	case "email":
+		return emailPattern.MatchString(value)
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	case "time":
+		return timePattern.MatchString(value)
+	case "uri":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != ""
+	case "hostname":
+		return len(value) <= 253 && hostnamePattern.MatchString(value)
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && strings.Contains(value, ".")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	}
+
+	return true
+}
+
+func (v *validator) validateString(schema *Schema, value string, path string) {
+	length := utf8.RuneCountInString(value)
+
+	if schema.MinLength != nil && length < *schema.MinLength {
+		v.problemf(path, "'%s' is shorter than %d characters", value, *schema.MinLength)
+	}
+
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		v.problemf(path, "'%s' is longer than %d characters", value, *schema.MaxLength)
+	}
+
+	if schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			v.problemf(path, "can't check pattern '%s': %s", schema.Pattern, err)
+		} else if !re.MatchString(value) {
+			v.problemf(path, "'%s' doesn't match the pattern '%s'", value, schema.Pattern)
+		}
+	}
+
+	if schema.Format != "" && !checkFormat(schema.Format, value) {
+		v.problemf(path, "'%s' isn't a valid %s", value, schema.Format)
+	}
+}
+
+// Bounds returns the schema's inclusive or exclusive lower and upper bounds, from either the draft 4 or draft 6 keywords
+func (schema *Schema) Bounds() (min *float64, minExclusive bool, max *float64, maxExclusive bool) {
+	min, max = schema.Minimum, schema.Maximum
+
+	switch exclusive := schema.ExclusiveMinimum.(type) {
+	case bool:
+		minExclusive = exclusive && min != nil
+	case float64:
+		if min == nil || exclusive >= *min {
+			min, minExclusive = &exclusive, true
+		}
+	}
+
+	switch exclusive := schema.ExclusiveMaximum.(type) {
+	case bool:
+		maxExclusive = exclusive && max != nil
+	case float64:
+		if max == nil || exclusive <= *max {
+			max, maxExclusive = &exclusive, true
+		}
+	}
+
+	return
+}
+
+func (v *validator) validateNumber(schema *Schema, value float64, path string) {
+	min, minExclusive, max, maxExclusive := schema.Bounds()
+
+	if min != nil && (value < *min || minExclusive && value == *min) {
+		v.problemf(path, "%v is less than the minimum of %v", value, *min)
+	}
+
+	if max != nil && (value > *max || maxExclusive && value == *max) {
+		v.problemf(path, "%v is greater than the maximum of %v", value, *max)
+	}
+
+	if schema.MultipleOf != nil && *schema.MultipleOf > 0 {
+		quotient := value / *schema.MultipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.problemf(path, "%v isn't a multiple of %v", value, *schema.MultipleOf)
+		}
+	}
+}
+
+func (v *validator) validateObject(schema *Schema, value map[string]interface{}, path string) {
+	for _, name := range schema.Required {
+		if _, ok := value[name]; !ok {
+			v.problemf(path, "missing required property '%s'", name)
+		}
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := schema.Properties[name]
+		if !ok {
+			property = schema.AdditionalProperties
+		}
+
+		if !ok && property != nil && property.Bool != nil && !*property.Bool {
+			v.problemf(path, "property '%s' isn't allowed", name)
+			continue
+		}
+
+		v.validate(property, value[name], path+"/"+escapePointer(name))
+	}
+}
+
+func (v *validator) validateArray(schema *Schema, value []interface{}, path string) {
+	if schema.MinItems != nil && len(value) < *schema.MinItems {
+		v.problemf(path, "expected at least %d items, got %d", *schema.MinItems, len(value))
+	}
+
+	if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+		v.problemf(path, "expected at most %d items, got %d", *schema.MaxItems, len(value))
+	}
+
+	for i, item := range value {
+		if schema.UniqueItems {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(value[j], item) {
+					v.problemf(fmt.Sprintf("%s/%d", path, i), "%s repeats item %d", describe(item), j)
+					break
+				}
+			}
+		}
+
+		v.validate(schema.Items, item, fmt.Sprintf("%s/%d", path, i))
+	}
+}
@@ -0,0 +1,356 @@
+// Package server serves generated rows over HTTP, with an endpoint for each configuration.
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/loaders"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+type Options struct {
+	// most rows a request can ask for; 0 is no limit
+	MaxRows int
+}
+
+// rows written between flushes, so clients see streamed rows as they're generated
+const rowsPerFlush = 100
+
+// content types of each output, in the order they're preferred when a client accepts any of them
+var contentTypes = []struct {
+	output      conf.OutputType
+	contentType string
+}{
+	{conf.JSON, "application/json"},
+	{conf.NDJSON, "application/x-ndjson"},
+	{conf.SQL, "application/sql"},
+}
+
+type endpoint struct {
+	config *conf.Configuration
+
+	// sets of loaders no request is using; runs reset and change their loaders' state, so each request takes a set of
+	// its own, and more are built when requests overlap
+	mu     sync.Mutex
+	idle   []map[string]loaders.TypeLoader
+	closed bool
+}
+
+type Server struct {
+	options              Options
+	endpoints            map[string]*endpoint
+	loaderFactoryContext *loaders.TypeLoaderFactoryContext
+}
+
+// New returns a server with an endpoint for each configuration at /<name>; a set of its loaders is built up front, and
+// more when requests overlap
+func New(configs map[string]*conf.Configuration, options Options) (*Server, error) {
+	return NewWithTypeLoaderContext(configs, core.NewTypeLoaderFactoryContext(), options)
+}
+
+func NewWithTypeLoaderContext(configs map[string]*conf.Configuration, loaderFactoryContext *loaders.TypeLoaderFactoryContext, options Options) (*Server, error) {
+	server := &Server{options: options, endpoints: make(map[string]*endpoint), loaderFactoryContext: loaderFactoryContext}
+
+	for name, config := range configs {
+		if strings.ContainsAny(name, "/?#") || name == "" {
+			return nil, fmt.Errorf("Can't serve '%s'; names can't be empty or contain '/', '?' or '#'", name)
+		}
+
+		types, err := core.BuildTypeLoadersForConfig(config, loaderFactoryContext)
+		if err != nil {
+			server.Close()
+			return nil, fmt.Errorf("Failed to load '%s': %s", name, err)
+		}
+
+		server.endpoints[name] = &endpoint{config: config, idle: []map[string]loaders.TypeLoader{types}}
+	}
+
+	return server, nil
+}
+
+// Close releases what the endpoints' loaders hold, like files or programs
+func (server *Server) Close() error {
+	var first error
+	for _, endpoint := range server.endpoints {
+		endpoint.mu.Lock()
+		idle := endpoint.idle
+		endpoint.idle, endpoint.closed = nil, true
+		endpoint.mu.Unlock()
+
+		// sets still in use are closed when their requests are done with them
+		for _, types := range idle {
+			if err := core.CloseTypeLoaders(types); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+
+	return first
+}
+
+// acquire returns a set of the endpoint's loaders for a request to use alone, building one if they're all in use
+func (server *Server) acquire(endpoint *endpoint) (map[string]loaders.TypeLoader, error) {
+	endpoint.mu.Lock()
+	if n := len(endpoint.idle); n != 0 {
+		types := endpoint.idle[n-1]
+		endpoint.idle = endpoint.idle[:n-1]
+		endpoint.mu.Unlock()
+
+		return types, nil
+	}
+	endpoint.mu.Unlock()
+
+	return core.BuildTypeLoadersForConfig(endpoint.config, server.loaderFactoryContext)
+}
+
+// release gives back a set of loaders a request is done with
+func (server *Server) release(endpoint *endpoint, types map[string]loaders.TypeLoader) {
+	endpoint.mu.Lock()
+	if !endpoint.closed {
+		endpoint.idle = append(endpoint.idle, types)
+		endpoint.mu.Unlock()
+
+		return
+	}
+	endpoint.mu.Unlock()
+
+	core.CloseTypeLoaders(types)
+}
+
+// Names returns the names of the endpoints in sorted order
+func (server *Server) Names() []string {
+	names := make([]string, 0, len(server.endpoints))
+	for name := range server.endpoints {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.Trim(r.URL.Path, "/")
+	if name == "" {
+		server.serveIndex(w)
+		return
+	}
+
+	endpoint, ok := server.endpoints[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("No configuration named '%s'; try one of: %s", name, strings.Join(server.Names(), ", ")), http.StatusNotFound)
+		return
+	}
+
+	server.serveRows(w, r, endpoint)
+}
+
+// serveIndex lists the endpoints
+func (server *Server) serveIndex(w http.ResponseWriter) {
+	type endpointInfo struct {
+		Path   string          `json:"path"`
+		Rows   int             `json:"rows"`
+		Output conf.OutputType `json:"output"`
+	}
+
+	index := make([]endpointInfo, 0, len(server.endpoints))
+	for _, name := range server.Names() {
+		config := server.endpoints[name].config
+		index = append(index, endpointInfo{Path: "/" + name, Rows: config.NumRows, Output: config.OutputType})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(index)
+}
+
+func (server *Server) serveRows(w http.ResponseWriter, r *http.Request, endpoint *endpoint) {
+	config, status, err := server.requestConfig(r, endpoint.config)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypeOf(config.OutputType)+"; charset=utf-8")
+	w.Header().Set("Vary", "Accept")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	types, err := server.acquire(endpoint)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error loading types: %s", err), http.StatusInternalServerError)
+		return
+	}
+	defer server.release(endpoint, types)
+
+	encoder := core.GetOutputFormatter(config).NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	written := false
+
+	// generation stops once the client has gone away
+	err = core.GenerateRowsWithContextAndTypeLoaders(r.Context(), config, types, func(row *res.ResultsRow) error {
+		written = true
+		if err := encoder.Encode(row); err != nil {
+			return err
+		}
+
+		if flusher != nil && (row.Index+1)%rowsPerFlush == 0 {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		encoder.Close()
+	case !written:
+		http.Error(w, fmt.Sprintf("Error generating results: %s", err), http.StatusInternalServerError)
+	}
+
+	// otherwise the status has been sent, so all that's left is to cut the output short
+}
+
+// requestConfig returns a copy of config with the request's rows, seed and format applied, or the status and error to
+// respond with
+func (server *Server) requestConfig(r *http.Request, config *conf.Configuration) (*conf.Configuration, int, error) {
+	query := r.URL.Query()
+
+	copied := *config
+	copied.Options = make(conf.Options, len(config.Options))
+	for name, value := range config.Options {
+		copied.Options[name] = value
+	}
+
+	if rows := query.Get("rows"); rows != "" {
+		n, err := strconv.Atoi(rows)
+		if err != nil || n < 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("rows must be a whole number, got '%s'", rows)
+		}
+
+		copied.NumRows = n
+	}
+
+	if server.options.MaxRows > 0 && copied.NumRows > server.options.MaxRows {
+		return nil, http.StatusBadRequest, fmt.Errorf("At most %d rows can be requested, got %d", server.options.MaxRows, copied.NumRows)
+	}
+
+	if seed := query.Get("seed"); seed != "" {
+		if _, err := strconv.ParseInt(seed, 10, 64); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("seed must be an integer, got '%s'", seed)
+		}
+
+		copied.Options[conf.SeedOption] = seed
+	}
+
+	if format := query.Get("format"); format != "" {
+		if contentTypeOf(conf.OutputType(format)) == "" {
+			return nil, http.StatusBadRequest, fmt.Errorf("Unknown format '%s'; expected %s", format, formatNames())
+		}
+
+		copied.OutputType = conf.OutputType(format)
+	} else if accept := r.Header.Get("Accept"); accept != "" {
+		output, ok := negotiate(accept, config.OutputType)
+		if !ok {
+			return nil, http.StatusNotAcceptable, fmt.Errorf("Can't respond with any of '%s'; try %s", accept, contentTypeNames())
+		}
+
+		copied.OutputType = output
+	}
+
+	return &copied, http.StatusOK, nil
+}
+
+// negotiate picks the output for an Accept header, preferring the configuration's own output when the client accepts
+// it (e.g. with */*), and otherwise the types the client prefers
+func negotiate(accept string, preferred conf.OutputType) (conf.OutputType, bool) {
+	best, bestQuality := conf.OutputType(""), 0.0
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		for _, candidate := range contentTypes {
+			if !acceptsType(mediaType, candidate.contentType) || quality <= 0 {
+				continue
+			}
+
+			if quality > bestQuality || quality == bestQuality && candidate.output == preferred {
+				best, bestQuality = candidate.output, quality
+			}
+		}
+	}
+
+	return best, bestQuality > 0
+}
+
+func acceptsType(pattern string, contentType string) bool {
+	switch {
+	case pattern == "*/*" || pattern == contentType:
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*"))
+	}
+
+	// common aliases
+	switch contentType {
+	case "application/x-ndjson":
+		return pattern == "application/ndjson" || pattern == "application/jsonl"
+	case "application/sql":
+		return pattern == "text/x-sql" || pattern == "text/sql"
+	}
+
+	return false
+}
+
+func contentTypeOf(output conf.OutputType) string {
+	for _, candidate := range contentTypes {
+		if candidate.output == output {
+			return candidate.contentType
+		}
+	}
+
+	return ""
+}
+
+func formatNames() string {
+	names := make([]string, len(contentTypes))
+	for i, candidate := range contentTypes {
+		names[i] = string(candidate.output)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func contentTypeNames() string {
+	names := make([]string, len(contentTypes))
+	for i, candidate := range contentTypes {
+		names[i] = candidate.contentType
+	}
+
+	return strings.Join(names, ", ")
+}
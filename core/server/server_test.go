@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	config, err := core.LoadConfigurationFromJson(`{
+		"name": "users", "rows": 5,
+		"fields": [{"name": "Id", "type": "id", "kind": "integer"}, {"name": "Status", "type": "status"}],
+		"types": {
+			"id": {"loader": {"name": "autoincrement"}},
+			"status": {"loader": {"name": "choice", "args": {"values": ["active", "banned"]}}}
+		}
+	}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := New(map[string]*conf.Configuration{"users": config}, Options{MaxRows: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func get(t *testing.T, url string, accept string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, string(body)
+}
+
+func TestServesRowsInEachFormat(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, body := get(t, ts.URL+"/users?rows=3&seed=7", "")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		t.Fatalf("Expected json, got %d %s: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &rows); err != nil || len(rows) != 3 || rows[2]["Id"] != 3.0 {
+		t.Errorf("Expected 3 rows with ids, got %s (%v)", body, err)
+	}
+
+	if _, again := get(t, ts.URL+"/users?rows=3&seed=7", ""); again != body {
+		t.Errorf("Expected the same seed to give the same rows, got %s and %s", body, again)
+	}
+
+	resp, body = get(t, ts.URL+"/users?format=ndjson", "")
+	if lines := strings.Split(strings.TrimSpace(body), "\n"); len(lines) != 5 || resp.Header.Get("Content-Type") != "application/x-ndjson; charset=utf-8" {
+		t.Errorf("Expected 5 lines of ndjson, got %s: %s", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, body = get(t, ts.URL+"/users?rows=2", "text/html;q=0.9, application/sql")
+	if !strings.HasPrefix(body, "insert into users ([Id],[Status]) values") || resp.Header.Get("Content-Type") != "application/sql; charset=utf-8" {
+		t.Errorf("Expected sql for Accept: application/sql, got %s: %s", resp.Header.Get("Content-Type"), body)
+	}
+
+	if _, body = get(t, ts.URL+"/users?rows=1", "application/x-ndjson, */*;q=0.1"); !strings.HasPrefix(body, "{") {
+		t.Errorf("Expected the most preferred type, ndjson, got %s", body)
+	}
+
+	if _, body = get(t, ts.URL+"/", ""); !strings.Contains(body, `"path":"/users"`) {
+		t.Errorf("Expected the index to list /users, got %s", body)
+	}
+}
+
+func TestRejectsBadRequests(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, test := range []struct {
+		url    string
+		accept string
+		status int
+	}{
+		{"/users?rows=1000", "", http.StatusBadRequest},
+		{"/users?rows=-1", "", http.StatusBadRequest},
+		{"/users?seed=abc", "", http.StatusBadRequest},
+		{"/users?format=xml", "", http.StatusBadRequest},
+		{"/users", "text/html", http.StatusNotAcceptable},
+		{"/orders", "", http.StatusNotFound},
+	} {
+		if resp, body := get(t, ts.URL+test.url, test.accept); resp.StatusCode != test.status {
+			t.Errorf("Expected %d for %s, got %d: %s", test.status, test.url, resp.StatusCode, body)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/users", "application/json", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST to not be allowed, got %d", resp.StatusCode)
+	}
+}
+
+func TestOverlappingRequestsDontShareLoaderState(t *testing.T) {
+	config, err := core.LoadConfigurationFromJson(`{
+		"name": "totals", "rows": 2000,
+		"fields": [{"name": "Id", "type": "id", "kind": "integer"}, {"name": "Total", "type": "total", "kind": "integer"}],
+		"types": {
+			"id": {"loader": {"name": "autoincrement"}},
+			"total": {"loader": {"name": "script", "args": {"source": "def generate(row, state):\n    state['total'] = state.get('total', 0) + row['Id'] + rand.randint(0, 9)\n    return state['total']"}}}
+		}
+	}`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := New(map[string]*conf.Configuration{"totals": config}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	bodies := make([]string, 4)
+
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			resp, err := http.Get(ts.URL + "/totals?seed=3&format=ndjson")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+
+			body, _ := ioutil.ReadAll(resp.Body)
+			bodies[i] = string(body)
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, body := range bodies {
+		if body != bodies[0] || strings.Count(body, "\n") != 2000 {
+			t.Fatalf("Expected overlapping requests with the same seed to get the same 2000 rows, but request %d differed", i)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package sinks
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/elauffenburger/oar/core/output"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+type DbSinkOptions struct {
+	// database/sql driver name (the driver must be linked into the binary) and data source name
+	Driver string
+	DSN    string
+
+	// rows per insert statement; capped so a statement never exceeds the driver's parameter limit
+	BatchSize int
+
+	// rows per transaction; 0 puts every row in a single transaction
+	TransactionSize int
+
+	// use the driver's bulk-copy path instead of insert statements (postgres only)
+	Copy bool
+
+	// keep going after a transaction fails instead of stopping; failed rows are counted in the report
+	ContinueOnError bool
+}
+
+// DbSinkReport summarises what a DbSink did
+type DbSinkReport struct {
+	RowsInserted int
+	RowsFailed   int
+	Transactions int
+	Errors       []error
+}
+
+type dialect struct {
+	placeholder func(n int) string
+	quoteLeft   string
+	quoteRight  string
+	maxParams   int
+	canCopy     bool
+}
+
+var dialects = map[string]dialect{
+	"sqlite3":   {placeholder: questionMark, quoteLeft: `"`, quoteRight: `"`, maxParams: 999},
+	"sqlite":    {placeholder: questionMark, quoteLeft: `"`, quoteRight: `"`, maxParams: 999},
+	"mysql":     {placeholder: questionMark, quoteLeft: "`", quoteRight: "`", maxParams: 65535},
+	"postgres":  {placeholder: dollarN, quoteLeft: `"`, quoteRight: `"`, maxParams: 65535, canCopy: true},
+	"pgx":       {placeholder: dollarN, quoteLeft: `"`, quoteRight: `"`, maxParams: 65535},
+	"sqlserver": {placeholder: atPN, quoteLeft: "[", quoteRight: "]", maxParams: 2100},
+	"mssql":     {placeholder: atPN, quoteLeft: "[", quoteRight: "]", maxParams: 2100},
+}
+
+var defaultDialect = dialect{placeholder: questionMark, quoteLeft: `"`, quoteRight: `"`, maxParams: 999}
+
+func questionMark(n int) string { return "?" }
+func dollarN(n int) string      { return fmt.Sprintf("$%d", n) }
+func atPN(n int) string         { return fmt.Sprintf("@p%d", n) }
+
+func (d dialect) quote(identifier string) string {
+	// quote each part of a qualified name like dbo.users separately
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = d.quoteLeft + part + d.quoteRight
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// DbSink inserts rows into the SqlOutputFormatter's table using batched prepared statements
+type DbSink struct {
+	db        *sql.DB
+	formatter *output.SqlOutputFormatter
+	dialect   dialect
+	options   DbSinkOptions
+
+	Report DbSinkReport
+
+	columns []string
+	stmts   map[int]*sql.Stmt
+
+	tx        *sql.Tx
+	txRows    int
+	txFailed  bool
+	pending   [][]interface{}
+	copyStmt  *sql.Stmt
+	batchSize int
+}
+
+func NewDbSink(formatter *output.SqlOutputFormatter, options DbSinkOptions) (*DbSink, error) {
+	d, ok := dialects[options.Driver]
+	if !ok {
+		d = defaultDialect
+	}
+
+	if options.Copy && !d.canCopy {
+		return nil, fmt.Errorf("Driver '%s' doesn't support bulk copy", options.Driver)
+	}
+
+	db, err := sql.Open(options.Driver, options.DSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to connect to database: %s", err)
+	}
+
+	return &DbSink{db: db, formatter: formatter, dialect: d, options: options, stmts: make(map[int]*sql.Stmt)}, nil
+}
+
+func (sink *DbSink) Write(row *res.ResultsRow) error {
+	if sink.columns == nil {
+		if err := sink.start(row); err != nil {
+			return err
+		}
+	}
+
+	if sink.tx == nil {
+		if err := sink.begin(); err != nil {
+			return err
+		}
+	}
+
+	values := sink.formatter.ColumnValues(row)
+
+	if sink.options.Copy {
+		if !sink.txFailed {
+			if _, err := sink.copyStmt.Exec(values...); err != nil {
+				sink.txFailed = true
+				sink.Report.Errors = append(sink.Report.Errors, err)
+			}
+		}
+	} else {
+		sink.pending = append(sink.pending, values)
+		if len(sink.pending) == sink.batchSize {
+			sink.flush()
+		}
+	}
+
+	sink.txRows++
+
+	if sink.txFailed && !sink.options.ContinueOnError {
+		return sink.commit()
+	}
+
+	if sink.options.TransactionSize > 0 && sink.txRows >= sink.options.TransactionSize {
+		return sink.commit()
+	}
+
+	return nil
+}
+
+func (sink *DbSink) start(row *res.ResultsRow) error {
+	sink.columns = sink.formatter.ColumnNames(row)
+	if len(sink.columns) == 0 {
+		return fmt.Errorf("Rows have no columns to insert")
+	}
+
+	sink.batchSize = sink.options.BatchSize
+	if sink.batchSize < 1 {
+		sink.batchSize = 1
+	}
+
+	if max := sink.dialect.maxParams / len(sink.columns); sink.batchSize > max {
+		sink.batchSize = max
+	}
+
+	if sink.batchSize < 1 {
+		return fmt.Errorf("Table has more columns (%d) than the driver allows parameters (%d)", len(sink.columns), sink.dialect.maxParams)
+	}
+
+	return nil
+}
+
+func (sink *DbSink) begin() error {
+	tx, err := sink.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	sink.tx, sink.txRows, sink.txFailed = tx, 0, false
+
+	if sink.options.Copy {
+		quoted := make([]string, len(sink.columns))
+		for i, column := range sink.columns {
+			quoted[i] = sink.dialect.quote(column)
+		}
+
+		// lib/pq turns exec calls on a prepared COPY statement into a bulk copy
+		stmt, err := tx.Prepare(fmt.Sprintf("COPY %s (%s) FROM STDIN", sink.dialect.quote(sink.formatter.TableName), strings.Join(quoted, ",")))
+		if err != nil {
+			tx.Rollback()
+			sink.tx = nil
+
+			return err
+		}
+
+		sink.copyStmt = stmt
+	}
+
+	return nil
+}
+
+// insertStatement returns a prepared statement that inserts n rows
+func (sink *DbSink) insertStatement(n int) (*sql.Stmt, error) {
+	if stmt, ok := sink.stmts[n]; ok {
+		return stmt, nil
+	}
+
+	quoted := make([]string, len(sink.columns))
+	for i, column := range sink.columns {
+		quoted[i] = sink.dialect.quote(column)
+	}
+
+	tuples := make([]string, n)
+	param := 1
+	for i := range tuples {
+		placeholders := make([]string, len(sink.columns))
+		for j := range placeholders {
+			placeholders[j] = sink.dialect.placeholder(param)
+			param++
+		}
+
+		tuples[i] = "(" + strings.Join(placeholders, ",") + ")"
+	}
+
+	query := fmt.Sprintf("insert into %s (%s) values %s", sink.dialect.quote(sink.formatter.TableName), strings.Join(quoted, ","), strings.Join(tuples, ","))
+
+	stmt, err := sink.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	sink.stmts[n] = stmt
+	return stmt, nil
+}
+
+// flush inserts the pending rows in the current transaction; once a statement in a transaction fails the
+// rest of the transaction is skipped since it will be rolled back anyway
+func (sink *DbSink) flush() {
+	defer func() { sink.pending = sink.pending[:0] }()
+
+	if len(sink.pending) == 0 || sink.txFailed {
+		return
+	}
+
+	stmt, err := sink.insertStatement(len(sink.pending))
+	if err == nil {
+		args := make([]interface{}, 0, len(sink.pending)*len(sink.columns))
+		for _, values := range sink.pending {
+			args = append(args, values...)
+		}
+
+		_, err = sink.tx.Stmt(stmt).Exec(args...)
+	}
+
+	if err != nil {
+		sink.txFailed = true
+		sink.Report.Errors = append(sink.Report.Errors, err)
+	}
+}
+
+func (sink *DbSink) commit() error {
+	if sink.tx == nil {
+		return nil
+	}
+
+	sink.flush()
+
+	if sink.copyStmt != nil {
+		if !sink.txFailed {
+			// an exec with no args ends the copy
+			if _, err := sink.copyStmt.Exec(); err != nil {
+				sink.txFailed = true
+				sink.Report.Errors = append(sink.Report.Errors, err)
+			}
+		}
+
+		sink.copyStmt.Close()
+		sink.copyStmt = nil
+	}
+
+	tx, rows := sink.tx, sink.txRows
+	sink.tx, sink.txRows = nil, 0
+	sink.Report.Transactions++
+
+	if sink.txFailed {
+		tx.Rollback()
+		sink.Report.RowsFailed += rows
+	} else if err := tx.Commit(); err != nil {
+		sink.Report.RowsFailed += rows
+		sink.Report.Errors = append(sink.Report.Errors, err)
+		sink.txFailed = true
+	} else {
+		sink.Report.RowsInserted += rows
+	}
+
+	if sink.txFailed && !sink.options.ContinueOnError {
+		return fmt.Errorf("Transaction %d failed: %s", sink.Report.Transactions, sink.Report.Errors[len(sink.Report.Errors)-1])
+	}
+
+	return nil
+}
+
+// Close commits any open transaction and closes the connection
+func (sink *DbSink) Close() error {
+	return sink.close(sink.commit())
+}
+
+// Discard rolls back the open transaction and closes the connection; transactions already committed with a
+// TransactionSize are kept
+func (sink *DbSink) Discard() error {
+	var err error
+	if sink.tx != nil {
+		if sink.copyStmt != nil {
+			sink.copyStmt.Close()
+			sink.copyStmt = nil
+		}
+
+		err = sink.tx.Rollback()
+		sink.tx, sink.txRows, sink.pending = nil, 0, sink.pending[:0]
+	}
+
+	return sink.close(err)
+}
+
+func (sink *DbSink) close(err error) error {
+	for _, stmt := range sink.stmts {
+		stmt.Close()
+	}
+
+	if closeErr := sink.db.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,110 @@
+package sinks
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/output"
+	res "github.com/elauffenburger/oar/core/results"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestRow(index int, id string, name string) *res.ResultsRow {
+	row := &res.ResultsRow{Index: index, Rand: rand.New(rand.NewSource(1))}
+	row.Values = append(row.Values,
+		&res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "Id"}, Value: id},
+		&res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "Name"}, Value: name},
+		&res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "Nickname"}, Null: true},
+	)
+
+	return row
+}
+
+func TestDbSinkInsertsIntoSqlite(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	db.Exec(`create table users ("Id" text primary key, "Name" text, "Nickname" text)`)
+
+	sink, err := NewDbSink(output.NewSqlOutputFormatter("users"), DbSinkOptions{
+		Driver:          "sqlite3",
+		DSN:             dsn,
+		BatchSize:       4,
+		TransactionSize: 10,
+		ContinueOnError: true,
+	})
+
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+
+	// the duplicate id in row 15 fails the second transaction (rows 10-19)
+	for i := 0; i < 25; i++ {
+		id := fmt.Sprint(i)
+		if i == 15 {
+			id = "14"
+		}
+
+		if err := sink.Write(newTestRow(i, id, "O'Brien")); err != nil {
+			t.Fatalf("Error writing row %d: %s", i, err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	report := sink.Report
+	if report.RowsInserted != 15 || report.RowsFailed != 10 || report.Transactions != 3 || len(report.Errors) != 1 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	var count int
+	var nulls int
+	db.QueryRow(`select count(*), sum(case when "Nickname" is null and "Name" = 'O''Brien' then 1 else 0 end) from users`).Scan(&count, &nulls)
+
+	if count != 15 || nulls != 15 {
+		t.Errorf("Expected 15 rows with null nicknames, got %d rows and %d nulls", count, nulls)
+	}
+}
+
+func TestDbSinkDiscardRollsBack(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %s", err)
+	}
+	defer db.Close()
+
+	db.Exec(`create table users ("Id" text primary key, "Name" text, "Nickname" text)`)
+
+	sink, err := NewDbSink(output.NewSqlOutputFormatter("users"), DbSinkOptions{Driver: "sqlite3", DSN: dsn, BatchSize: 4})
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := sink.Write(newTestRow(i, fmt.Sprint(i), "ann")); err != nil {
+			t.Fatalf("Error writing row %d: %s", i, err)
+		}
+	}
+
+	if err := sink.Discard(); err != nil {
+		t.Fatalf("Error discarding rows: %s", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`select count(*) from users`).Scan(&count); err != nil || count != 0 || sink.Report.RowsInserted != 0 {
+		t.Errorf("Expected no rows to be inserted, got %d (%v)", count, err)
+	}
+}
@@ -0,0 +1,291 @@
+package sinks
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/output"
+	res "github.com/elauffenburger/oar/core/results"
+	"github.com/klauspost/compress/zstd"
+)
+
+type FileSinkOptions struct {
+	// template for output paths; may contain {name}, {output}, {date} and {shard}. Files ending in .gz or
+	// .zst are compressed with gzip or zstd
+	Path string
+
+	// start a new file once a file holds this many rows or (uncompressed) bytes; 0 means no limit
+	MaxRowsPerFile  int
+	MaxBytesPerFile int64
+
+	// where to write the manifest of produced files; defaults to "<name>.manifest.json" next to the
+	// output when splitting into several files. May contain the placeholders of Path other than {shard}
+	ManifestPath string
+}
+
+type ManifestFile struct {
+	Path string `json:"path"`
+	Rows int    `json:"rows"`
+
+	// size of the file on disk
+	Bytes int64 `json:"bytes"`
+}
+
+type Manifest struct {
+	Name  string         `json:"name"`
+	Rows  int            `json:"rows"`
+	Files []ManifestFile `json:"files"`
+}
+
+// FileSink writes formatted rows to one or more (optionally compressed) files
+type FileSink struct {
+	config    *conf.Configuration
+	formatter output.OutputFormatter
+	options   FileSinkOptions
+	sharded   bool
+	now       time.Time
+
+	Manifest Manifest
+
+	// the file currently being written, if any
+	file       *os.File
+	buffer     *bufio.Writer
+	compressor io.WriteCloser
+	counter    *countingWriter
+	encoder    output.RowEncoder
+	rows       int
+}
+
+func NewFileSink(config *conf.Configuration, formatter output.OutputFormatter, options FileSinkOptions) (*FileSink, error) {
+	if len(options.Path) == 0 {
+		return nil, fmt.Errorf("No output path provided")
+	}
+
+	sharded := options.MaxRowsPerFile > 0 || options.MaxBytesPerFile > 0
+
+	// files need distinct names if there's going to be more than one
+	if sharded && !strings.Contains(options.Path, "{shard}") {
+		options.Path = insertBeforeExtensions(options.Path, "-{shard}")
+	}
+
+	if strings.Contains(options.ManifestPath, "{shard}") {
+		return nil, fmt.Errorf("Manifest path '%s' can't contain {shard}; there's one manifest for every shard", options.ManifestPath)
+	}
+
+	if sharded && len(options.ManifestPath) == 0 {
+		// next to the output, or above it if its directories differ by shard
+		dir := filepath.Dir(options.Path)
+		for strings.Contains(dir, "{shard}") {
+			dir = filepath.Dir(dir)
+		}
+
+		options.ManifestPath = filepath.Join(dir, sinkName(config)+".manifest.json")
+	}
+
+	return &FileSink{
+		config:    config,
+		formatter: formatter,
+		options:   options,
+		sharded:   sharded,
+		now:       time.Now(),
+		Manifest:  Manifest{Name: sinkName(config), Files: make([]ManifestFile, 0)},
+	}, nil
+}
+
+func sinkName(config *conf.Configuration) string {
+	if len(config.Name) == 0 {
+		return "oar"
+	}
+
+	return config.Name
+}
+
+// ExpandPathTemplate fills in the placeholders in an output path template
+func (sink *FileSink) ExpandPathTemplate(template string, shard int) string {
+	return strings.NewReplacer(
+		"{name}", sinkName(sink.config),
+		"{output}", string(sink.config.OutputType),
+		"{date}", sink.now.Format("20060102"),
+		"{shard}", fmt.Sprintf("%04d", shard),
+	).Replace(template)
+}
+
+// insertBeforeExtensions inserts str before a path's extension(s), e.g. users.sql.gz -> users{str}.sql.gz
+func insertBeforeExtensions(path string, str string) string {
+	dir, base := filepath.Split(path)
+
+	ext := filepath.Ext(base)
+	if isCompressedExt(ext) {
+		ext = filepath.Ext(strings.TrimSuffix(base, ext)) + ext
+	}
+
+	return dir + strings.TrimSuffix(base, ext) + str + ext
+}
+
+func isCompressedExt(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".gz", ".gzip", ".zst", ".zstd":
+		return true
+	}
+
+	return false
+}
+
+func (sink *FileSink) Write(row *res.ResultsRow) error {
+	if sink.file == nil {
+		if err := sink.openFile(); err != nil {
+			return err
+		}
+	}
+
+	if err := sink.encoder.Encode(row); err != nil {
+		return err
+	}
+
+	sink.rows++
+	sink.Manifest.Rows++
+
+	if sink.sharded {
+		full := sink.options.MaxRowsPerFile > 0 && sink.rows >= sink.options.MaxRowsPerFile
+		full = full || sink.options.MaxBytesPerFile > 0 && sink.counter.n >= sink.options.MaxBytesPerFile
+
+		if full {
+			return sink.closeFile()
+		}
+	}
+
+	return nil
+}
+
+func (sink *FileSink) openFile() error {
+	path := sink.ExpandPathTemplate(sink.options.Path, len(sink.Manifest.Files)+1)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = file
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		sink.compressor = gzip.NewWriter(file)
+		w = sink.compressor
+	case ".zst", ".zstd":
+		encoder, err := zstd.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		sink.compressor = encoder
+		w = encoder
+	}
+
+	sink.file = file
+	sink.buffer = bufio.NewWriter(w)
+	sink.counter = &countingWriter{w: sink.buffer}
+	sink.encoder = sink.formatter.NewEncoder(sink.counter)
+	sink.rows = 0
+
+	sink.Manifest.Files = append(sink.Manifest.Files, ManifestFile{Path: path})
+	return nil
+}
+
+func (sink *FileSink) closeFile() error {
+	if sink.file == nil {
+		return nil
+	}
+
+	errs := []error{sink.encoder.Close(), sink.buffer.Flush()}
+	if sink.compressor != nil {
+		errs = append(errs, sink.compressor.Close())
+	}
+	errs = append(errs, sink.file.Close())
+
+	current := &sink.Manifest.Files[len(sink.Manifest.Files)-1]
+	current.Rows = sink.rows
+
+	if info, err := os.Stat(current.Path); err == nil {
+		current.Bytes = info.Size()
+	}
+
+	sink.file, sink.compressor = nil, nil
+
+	for _, err := range errs {
+		if err != nil {
+			return fmt.Errorf("Error writing '%s': %s", current.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// Close finishes the current file and writes the manifest, if there is one
+func (sink *FileSink) Close() error {
+	// always produce at least one (empty) file so consumers don't have to special-case zero rows
+	if len(sink.Manifest.Files) == 0 {
+		if err := sink.openFile(); err != nil {
+			return err
+		}
+	}
+
+	if err := sink.closeFile(); err != nil {
+		return err
+	}
+
+	if len(sink.options.ManifestPath) == 0 {
+		return nil
+	}
+
+	bytes, err := json.MarshalIndent(sink.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := sink.ExpandPathTemplate(sink.options.ManifestPath, 0)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(bytes, '\n'), 0644)
+}
+
+// Discard removes the files written so far, and doesn't write the manifest
+func (sink *FileSink) Discard() error {
+	err := sink.closeFile()
+
+	for _, file := range sink.Manifest.Files {
+		if removeErr := os.Remove(file.Path); removeErr != nil && !os.IsNotExist(removeErr) && err == nil {
+			err = removeErr
+		}
+	}
+
+	sink.Manifest.Rows, sink.Manifest.Files = 0, make([]ManifestFile, 0)
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (writer *countingWriter) Write(p []byte) (int, error) {
+	n, err := writer.w.Write(p)
+	writer.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,152 @@
+package sinks
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/output"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+func TestFileSinkShardsAndCompresses(t *testing.T) {
+	dir := t.TempDir()
+	config := &conf.Configuration{Name: "users", OutputType: conf.JSON}
+
+	sink, err := NewFileSink(config, &output.JsonOutputFormatter{}, FileSinkOptions{
+		Path:           filepath.Join(dir, "{name}.json.gz"),
+		MaxRowsPerFile: 4,
+	})
+
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		row := &res.ResultsRow{Index: i, Rand: rand.New(rand.NewSource(1))}
+		row.Values = append(row.Values, &res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "Id"}, Value: "x"})
+
+		if err := sink.Write(row); err != nil {
+			t.Fatalf("Error writing row: %s", err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, "users.manifest.json"))
+	if err != nil {
+		t.Fatalf("Expected a manifest: %s", err)
+	}
+
+	var manifest Manifest
+	json.Unmarshal(bytes, &manifest)
+
+	expectedRows := []int{4, 4, 2}
+	if manifest.Rows != 10 || len(manifest.Files) != len(expectedRows) {
+		t.Fatalf("Unexpected manifest: %+v", manifest)
+	}
+
+	for i, file := range manifest.Files {
+		if filepath.Base(file.Path) != []string{"users-0001.json.gz", "users-0002.json.gz", "users-0003.json.gz"}[i] {
+			t.Errorf("Unexpected file name '%s'", file.Path)
+		}
+
+		f, _ := os.Open(file.Path)
+		reader, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("Expected '%s' to be gzipped: %s", file.Path, err)
+		}
+
+		var rows []map[string]interface{}
+		if err := json.NewDecoder(reader).Decode(&rows); err != nil {
+			t.Errorf("Expected '%s' to be a json array: %s", file.Path, err)
+		}
+
+		f.Close()
+
+		if len(rows) != expectedRows[i] || file.Rows != expectedRows[i] {
+			t.Errorf("Expected %d rows in '%s', got %d (manifest says %d)", expectedRows[i], file.Path, len(rows), file.Rows)
+		}
+	}
+}
+
+func TestFileSinkExpandsTheManifestPath(t *testing.T) {
+	dir := t.TempDir()
+	config := &conf.Configuration{Name: "users", OutputType: conf.NDJSON}
+
+	sink, err := NewFileSink(config, &output.NdjsonOutputFormatter{}, FileSinkOptions{
+		Path:           filepath.Join(dir, "{date}", "{shard}", "{name}.ndjson"),
+		MaxRowsPerFile: 2,
+	})
+
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		row := &res.ResultsRow{Index: i, Rand: rand.New(rand.NewSource(1))}
+		row.Values = append(row.Values, &res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "Id"}, Value: "x"})
+
+		if err := sink.Write(row); err != nil {
+			t.Fatalf("Error writing row: %s", err)
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Error closing sink: %s", err)
+	}
+
+	// the manifest goes in the directory shared by every shard
+	date := sink.now.Format("20060102")
+	if _, err := os.Stat(filepath.Join(dir, date, "users.manifest.json")); err != nil {
+		t.Errorf("Expected a manifest in the expanded directory: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, date, "0002", "users.ndjson")); err != nil {
+		t.Errorf("Expected the second shard in its own directory: %s", err)
+	}
+
+	_, err = NewFileSink(config, &output.NdjsonOutputFormatter{}, FileSinkOptions{Path: "out.ndjson", ManifestPath: "{shard}.json"})
+	if err == nil || !strings.Contains(err.Error(), "can't contain {shard}") {
+		t.Errorf("Expected a manifest path with {shard} to be rejected, got %v", err)
+	}
+}
+
+func TestFileSinkDiscardRemovesItsFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := &conf.Configuration{Name: "users", OutputType: conf.NDJSON}
+
+	sink, err := NewFileSink(config, &output.NdjsonOutputFormatter{}, FileSinkOptions{
+		Path:           filepath.Join(dir, "{name}.ndjson.gz"),
+		MaxRowsPerFile: 2,
+	})
+
+	if err != nil {
+		t.Fatalf("Error creating sink: %s", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		row := &res.ResultsRow{Index: i, Rand: rand.New(rand.NewSource(1))}
+		row.Values = append(row.Values, &res.ResultsRowValue{ConfigurationField: conf.ConfigurationField{Name: "Id"}, Value: "x"})
+
+		if err := sink.Write(row); err != nil {
+			t.Fatalf("Error writing row: %s", err)
+		}
+	}
+
+	if err := sink.Discard(); err != nil {
+		t.Fatalf("Error discarding output: %s", err)
+	}
+
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no shards or manifest to be left, got %d file(s)", len(entries))
+	}
+}
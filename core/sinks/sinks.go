@@ -0,0 +1,46 @@
+package sinks
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/elauffenburger/oar/core/output"
+	res "github.com/elauffenburger/oar/core/results"
+)
+
+// Sink receives generated rows in order and writes them somewhere
+type Sink interface {
+	Write(row *res.ResultsRow) error
+	Close() error
+}
+
+// Discarder is a sink that can undo what it's written, for output that's discarded when generation is stopped early;
+// Discard is called instead of Close
+type Discarder interface {
+	Discard() error
+}
+
+// StreamSink formats rows to a stream (e.g. stdout) as they arrive
+type StreamSink struct {
+	buffer  *bufio.Writer
+	encoder output.RowEncoder
+}
+
+func NewStreamSink(formatter output.OutputFormatter, stream io.Writer) *StreamSink {
+	buffer := bufio.NewWriter(stream)
+
+	return &StreamSink{buffer: buffer, encoder: formatter.NewEncoder(buffer)}
+}
+
+func (sink *StreamSink) Write(row *res.ResultsRow) error {
+	return sink.encoder.Encode(row)
+}
+
+// Close finishes the output and flushes it to the stream, but doesn't close the stream
+func (sink *StreamSink) Close() error {
+	if err := sink.encoder.Close(); err != nil {
+		return err
+	}
+
+	return sink.buffer.Flush()
+}
@@ -1,48 +1,306 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/elauffenburger/oar/core"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/importers"
+	"github.com/elauffenburger/oar/core/loaders"
+	"github.com/elauffenburger/oar/core/sinks"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
 )
 
-var configFlag = flag.String("config", "", "json file to load configuration from")
-var rowsFlag = flag.Int("rows", 0, "number of rows to generate")
-var streamFlag = flag.Bool("stream", false, "Indicates if data should be streamed to stdout")
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(cmd *command, args []string) error
+}
+
+var commands = []*command{
+	generateCommand,
+	validateCommand,
+	previewCommand,
+	typesCommand,
+	loadersCommand,
+	initCommand,
+	importDDLCommand,
+	importSchemaCommand,
+	inferCommand,
+	maskCommand,
+	serveCommand,
+	mockCommand,
+	schemaCommand,
+}
+
+// usageError is returned by commands when they're invoked incorrectly
+type usageError struct {
+	msg string
+}
+
+func (err *usageError) Error() string {
+	return err.msg
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{fmt.Sprintf(format, args...)}
+}
 
 func main() {
-	flag.Parse()
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	// data files are parsed once per process; with $OAR_CACHE_DIR set, they're indexed on disk for later runs too
+	loaders.SetDatasetIndexDir(os.Getenv("OAR_CACHE_DIR"))
+
+	// no subcommand (e.g. "oar -config users.json") means generate, like before subcommands existed
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help" {
+		args = append([]string{generateCommand.name}, args...)
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		err := cmd.run(cmd, args[1:])
+
+		var usageErr *usageError
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, flag.ErrHelp):
+			return exitOK
+		case errors.As(err, &usageErr):
+			fmt.Fprintf(os.Stderr, "oar %s: %s\nRun 'oar %s -help' for usage.\n", cmd.name, err, cmd.name)
+			return exitUsage
+		default:
+			fmt.Fprintf(os.Stderr, "oar %s: %s\n", cmd.name, err)
+			return exitError
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "oar: unknown command '%s'\n\n", name)
+	printUsage(os.Stderr)
+
+	return exitUsage
+}
+
+func printUsage(w *os.File) {
+	fmt.Fprintf(w, "Usage: oar <command> [flags]\n\nCommands:\n")
+
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+
+	fmt.Fprintf(w, "\nRun 'oar <command> -help' for a command's flags.\n")
+}
+
+// newFlagSet returns a flag set for a command that reports errors instead of exiting
+func newFlagSet(cmd *command) *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: oar %s %s\n\n%s\n\nFlags:\n", cmd.name, cmd.args, cmd.description)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// parseFlags parses args, printing usage to stdout for -help and turning bad flags into usage errors
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	flags.SetOutput(ioutil.Discard)
+	err := flags.Parse(args)
+	flags.SetOutput(os.Stdout)
+
+	switch {
+	case err == flag.ErrHelp:
+		flags.Usage()
+		return err
+	case err != nil:
+		return &usageError{err.Error()}
+	}
+
+	return nil
+}
+
+type overridesFlag []*conf.Override
+
+func (overrides *overridesFlag) String() string {
+	strs := make([]string, len(*overrides))
+	for i, override := range *overrides {
+		strs[i] = override.String()
+	}
+
+	return strings.Join(strs, ",")
+}
+
+func (overrides *overridesFlag) Set(value string) error {
+	override, err := conf.ParseOverride(value)
+	if err != nil {
+		return err
+	}
+
+	*overrides = append(*overrides, override)
+	return nil
+}
+
+type optionsFlag struct {
+	overrides *overridesFlag
+}
 
-	configFlagValue := *configFlag
-	rows := *rowsFlag
+func (options optionsFlag) String() string {
+	return ""
+}
 
-	if len(configFlagValue) == 0 {
-		panic("No configuration file provided!")
+func (options optionsFlag) Set(value string) error {
+	return options.overrides.Set("options." + value)
+}
+
+// configFlags are the flags shared by every command that reads a configuration
+type configFlags struct {
+	path       string
+	schema     string
+	schemaName string
+	rows       int
+	overrides  overridesFlag
+	flags      *flag.FlagSet
+}
+
+func addConfigFlags(flags *flag.FlagSet) *configFlags {
+	cf := &configFlags{flags: flags}
+
+	flags.StringVar(&cf.path, "config", "", "json file to load configuration from (or pass it as the first argument)")
+	flags.StringVar(&cf.schema, "schema", "", "generate objects valid against this JSON Schema or OpenAPI document (json or yaml) instead of a configuration")
+	flags.StringVar(&cf.schemaName, "schema-name", "", "with -schema, the name of the schema to use from the document's components or definitions")
+	flags.IntVar(&cf.rows, "rows", 0, "number of rows to generate")
+	flags.Var(&cf.overrides, "set", "override a configuration value by path, e.g. 'types.city.loader.args.src=/data/cities.csv' (repeatable)")
+	flags.Var(optionsFlag{&cf.overrides}, "option", fmt.Sprintf("override an engine option, e.g. 'seed=42' (repeatable); one of: %s", strings.Join(conf.OptionNames(), ", ")))
+
+	return cf
+}
+
+// load loads the configuration named by -config or the first positional argument
+func (cf *configFlags) load() (*conf.Configuration, error) {
+	if len(cf.schema) != 0 {
+		return cf.loadFromSchema()
 	}
 
-	config, err := core.LoadConfigurationFromFile(configFlagValue)
+	if len(cf.schemaName) != 0 {
+		return nil, usageErrorf("-schema-name requires -schema")
+	}
+
+	path := cf.path
+	if len(path) == 0 && cf.flags.NArg() > 0 {
+		path = cf.flags.Arg(0)
+	}
+
+	if len(path) == 0 {
+		return nil, usageErrorf("no configuration file provided")
+	}
+
+	config, err := core.LoadConfigurationFromFileWithOverrides(path, cf.overrides)
 	if err != nil {
-		panic(fmt.Sprintf("Error loading configuration file: %s", err))
+		return nil, fmt.Errorf("Error loading configuration file: %s", err)
+	}
+
+	if cf.rows != 0 {
+		config.NumRows = cf.rows
 	}
 
-	if rows != 0 {
-		config.NumRows = rows
+	return config, nil
+}
+
+// loadFromSchema builds a configuration from the document named by -schema, then loads it like a file
+func (cf *configFlags) loadFromSchema() (*conf.Configuration, error) {
+	if len(cf.path) != 0 || cf.flags.NArg() > 0 {
+		return nil, usageErrorf("-schema can't be combined with a configuration file")
 	}
 
-	results, err := core.GenerateResults(config)
+	config, err := configFromSchema(cf.schema, cf.schemaName, importers.JSONSchemaOptions{Rows: 10, DataDir: "data"})
 	if err != nil {
-		panic(fmt.Sprintf("Error generating results: '%s'", err))
+		return nil, err
 	}
 
-	// print results to stdout
-	formatter := core.GetOutputFormatter(config)
+	content, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
 
-	if *streamFlag {
-		formatter.FormatToStream(results, os.Stdout)
-	} else {
-		fmt.Fprint(os.Stdout, formatter.Format(results))
+	// csv paths are relative to the working directory, like -data's default
+	config, err = core.LoadConfigurationFromJsonWithOverrides(string(content), cf.overrides)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading configuration from schema: %s", err)
 	}
+
+	if config.Dir, err = os.Getwd(); err != nil {
+		return nil, err
+	}
+
+	if cf.rows != 0 {
+		config.NumRows = cf.rows
+	}
+
+	return config, nil
+}
+
+// configFromSchema builds a configuration from the named schema in the JSON Schema or OpenAPI document at path
+func configFromSchema(path string, name string, options importers.JSONSchemaOptions) (*conf.Configuration, error) {
+	doc, err := importers.LoadSchemaDocument(path)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := importers.RootSchema(doc, name)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := importers.ConfigurationFromJSONSchema(doc, root, name, options)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build a configuration from '%s': %s", path, err)
+	}
+
+	return config, nil
+}
+
+// generateToSink generates the config's rows into sink until ctx is done, and closes it. When generation is stopped
+// early, what was written is discarded if the partial option says so and the sink can, and finished otherwise.
+func generateToSink(ctx context.Context, config *conf.Configuration, sink sinks.Sink) error {
+	err := core.GenerateRowsWithContext(ctx, config, sink.Write)
+
+	if discarder, ok := sink.(sinks.Discarder); ok && err != nil && err == ctx.Err() && config.Options.Partial() == conf.DiscardPartialOutput {
+		if discardErr := discarder.Discard(); discardErr != nil {
+			return fmt.Errorf("Failed to discard partial output: %s", discardErr)
+		}
+
+		return generationError(err)
+	}
+
+	if closeErr := sink.Close(); err == nil {
+		err = closeErr
+	}
+
+	return generationError(err)
 }
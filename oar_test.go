@@ -1,16 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"bufio"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/elauffenburger/oar/core"
 	conf "github.com/elauffenburger/oar/core/configuration"
 	"github.com/elauffenburger/oar/core/output"
 	res "github.com/elauffenburger/oar/core/results"
+	"github.com/elauffenburger/oar/core/sinks"
 )
 
 func TestCanLoadFromFile(t *testing.T) {
@@ -173,3 +178,102 @@ func TestCanConvertAndStreamToSql(t *testing.T) {
 
 	writer.Flush()
 }
+
+func TestResolvesLoaderPathsRelativeToConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	ioutil.WriteFile(filepath.Join(dir, "names.csv"), []byte("Jay\nJay"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{
+		"rows": 2, "output": "json", "name": "Names",
+		"fields": [{"name": "Name", "type": "name"}],
+		"types": {"name": {"loader": {"name": "csvloader", "args": {"separator": "\n", "src": "./names.csv"}}}}
+	}`), 0644)
+
+	config, err := core.LoadConfigurationFromFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatalf("Error loading configuration: %s", err)
+	}
+
+	results, err := core.GenerateResults(config)
+	if err != nil {
+		t.Fatalf("Error generating results: %s", err)
+	}
+
+	if name, _ := results.Rows[0].Values.GetEntryWithName("Name"); name.Value != "Jay" {
+		t.Errorf("Expected 'Jay', got '%s'", name.Value)
+	}
+
+	os.Remove(filepath.Join(dir, "names.csv"))
+
+	_, err = core.GenerateResults(config)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dir, "names.csv")) {
+		t.Errorf("Expected error to contain resolved path, got: %v", err)
+	}
+}
+
+func TestCliExitCodes(t *testing.T) {
+	cases := []struct {
+		args     []string
+		exitCode int
+	}{
+		{[]string{"validate", "./test/test.json"}, exitOK},
+		{[]string{"validate", "-help"}, exitOK},
+		{[]string{"validate", "./test/does-not-exist.json"}, exitError},
+		{[]string{"validate"}, exitUsage},
+		{[]string{"generate", "-bogus"}, exitUsage},
+		{[]string{"bogus"}, exitUsage},
+	}
+
+	for _, c := range cases {
+		if code := run(c.args); code != c.exitCode {
+			t.Errorf("Expected 'oar %s' to exit with %d, got %d", strings.Join(c.args, " "), c.exitCode, code)
+		}
+	}
+}
+
+func TestGenerationReportSummarizesRuns(t *testing.T) {
+	config, err := core.NewConfig("t").Rows(20).Field("n", core.Number(1, 100)).Field("id", core.UUID()).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var summary strings.Builder
+	report := newGenerationReport(config, &summary, true)
+
+	sink := sinks.NewStreamSink(report.formatter(&output.NdjsonOutputFormatter{}), ioutil.Discard)
+	if err := generateToSink(core.WithMetrics(context.Background(), report.metrics), config, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	if line := report.progressLine(); !strings.HasPrefix(line, "20/20 rows (100%)") || !strings.HasSuffix(line, "B") {
+		t.Errorf("Expected every row and the bytes written in the progress line, got '%s'", line)
+	}
+
+	report.finish()
+
+	for _, expected := range []string{"Generated 20 rows in ", "TYPE", "number  20 ", "uuid    20 "} {
+		if !strings.Contains(summary.String(), expected) {
+			t.Errorf("Expected the summary to contain '%s', got:\n%s", expected, summary.String())
+		}
+	}
+}
+
+func TestImportDDLNamesClashingTablesAfterTheirSchemas(t *testing.T) {
+	dir := t.TempDir()
+	schema := filepath.Join(dir, "schema.sql")
+
+	sql := "create table a.users (id int); create table b.users (id int); create table orders (id int);"
+	if err := ioutil.WriteFile(schema, []byte(sql), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := run([]string{"import-ddl", "-out", dir, schema}); code != exitOK {
+		t.Fatalf("Expected import-ddl to succeed, got %d", code)
+	}
+
+	for _, name := range []string{"a.users.json", "b.users.json", "orders.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected '%s' to be written: %s", name, err)
+		}
+	}
+}
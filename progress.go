@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/elauffenburger/oar/core"
+	"github.com/elauffenburger/oar/core/common"
+	conf "github.com/elauffenburger/oar/core/configuration"
+	"github.com/elauffenburger/oar/core/output"
+)
+
+// time between updates of the progress line
+const progressInterval = 250 * time.Millisecond
+
+// generationReport shows the progress of a run on stderr and summarizes it at the end, from the run's metrics and the
+// bytes written by its formatter
+type generationReport struct {
+	metrics *core.Metrics
+	total   int
+	bytes   int64
+
+	out      io.Writer
+	stats    bool
+	stopOnce sync.Once
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func newGenerationReport(config *conf.Configuration, out io.Writer, stats bool) *generationReport {
+	return &generationReport{metrics: core.NewMetrics(), total: config.NumRows, out: out, stats: stats}
+}
+
+// isTerminal is true if file is a terminal rather than a file or pipe
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// formatter returns formatter, counting the bytes it writes
+func (report *generationReport) formatter(formatter output.OutputFormatter) output.OutputFormatter {
+	if report == nil {
+		return formatter
+	}
+
+	return &countingFormatter{OutputFormatter: formatter, bytes: &report.bytes}
+}
+
+// startProgress rewrites a line on out with the run's progress until the report is stopped
+func (report *generationReport) startProgress() {
+	report.done = make(chan struct{})
+	report.stopped = make(chan struct{})
+
+	go func() {
+		defer close(report.stopped)
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(report.out, "\r%s\x1b[K", report.progressLine())
+			case <-report.done:
+				fmt.Fprintf(report.out, "\r%s\x1b[K\n", report.progressLine())
+				return
+			}
+		}
+	}()
+}
+
+func (report *generationReport) progressLine() string {
+	rows := report.metrics.Rows()
+	elapsed := report.metrics.Elapsed()
+
+	line := fmt.Sprintf("%d/%d rows", rows, report.total)
+	if report.total > 0 {
+		line += fmt.Sprintf(" (%d%%)", rows*100/int64(report.total))
+	}
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(rows) / elapsed.Seconds()
+	}
+
+	parts := []string{line, fmt.Sprintf("%.0f rows/s", rate)}
+	if bytes := atomic.LoadInt64(&report.bytes); bytes > 0 {
+		parts = append(parts, common.FormatByteSize(bytes))
+	}
+
+	if rate > 0 && rows < int64(report.total) {
+		eta := time.Duration(float64(int64(report.total)-rows) / rate * float64(time.Second))
+		parts = append(parts, "ETA "+eta.Round(time.Second).String())
+	}
+
+	return strings.Join(parts, "  ")
+}
+
+// stopProgress writes the last progress line, so anything written after it starts on a line of its own
+func (report *generationReport) stopProgress() {
+	if report == nil || report.done == nil {
+		return
+	}
+
+	report.stopOnce.Do(func() {
+		close(report.done)
+		<-report.stopped
+	})
+}
+
+// finish stops the progress line and writes the summary, if it was asked for
+func (report *generationReport) finish() {
+	if report == nil {
+		return
+	}
+
+	report.stopProgress()
+	if report.stats {
+		writeStats(report.out, report.metrics.Summary(), atomic.LoadInt64(&report.bytes))
+	}
+}
+
+// writeStats writes how long a run took and how its loaders' time was spent, slowest first
+func writeStats(w io.Writer, summary core.MetricsSummary, bytes int64) {
+	var rate float64
+	if summary.Elapsed > 0 {
+		rate = float64(summary.Rows) / summary.Elapsed.Seconds()
+	}
+
+	fmt.Fprintf(w, "Generated %d rows in %s (%.0f rows/s)", summary.Rows, summary.Elapsed.Round(time.Millisecond), rate)
+	if bytes > 0 {
+		fmt.Fprintf(w, ", %s", common.FormatByteSize(bytes))
+	}
+
+	fmt.Fprintf(w, "; %d unique retries\n", summary.UniqueRetries)
+
+	var total time.Duration
+	for _, t := range summary.Types {
+		total += t.Time
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tLOADER\tVALUES\tNULLS\tTIME\tSHARE")
+
+	for _, t := range summary.Types {
+		share := 0.0
+		if total > 0 {
+			share = float64(t.Time) * 100 / float64(total)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%.1f%%\n", t.Type, t.Loader, t.Values, t.Nulls, t.Time.Round(time.Microsecond), share)
+	}
+
+	tw.Flush()
+}
+
+// countingFormatter counts the bytes written by its encoders, which may be used by several goroutines
+type countingFormatter struct {
+	output.OutputFormatter
+	bytes *int64
+}
+
+func (formatter *countingFormatter) NewEncoder(stream io.Writer) output.RowEncoder {
+	return formatter.OutputFormatter.NewEncoder(&countingWriter{w: stream, n: formatter.bytes})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (writer *countingWriter) Write(p []byte) (int, error) {
+	n, err := writer.w.Write(p)
+	atomic.AddInt64(writer.n, int64(n))
+
+	return n, err
+}